@@ -1,25 +1,36 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/pouriya/mcpedia/internal/db"
+	"github.com/pouriya/mcpedia/internal/diff"
 	"github.com/pouriya/mcpedia/internal/importfm"
 	"github.com/pouriya/mcpedia/internal/mcp"
 )
 
-const defaultDB = "mcpedia.db"
+const (
+	defaultDB             = "mcpedia.db"
+	defaultTrashRetention = "720h"
+)
 
 func main() {
 	if len(os.Args) < 2 {
@@ -31,16 +42,40 @@ func main() {
 		cmdInit(os.Args[2:])
 	case "serve":
 		cmdServe(os.Args[2:])
+	case "migrate":
+		cmdMigrate(os.Args[2:])
 	case "add":
 		cmdAdd(os.Args[2:])
 	case "edit":
 		cmdEdit(os.Args[2:])
 	case "list":
 		cmdList(os.Args[2:])
+	case "search":
+		cmdSearch(os.Args[2:])
 	case "lock":
 		cmdLock(os.Args[2:])
 	case "unlock":
 		cmdUnlock(os.Args[2:])
+	case "trash":
+		cmdTrash(os.Args[2:])
+	case "history":
+		cmdHistory(os.Args[2:])
+	case "restore":
+		cmdRestore(os.Args[2:])
+	case "dangling":
+		cmdDangling(os.Args[2:])
+	case "audit":
+		cmdAudit(os.Args[2:])
+	case "stale":
+		cmdStale(os.Args[2:])
+	case "review":
+		cmdReview(os.Args[2:])
+	case "token":
+		cmdToken(os.Args[2:])
+	case "attach":
+		cmdAttach(os.Args[2:])
+	case "detach":
+		cmdDetach(os.Args[2:])
 	case "export":
 		cmdExport(os.Args[2:])
 	case "import":
@@ -61,24 +96,40 @@ Usage:
   mcpedia <command> [flags]
 
 Commands:
-  init     Create and initialize the database
-  serve    Start the MCP HTTP server
-  add      Add a new entry
-  edit     Edit an existing entry
-  list     List entries
-  lock     Lock the database (prevent AI writes)
-  unlock   Unlock the database
-  export   Export entries as markdown files
-  import   Import a single entry from an export-format markdown file
+  init      Create and initialize the database
+  serve     Start the MCP HTTP server
+  migrate   Show or apply database schema migrations
+  add       Add a new entry
+  edit      Edit an existing entry
+  list      List entries
+  search    Search entries (see 'mcpedia search --help' for the query syntax)
+  lock      Lock the database (prevent AI writes)
+  unlock    Unlock the database
+  token     Create, list, or revoke API tokens
+  trash     List, restore, or purge deleted entries
+  history   Show the revision history of an entry
+  restore   Restore an entry to a prior version
+  dangling  List [[slug]] references to entries that do not exist
+  audit     Show who changed which entries
+  stale     List entries due for review or expired
+  review    List, diff, approve, or reject changes awaiting review
+  attach    Attach a file to an entry
+  detach    Remove an attachment from an entry
+  export    Export entries as markdown files
+  import    Import a single entry from an export-format markdown file
 
 Environment variables:
-  MCPEDIA_DB      Database path (default: %s)
-  MCPEDIA_ADDR    Server address (default: :8080)
-  MCPEDIA_TOKEN   Bearer token for auth
-  MCPEDIA_DEBUG   Enable debug logging (any non-empty value)
+  MCPEDIA_DB               Database path (default: %s)
+  MCPEDIA_ADDR             Server address (default: :8080)
+  MCPEDIA_TOKEN            Bearer token for auth
+  MCPEDIA_CONFIG           Namespaces config file for serve
+  MCPEDIA_TRASH_RETENTION  How long deleted entries are kept (default: %s)
+  MCPEDIA_CACHE_SIZE       Entries cached in memory by serve (default: 0, off)
+  MCPEDIA_PROPOSE_WRITES   Queue agent writes for review (any non-empty value)
+  MCPEDIA_DEBUG            Enable debug logging (any non-empty value)
 
 Run 'mcpedia <command> --help' for more information.
-`, defaultDB)
+`, defaultDB, defaultTrashRetention)
 }
 
 // --- init ---
@@ -98,6 +149,51 @@ func cmdInit(args []string) {
 	fmt.Printf("Database initialized at %s\n", path)
 }
 
+// --- migrate ---
+
+func cmdMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	status := fs.Bool("status", false, "Show the schema version and pending migrations without applying them")
+	to := fs.Int("to", db.LatestVersion(), "Migrate up to this schema version")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	d, err := db.OpenNoMigrate(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	if !*status {
+		if err := d.Migrate(ctx, *to); err != nil {
+			fatal("migrate: %v", err)
+		}
+	}
+
+	current, err := d.SchemaVersion(ctx)
+	if err != nil {
+		fatal("migrate: %v", err)
+	}
+	fmt.Printf("Schema version: %d (latest: %d)\n\n", current, db.LatestVersion())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, m := range db.Migrations() {
+		state := "pending"
+		if m.Version <= current {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, state)
+	}
+	w.Flush()
+	if current > db.LatestVersion() {
+		fmt.Fprintf(os.Stderr, "\nWarning: database schema version %d is newer than this binary supports.\n", current)
+	}
+}
+
 // --- serve ---
 
 func cmdServe(args []string) {
@@ -105,16 +201,32 @@ func cmdServe(args []string) {
 	dbPath := fs.String("db", "", "Database path")
 	addr := fs.String("addr", "", "Listen address")
 	token := fs.String("token", "", "Bearer token for auth (empty = no auth)")
+	trashRetention := fs.String("trash-retention", "", "How long deleted entries stay in the trash before being purged (0 = keep forever)")
+	cacheSize := fs.String("cache-size", "", "Number of entry and context results to cache in memory (0 = off)")
+	config := fs.String("config", "", "Namespaces config file: serve several databases under /mcp/<name> (replaces --db and --token)")
+	proposeWrites := fs.Bool("propose-writes", false, "Queue agent writes for human review (see 'mcpedia review') instead of applying them")
 	debug := fs.Bool("debug", false, "Enable debug logging")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+	configPath := resolve(*config, "MCPEDIA_CONFIG", "")
 	listenAddr := resolve(*addr, "MCPEDIA_ADDR", ":8080")
 	authToken := resolve(*token, "MCPEDIA_TOKEN", "")
+	retention, err := time.ParseDuration(resolve(*trashRetention, "MCPEDIA_TRASH_RETENTION", defaultTrashRetention))
+	if err != nil {
+		fatal("serve: invalid trash retention: %v", err)
+	}
+	cacheEntries, err := strconv.Atoi(resolve(*cacheSize, "MCPEDIA_CACHE_SIZE", "0"))
+	if err != nil || cacheEntries < 0 {
+		fatal("serve: invalid cache size: %q", resolve(*cacheSize, "MCPEDIA_CACHE_SIZE", "0"))
+	}
 
 	if !*debug && os.Getenv("MCPEDIA_DEBUG") != "" {
 		*debug = true
 	}
+	if !*proposeWrites && os.Getenv("MCPEDIA_PROPOSE_WRITES") != "" {
+		*proposeWrites = true
+	}
 
 	level := slog.LevelInfo
 	if *debug {
@@ -123,30 +235,75 @@ func cmdServe(args []string) {
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 	slog.SetDefault(logger)
 
-	d, err := db.Open(path)
-	if err != nil {
-		fatal("serve: %v", err)
+	namespaces := []namespaceConfig{{DB: path, Token: authToken}}
+	if configPath != "" {
+		namespaces, err = loadNamespaces(configPath)
+		if err != nil {
+			fatal("serve: %v", err)
+		}
 	}
-	defer d.Close()
 
-	server := &mcp.Server{DB: d, Token: authToken}
-	mux := http.NewServeMux()
-	mux.Handle("/mcp", server)
-	mux.Handle("/", server)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	var handler http.Handler
+	var servers []*mcp.Server
+	federation := mcp.NewFederation()
+	for _, ns := range namespaces {
+		d, err := db.OpenWithOptions(ns.DB, db.Options{CacheSize: cacheEntries})
+		if err != nil {
+			fatal("serve: %s: %v", ns.DB, err)
+		}
+		defer d.Close()
+		if retention > 0 {
+			go purgeTrashLoop(ctx, d, retention)
+		}
+		server := &mcp.Server{DB: d, Token: ns.Token, ProposeWrites: ns.ProposeWrites || *proposeWrites}
+		servers = append(servers, server)
+		if configPath == "" {
+			mux := http.NewServeMux()
+			mux.Handle("/mcp", server)
+			mux.Handle("/", server)
+			handler = mux
+		} else if err := federation.Add(ns.Name, server); err != nil {
+			fatal("serve: %s: %v", configPath, err)
+		}
+	}
+	if configPath != "" {
+		handler = federation.Handler()
+	}
 
-	srv := &http.Server{Addr: listenAddr, Handler: mux}
+	srv := &http.Server{Addr: listenAddr, Handler: handler}
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			fatal("serve: %v", err)
 		}
 	}()
 
-	slog.Info("server starting",
-		"addr", listenAddr,
-		"db", path,
-		"auth", authToken != "",
-		"debug", *debug,
-	)
+	if configPath == "" {
+		slog.Info("server starting",
+			"addr", listenAddr,
+			"db", path,
+			"auth", authToken != "",
+			"propose_writes", *proposeWrites,
+			"trash_retention", retention.String(),
+			"cache_size", cacheEntries,
+			"debug", *debug,
+		)
+	} else {
+		slog.Info("server starting",
+			"addr", listenAddr,
+			"config", configPath,
+			"namespaces", federation.Names(),
+			"trash_retention", retention.String(),
+			"cache_size", cacheEntries,
+			"debug", *debug,
+		)
+		for _, ns := range namespaces {
+			slog.Info("namespace", "name", ns.Name, "path", "/mcp/"+ns.Name, "db", ns.DB, "auth", ns.Token != "",
+				"propose_writes", ns.ProposeWrites || *proposeWrites)
+		}
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -158,9 +315,82 @@ func cmdServe(args []string) {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		fatal("shutdown: %v", err)
 	}
+	if cacheEntries > 0 {
+		for _, server := range servers {
+			cs := server.DB.CacheStats()
+			slog.Info("cache stats", "namespace", server.Namespace, "hits", cs.Hits, "misses", cs.Misses, "size", cs.Size)
+		}
+	}
 	slog.Info("server stopped")
 }
 
+// namespaceConfig is one knowledge base in a serve --config file.
+type namespaceConfig struct {
+	Name  string `json:"name"`
+	DB    string `json:"db"`
+	Token string `json:"token"`
+	// ProposeWrites queues agent writes to this namespace for review, as
+	// serve --propose-writes does for all of them.
+	ProposeWrites bool `json:"propose_writes"`
+}
+
+// loadNamespaces reads a serve --config file:
+//
+//	{"namespaces": [{"name": "team", "db": "team.db", "token": "...", "propose_writes": true}, ...]}
+//
+// Relative database paths are relative to the config file. A token of the
+// form "$NAME" is read from the environment variable NAME.
+func loadNamespaces(path string) ([]namespaceConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Namespaces []namespaceConfig `json:"namespaces"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Namespaces) == 0 {
+		return nil, fmt.Errorf("%s: no namespaces", path)
+	}
+	for i, ns := range cfg.Namespaces {
+		if ns.DB == "" {
+			return nil, fmt.Errorf("%s: namespace %q: db is required", path, ns.Name)
+		}
+		if !filepath.IsAbs(ns.DB) {
+			cfg.Namespaces[i].DB = filepath.Join(filepath.Dir(path), ns.DB)
+		}
+		if env, ok := strings.CutPrefix(ns.Token, "$"); ok {
+			if cfg.Namespaces[i].Token = os.Getenv(env); cfg.Namespaces[i].Token == "" {
+				return nil, fmt.Errorf("%s: namespace %q: environment variable %s is not set", path, ns.Name, env)
+			}
+		}
+	}
+	return cfg.Namespaces, nil
+}
+
+// purgeTrashLoop hourly removes entries that have been in the trash longer than retention.
+func purgeTrashLoop(ctx context.Context, d *db.DB, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := d.PurgeTrash(ctx, retention)
+		if err != nil {
+			slog.Error("purge trash", "err", err)
+		} else if n > 0 {
+			slog.Info("trash purged", "items", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // --- add ---
 
 func cmdAdd(args []string) {
@@ -175,6 +405,11 @@ func cmdAdd(args []string) {
 	tags := fs.String("tags", "", "Comma-separated tags")
 	description := fs.String("description", "", "Short description")
 	file := fs.String("file", "", "Path to content file (required)")
+	reviewAfter := fs.String("review-after", "", "Date the entry is due for review (YYYY-MM-DD)")
+	expires := fs.String("expires", "", "Date the entry stops applying (YYYY-MM-DD)")
+	status := fs.String("status", db.StatusApproved, "Status: "+strings.Join(db.Statuses, ", ")+" (drafts and proposed entries stay hidden until approved with 'mcpedia review approve')")
+	var links linkFlags
+	fs.Var(&links, "link", "Link to another entry as type:slug (repeatable; types: "+strings.Join(db.LinkTypes, ", ")+")")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
@@ -184,6 +419,9 @@ func cmdAdd(args []string) {
 		fs.Usage()
 		os.Exit(1)
 	}
+	if err := links.validate(); err != nil {
+		fatal("%v", err)
+	}
 
 	content, err := os.ReadFile(*file)
 	if err != nil {
@@ -206,10 +444,21 @@ func cmdAdd(args []string) {
 		Domain:      *domain,
 		Project:     *project,
 		Tags:        parseTags(*tags),
+		ReviewAfter: *reviewAfter,
+		ExpiresAt:   *expires,
+		Status:      *status,
 	}
-	if err := d.CreateEntry(context.Background(), e); err != nil {
+	ctx := context.Background()
+	// Check the links first so a bad one does not leave the entry half added
+	if err := links.checkTargets(ctx, d, e.Slug); err != nil {
+		fatal("%v", err)
+	}
+	if err := d.CreateEntry(ctx, e); err != nil {
 		fatal("create: %v", err)
 	}
+	if err := applyLinks(ctx, d, e.Slug, links, nil); err != nil {
+		fatal("%v", err)
+	}
 
 	fmt.Printf("Entry created: %s (%s)\n", e.Slug, e.Title)
 	fmt.Printf("  Kind: %s  Language: %s  Domain: %s  Project: %s\n", e.Kind, e.Language, e.Domain, e.Project)
@@ -217,6 +466,11 @@ func cmdAdd(args []string) {
 		fmt.Printf("  Tags: %s\n", strings.Join(e.Tags, ", "))
 	}
 	fmt.Printf("  Version: %d  Content: %d bytes\n", e.Version, len(e.Content))
+	if e.Status != db.StatusApproved {
+		fmt.Printf("  Status: %s (hidden until approved)\n", e.Status)
+	}
+	printReviewDates(e)
+	printLinks(ctx, d, e.Slug)
 }
 
 // --- edit ---
@@ -233,6 +487,12 @@ func cmdEdit(args []string) {
 	tags := fs.String("tags", "", "New comma-separated tags (replaces all)")
 	description := fs.String("description", "", "New description")
 	file := fs.String("file", "", "Path to new content file")
+	reviewAfter := fs.String("review-after", "", "New review date (YYYY-MM-DD, empty to clear)")
+	expires := fs.String("expires", "", "New expiry date (YYYY-MM-DD, empty to clear)")
+	ifVersion := fs.Int("if-version", 0, "Only edit if the entry is still at this version")
+	var links, unlinks linkFlags
+	fs.Var(&links, "link", "Add a link to another entry as type:slug (repeatable; types: "+strings.Join(db.LinkTypes, ", ")+")")
+	fs.Var(&unlinks, "unlink", "Remove a link to another entry, given as type:slug (repeatable)")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
@@ -242,6 +502,12 @@ func cmdEdit(args []string) {
 		fs.Usage()
 		os.Exit(1)
 	}
+	if err := links.validate(); err != nil {
+		fatal("%v", err)
+	}
+	if err := unlinks.validate(); err != nil {
+		fatal("%v", err)
+	}
 
 	d, err := db.Open(path)
 	if err != nil {
@@ -268,6 +534,10 @@ func cmdEdit(args []string) {
 			fields["description"] = *description
 		case "tags":
 			fields["tags"] = parseTags(*tags)
+		case "review-after":
+			fields["review_after"] = *reviewAfter
+		case "expires":
+			fields["expires_at"] = *expires
 		case "file":
 			content, err := os.ReadFile(*file)
 			if err != nil {
@@ -277,16 +547,34 @@ func cmdEdit(args []string) {
 		}
 	})
 
-	if len(fields) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: no fields to update. Provide at least one field flag.")
+	if len(fields) == 0 && len(links) == 0 && len(unlinks) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no fields to update. Provide at least one field, --link, or --unlink flag.")
 		os.Exit(1)
 	}
 
-	if err := d.UpdateEntry(context.Background(), *slug, fields); err != nil {
-		fatal("update: %v", err)
+	ctx := context.Background()
+	if err := links.checkTargets(ctx, d, *slug); err != nil {
+		fatal("%v", err)
+	}
+	if len(fields) > 0 {
+		if err := d.UpdateEntry(ctx, *slug, *ifVersion, fields); err != nil {
+			fatal("update: %v", err)
+		}
+	} else if *ifVersion != 0 {
+		// Links are not versioned; still refuse to edit an entry that changed
+		e, err := d.GetEntryMeta(ctx, *slug)
+		if err != nil {
+			fatal("update: %v", err)
+		}
+		if e.Version != *ifVersion {
+			fatal("update: %s is at version %d, not %d: %v", *slug, e.Version, *ifVersion, db.ErrConflict)
+		}
+	}
+	if err := applyLinks(ctx, d, *slug, links, unlinks); err != nil {
+		fatal("%v", err)
 	}
 
-	entry, err := d.GetEntry(context.Background(), *slug)
+	entry, err := d.GetEntry(ctx, *slug)
 	if err != nil {
 		fatal("get: %v", err)
 	}
@@ -297,6 +585,84 @@ func cmdEdit(args []string) {
 		fmt.Printf("  Tags: %s\n", strings.Join(entry.Tags, ", "))
 	}
 	fmt.Printf("  Version: %d  Content: %d bytes\n", entry.Version, len(entry.Content))
+	printReviewDates(entry)
+	printLinks(ctx, d, entry.Slug)
+}
+
+// linkFlags collects repeatable type:slug link flags.
+type linkFlags []string
+
+func (l *linkFlags) String() string { return strings.Join(*l, ",") }
+
+func (l *linkFlags) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func (l linkFlags) validate() error {
+	for _, v := range l {
+		if _, _, err := parseLink(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTargets verifies that every link from slug can be added: the target
+// exists and is another entry. Types are checked by validate.
+func (l linkFlags) checkTargets(ctx context.Context, d *db.DB, slug string) error {
+	for _, v := range l {
+		_, to, _ := parseLink(v)
+		if to == slug {
+			return fmt.Errorf("invalid link %q: cannot link entry %s to itself", v, slug)
+		}
+		if _, err := d.GetEntryMeta(ctx, to); err != nil {
+			return fmt.Errorf("invalid link %q: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// parseLink splits a type:slug link flag value.
+func parseLink(v string) (linkType, slug string, err error) {
+	linkType, slug, ok := strings.Cut(v, ":")
+	if !ok || slug == "" {
+		return "", "", fmt.Errorf("invalid link %q: want type:slug", v)
+	}
+	if !db.ValidLinkType(linkType) {
+		return "", "", fmt.Errorf("invalid link %q: type must be one of %s", v, strings.Join(db.LinkTypes, ", "))
+	}
+	return linkType, slug, nil
+}
+
+func applyLinks(ctx context.Context, d *db.DB, slug string, add, remove linkFlags) error {
+	for _, v := range remove {
+		linkType, to, _ := parseLink(v)
+		if err := d.RemoveLink(ctx, slug, to, linkType); err != nil {
+			return fmt.Errorf("unlink: %w", err)
+		}
+	}
+	for _, v := range add {
+		linkType, to, _ := parseLink(v)
+		if err := d.AddLink(ctx, slug, to, linkType); err != nil {
+			return fmt.Errorf("link: %w", err)
+		}
+	}
+	return nil
+}
+
+func printLinks(ctx context.Context, d *db.DB, slug string) {
+	links, err := d.ListLinks(ctx, slug)
+	if err != nil {
+		fatal("links: %v", err)
+	}
+	for _, l := range links {
+		if l.From == slug {
+			fmt.Printf("  Link: %s -> %s\n", l.Type, l.To)
+		} else {
+			fmt.Printf("  Link: %s <- %s\n", l.Type, l.From)
+		}
+	}
 }
 
 // --- list ---
@@ -309,6 +675,7 @@ func cmdList(args []string) {
 	domain := fs.String("domain", "", "Filter by domain")
 	project := fs.String("project", "", "Filter by project")
 	tag := fs.String("tag", "", "Filter by tag")
+	includeProposed := fs.Bool("include-proposed", false, "Also list draft and proposed entries")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
@@ -319,15 +686,25 @@ func cmdList(args []string) {
 	}
 	defer d.Close()
 
-	entries, err := d.ListEntries(context.Background(), db.Filter{
-		Kind:     *kind,
-		Language: *language,
-		Domain:   *domain,
-		Project:  *project,
-		Tag:      *tag,
-	})
-	if err != nil {
-		fatal("list: %v", err)
+	f := db.Filter{
+		Kind:              *kind,
+		Language:          *language,
+		Domain:            *domain,
+		Project:           *project,
+		Tag:               *tag,
+		IncludeUnapproved: *includeProposed,
+	}
+	var entries []db.Entry
+	for page := (db.Page{Limit: 200}); ; {
+		result, err := d.ListEntries(context.Background(), f, page)
+		if err != nil {
+			fatal("list: %v", err)
+		}
+		entries = append(entries, result.Entries...)
+		if result.NextCursor == "" {
+			break
+		}
+		page.Cursor = result.NextCursor
 	}
 
 	if len(entries) == 0 {
@@ -336,25 +713,105 @@ func cmdList(args []string) {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "SLUG\tTITLE\tKIND\tLANGUAGE\tDOMAIN\tVERSION")
+	fmt.Fprintln(w, "SLUG\tTITLE\tKIND\tLANGUAGE\tDOMAIN\tVERSION\tSTATUS")
 	for _, e := range entries {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", e.Slug, e.Title, e.Kind, e.Language, e.Domain, e.Version)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", e.Slug, e.Title, e.Kind, e.Language, e.Domain, e.Version, e.Status)
 	}
 	w.Flush()
 	fmt.Printf("\n%d entries\n", len(entries))
 }
 
+// --- search ---
+
+func cmdSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	mode := fs.String("mode", db.SearchKeyword, "Search mode: "+strings.Join(db.SearchModes, ", "))
+	limit := fs.Int("limit", 10, "Max results (max 50)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: mcpedia search [flags] <query>
+
+Query syntax:
+  error handling         entries containing both words
+  "error handling"       the exact phrase
+  title:result           the word in the title only (also title:"a phrase")
+  handl*                 words starting with a prefix
+  panic OR unwrap        either word
+  -unsafe                entries not containing the word (also -"a phrase", -tag:x)
+  tag:rust kind:skill    filters; also lang:, domain:, project:
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		fmt.Fprintln(os.Stderr, "Error: a query is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	page := db.Page{Limit: *limit}
+	var result *db.EntryPage
+	switch *mode {
+	case db.SearchKeyword:
+		result, err = d.SearchEntries(ctx, query, db.Filter{}, page)
+	case db.SearchSemantic:
+		result, err = d.SemanticSearch(ctx, query, db.Filter{}, page)
+	case db.SearchHybrid:
+		result, err = d.HybridSearch(ctx, query, db.Filter{}, page)
+	default:
+		fatal("--mode must be one of: %s", strings.Join(db.SearchModes, ", "))
+	}
+	if err != nil {
+		fatal("search: %v", err)
+	}
+
+	if len(result.Entries) == 0 {
+		fmt.Println("No entries found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tTITLE\tKIND\tLANGUAGE\tSNIPPET")
+	for _, e := range result.Entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Slug, e.Title, e.Kind, e.Language, strings.Join(strings.Fields(e.Snippet), " "))
+	}
+	w.Flush()
+	if result.Total > len(result.Entries) {
+		fmt.Printf("\n%d of %d entries\n", len(result.Entries), result.Total)
+	} else {
+		fmt.Printf("\n%d entries\n", len(result.Entries))
+	}
+}
+
 // --- lock ---
 
 func cmdLock(args []string) {
 	fs := flag.NewFlagSet("lock", flag.ExitOnError)
 	dbPath := fs.String("db", "", "Database path")
 	token := fs.String("token", "", "Lock token (required)")
+	spec := lockScopeFlags(fs)
+	reason := fs.String("reason", "", "Why the lock is taken, shown to agents whose writes it rejects")
+	duration := fs.Duration("for", 0, "Lift the lock automatically after this long, e.g. 2h (0 = until unlocked)")
+	list := fs.Bool("list", false, "List the active locks instead of locking")
+	history := fs.Bool("history", false, "Show the lock history instead of locking")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
 
-	if *token == "" {
+	if *token == "" && !*list && !*history {
 		fmt.Fprintln(os.Stderr, "Error: --token is required")
 		os.Exit(1)
 	}
@@ -365,10 +822,63 @@ func cmdLock(args []string) {
 	}
 	defer d.Close()
 
-	if err := d.Lock(context.Background(), *token); err != nil {
+	if *list {
+		locks, err := d.Locks(context.Background())
+		if err != nil {
+			fatal("lock: %v", err)
+		}
+		if len(locks) == 0 {
+			fmt.Println("Database is not locked.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SCOPE\tSINCE\tEXPIRES\tREASON")
+		for _, l := range locks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.LockSpec, l.Since, l.ExpiresAt, l.Reason)
+		}
+		w.Flush()
+		fmt.Printf("\n%d locks\n", len(locks))
+		return
+	}
+	if *history {
+		events, err := d.LockHistory(context.Background(), 50)
+		if err != nil {
+			fatal("lock: %v", err)
+		}
+		if len(events) == 0 {
+			fmt.Println("No lock history.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "AT\tEVENT\tSCOPE\tEXPIRES\tREASON")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.At, e.Event, e.LockSpec, e.ExpiresAt, e.Reason)
+		}
+		w.Flush()
+		fmt.Printf("\n%d events\n", len(events))
+		return
+	}
+
+	if err := d.LockScope(context.Background(), *spec, *token, db.LockOptions{Reason: *reason, For: *duration}); err != nil {
 		fatal("lock: %v", err)
 	}
-	fmt.Println("Database locked. AI write operations are now disabled.")
+	if spec.IsGlobal() {
+		fmt.Println("Database locked. AI write operations are now disabled.")
+	} else {
+		fmt.Printf("Locked: entries with %s. AI write operations on them are now disabled.\n", spec)
+	}
+	if *duration > 0 {
+		fmt.Printf("The lock expires in %s.\n", *duration)
+	}
+}
+
+// lockScopeFlags registers the --project, --kind and --tag flags of lock and unlock.
+func lockScopeFlags(fs *flag.FlagSet) *db.LockSpec {
+	spec := &db.LockSpec{}
+	fs.StringVar(&spec.Project, "project", "", "Lock scope: entries of this project")
+	fs.StringVar(&spec.Kind, "kind", "", "Lock scope: entries of this kind")
+	fs.StringVar(&spec.Tag, "tag", "", "Lock scope: entries with this tag")
+	return spec
 }
 
 // --- unlock ---
@@ -377,6 +887,7 @@ func cmdUnlock(args []string) {
 	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
 	dbPath := fs.String("db", "", "Database path")
 	token := fs.String("token", "", "Lock token (required, must match the token used to lock)")
+	spec := lockScopeFlags(fs)
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
@@ -392,18 +903,40 @@ func cmdUnlock(args []string) {
 	}
 	defer d.Close()
 
-	if err := d.Unlock(context.Background(), *token); err != nil {
+	if err := d.UnlockScope(context.Background(), *spec, *token); err != nil {
 		fatal("unlock: %v", err)
 	}
-	fmt.Println("Database unlocked. AI write operations are now enabled.")
+	if spec.IsGlobal() {
+		fmt.Println("Database unlocked. AI write operations are now enabled.")
+	} else {
+		fmt.Printf("Unlocked: entries with %s.\n", spec)
+	}
 }
 
-// --- export ---
+// --- trash ---
 
-func cmdExport(args []string) {
-	fs := flag.NewFlagSet("export", flag.ExitOnError)
+func cmdTrash(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: mcpedia trash <list|restore|purge> [flags]")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "list":
+		cmdTrashList(args[1:])
+	case "restore":
+		cmdTrashRestore(args[1:])
+	case "purge":
+		cmdTrashPurge(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown trash command: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, "Usage: mcpedia trash <list|restore|purge> [flags]")
+		os.Exit(1)
+	}
+}
+
+func cmdTrashList(args []string) {
+	fs := flag.NewFlagSet("trash list", flag.ExitOnError)
 	dbPath := fs.String("db", "", "Database path")
-	out := fs.String("out", "export", "Output directory")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
@@ -414,74 +947,105 @@ func cmdExport(args []string) {
 	}
 	defer d.Close()
 
-	entries, err := d.AllEntries(context.Background())
+	entries, err := d.ListTrash(context.Background())
 	if err != nil {
-		fatal("export: %v", err)
+		fatal("trash: %v", err)
 	}
-
 	if len(entries) == 0 {
-		fmt.Println("No entries to export.")
+		fmt.Println("Trash is empty.")
 		return
 	}
 
-	if err := os.MkdirAll(*out, 0o755); err != nil {
-		fatal("mkdir: %v", err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tTITLE\tKIND\tVERSION\tDELETED")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", e.Slug, e.Title, e.Kind, e.Version, e.DeletedAt)
 	}
+	w.Flush()
+	fmt.Printf("\n%d entries in trash\n", len(entries))
+}
 
-	for _, e := range entries {
-		filename := filepath.Join(*out, e.Slug+".md")
+func cmdTrashRestore(args []string) {
+	fs := flag.NewFlagSet("trash restore", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the deleted entry (required)")
+	fs.Parse(args)
 
-		var sb strings.Builder
-		sb.WriteString("---\n")
-		sb.WriteString(fmt.Sprintf("title: %q\n", e.Title))
-		sb.WriteString(fmt.Sprintf("kind: %s\n", e.Kind))
-		sb.WriteString(fmt.Sprintf("language: %s\n", e.Language))
-		sb.WriteString(fmt.Sprintf("domain: %s\n", e.Domain))
-		sb.WriteString(fmt.Sprintf("project: %s\n", e.Project))
-		if len(e.Tags) > 0 {
-			sb.WriteString(fmt.Sprintf("tags: [%s]\n", strings.Join(e.Tags, ", ")))
-		} else {
-			sb.WriteString("tags: []\n")
-		}
-		if e.Description != "" {
-			sb.WriteString(fmt.Sprintf("description: %q\n", e.Description))
-		}
-		sb.WriteString("---\n\n")
-		sb.WriteString(e.Content)
-		sb.WriteString("\n")
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
 
-		if err := os.WriteFile(filename, []byte(sb.String()), 0o644); err != nil {
-			fatal("write %s: %v", filename, err)
-		}
-		fmt.Printf("Exported: %s\n", filename)
+	if *slug == "" {
+		fmt.Fprintln(os.Stderr, "Error: --slug is required")
+		fs.Usage()
+		os.Exit(1)
 	}
-	fmt.Printf("\n%d entries exported to %s/\n", len(entries), *out)
-}
 
-// --- import ---
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
 
-func cmdImport(args []string) {
-	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	if err := d.RestoreEntry(context.Background(), *slug); err != nil {
+		fatal("restore: %v", err)
+	}
+	fmt.Printf("Entry restored from trash: %s\n", *slug)
+}
+
+func cmdTrashPurge(args []string) {
+	fs := flag.NewFlagSet("trash purge", flag.ExitOnError)
 	dbPath := fs.String("db", "", "Database path")
-	file := fs.String("file", "", "Path to export-format markdown file (required)")
+	slug := fs.String("slug", "", "Purge only this entry")
+	olderThan := fs.Duration("older-than", 0, "Purge entries deleted longer ago than this (0 = all)")
 	fs.Parse(args)
 
 	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
 
-	if *file == "" {
-		fmt.Fprintln(os.Stderr, "Error: --file is required")
+	olderThanSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "older-than" {
+			olderThanSet = true
+		}
+	})
+	if *slug == "" && !olderThanSet {
+		fmt.Fprintln(os.Stderr, "Error: --slug or --older-than is required (use --older-than 0 to empty the trash)")
 		fs.Usage()
 		os.Exit(1)
 	}
 
-	content, err := os.ReadFile(*file)
+	d, err := db.Open(path)
 	if err != nil {
-		fatal("read file: %v", err)
+		fatal("open db: %v", err)
 	}
+	defer d.Close()
 
-	e, err := importfm.ParseImportFile(content, *file)
+	if *slug != "" {
+		if err := d.PurgeEntry(context.Background(), *slug); err != nil {
+			fatal("purge: %v", err)
+		}
+		fmt.Printf("Entry purged: %s\n", *slug)
+		return
+	}
+	n, err := d.PurgeTrash(context.Background(), *olderThan)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fatal("purge: %v", err)
+	}
+	fmt.Printf("%d entries purged\n", n)
+}
+
+// --- history ---
+
+func cmdHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the entry (required)")
+	version := fs.Int("version", 0, "Print the content of this version")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *slug == "" {
+		fmt.Fprintln(os.Stderr, "Error: --slug is required")
+		fs.Usage()
 		os.Exit(1)
 	}
 
@@ -491,9 +1055,746 @@ func cmdImport(args []string) {
 	}
 	defer d.Close()
 
-	if err := d.CreateEntry(context.Background(), e); err != nil {
-		if strings.Contains(err.Error(), "UNIQUE") {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if *version > 0 {
+		rev, err := d.GetRevision(context.Background(), *slug, *version)
+		if err != nil {
+			fatal("history: %v", err)
+		}
+		fmt.Printf("Revision: %s version %d (%s)\n", *slug, rev.Version, rev.Title)
+		fmt.Printf("  Kind: %s  Language: %s  Domain: %s  Project: %s\n", rev.Kind, rev.Language, rev.Domain, rev.Project)
+		if len(rev.Tags) > 0 {
+			fmt.Printf("  Tags: %s\n", strings.Join(rev.Tags, ", "))
+		}
+		if rev.ReviewAfter != "" || rev.ExpiresAt != "" {
+			fmt.Printf("  Review after: %s  Expires: %s\n", cmp.Or(rev.ReviewAfter, "-"), cmp.Or(rev.ExpiresAt, "-"))
+		}
+		fmt.Printf("  Updated: %s  Archived: %s\n\n", rev.UpdatedAt, rev.ArchivedAt)
+		fmt.Println(rev.Content)
+		return
+	}
+
+	revisions, err := d.ListRevisions(context.Background(), *slug)
+	if err != nil {
+		fatal("history: %v", err)
+	}
+	if len(revisions) == 0 {
+		fmt.Println("No prior versions.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tTITLE\tUPDATED\tARCHIVED")
+	for _, r := range revisions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", r.Version, r.Title, r.UpdatedAt, r.ArchivedAt)
+	}
+	w.Flush()
+	fmt.Printf("\n%d revisions\n", len(revisions))
+}
+
+// --- restore ---
+
+func cmdRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the entry (required)")
+	version := fs.Int("version", 0, "Version to restore (required)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *slug == "" || *version <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --slug and --version are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	if err := d.RestoreRevision(context.Background(), *slug, *version); err != nil {
+		fatal("restore: %v", err)
+	}
+
+	entry, err := d.GetEntry(context.Background(), *slug)
+	if err != nil {
+		fatal("get: %v", err)
+	}
+	fmt.Printf("Entry restored: %s (%s) from version %d\n", entry.Slug, entry.Title, *version)
+	fmt.Printf("  Version: %d  Content: %d bytes\n", entry.Version, len(entry.Content))
+}
+
+// --- dangling ---
+
+func cmdDangling(args []string) {
+	fs := flag.NewFlagSet("dangling", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	refs, err := d.DanglingRefs(context.Background())
+	if err != nil {
+		fatal("dangling: %v", err)
+	}
+	if len(refs) == 0 {
+		fmt.Println("No dangling references.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tMISSING TARGET")
+	for _, r := range refs {
+		fmt.Fprintf(w, "%s\t%s\n", r.Slug, r.Target)
+	}
+	w.Flush()
+	fmt.Printf("\n%d dangling references\n", len(refs))
+}
+
+// --- stale ---
+
+func cmdStale(args []string) {
+	fs := flag.NewFlagSet("stale", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	entries, err := d.StaleEntries(context.Background())
+	if err != nil {
+		fatal("stale: %v", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No entries due for review or expired.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tSTATUS\tREVIEW AFTER\tEXPIRES\tUPDATED\tTITLE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Slug, e.Stale, e.ReviewAfter, e.ExpiresAt, e.UpdatedAt, e.Title)
+	}
+	w.Flush()
+	fmt.Printf("\n%d stale entries\n", len(entries))
+}
+
+// printReviewDates prints the review and expiry dates of an entry, if set.
+func printReviewDates(e *db.Entry) {
+	if e.ReviewAfter == "" && e.ExpiresAt == "" {
+		return
+	}
+	fmt.Printf("  Review after: %s  Expires: %s\n", cmp.Or(e.ReviewAfter, "-"), cmp.Or(e.ExpiresAt, "-"))
+}
+
+// --- audit ---
+
+func cmdAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	since := fs.String("since", "", "Only show changes since a time ago (e.g. 24h) or a UTC date (YYYY-MM-DD[ HH:MM:SS])")
+	slug := fs.String("slug", "", "Only show changes to this entry")
+	asJSON := fs.Bool("json", false, "Print the changes as JSON")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	f := db.AuditFilter{Slug: *slug}
+	if *since != "" {
+		t, err := parseSince(*since)
+		if err != nil {
+			fatal("audit: %v", err)
+		}
+		f.Since = t.UTC().Format(time.DateTime)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	events, err := d.AuditLog(context.Background(), f)
+	if err != nil {
+		fatal("audit: %v", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if events == nil {
+			events = []db.AuditEvent{}
+		}
+		if err := enc.Encode(events); err != nil {
+			fatal("audit: %v", err)
+		}
+		return
+	}
+	if len(events) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tOPERATION\tSLUG\tDETAIL\tBEFORE\tAFTER\tTOKEN\tCLIENT\tSESSION")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.At, e.Operation, e.Slug, e.Detail,
+			shortHash(e.BeforeHash), shortHash(e.AfterHash), e.Token, e.Client, e.Session)
+	}
+	w.Flush()
+	fmt.Printf("\n%d changes\n", len(events))
+}
+
+// parseSince parses --since: a duration back from now, or a UTC date with
+// an optional time.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a duration such as 24h or a date such as 2006-01-02", s)
+}
+
+// shortHash abbreviates a content hash for tables, like git does commit ids.
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+// --- review ---
+
+func cmdReview(args []string) {
+	const usage = "Usage: mcpedia review <list|diff|approve|reject> [flags]"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "list":
+		cmdReviewList(args[1:])
+	case "diff":
+		cmdReviewDiff(args[1:])
+	case "approve":
+		cmdReviewDecide("approve", args[1:])
+	case "reject":
+		cmdReviewDecide("reject", args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown review command: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func cmdReviewList(args []string) {
+	fs := flag.NewFlagSet("review list", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	queue, err := d.ReviewQueue(context.Background())
+	if err != nil {
+		fatal("review: %v", err)
+	}
+	if len(queue) == 0 {
+		fmt.Println("No changes awaiting review.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tCHANGE\tSTATUS\tFIELDS\tBASE VERSION\tPROPOSED\tTOKEN\tCLIENT")
+	for _, p := range queue {
+		fields := slices.Sorted(maps.Keys(p.Fields))
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", p.Slug, p.Operation, p.Status,
+			cmp.Or(strings.Join(fields, ","), "-"), p.BaseVersion, p.CreatedAt, p.Token, p.Client)
+	}
+	w.Flush()
+	fmt.Printf("\n%d changes awaiting review\n", len(queue))
+}
+
+func cmdReviewDiff(args []string) {
+	fs := flag.NewFlagSet("review diff", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the entry to review (required)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *slug == "" {
+		fmt.Fprintln(os.Stderr, "Error: --slug is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	p, err := d.GetProposal(ctx, *slug)
+	if err != nil {
+		fatal("review: %v", err)
+	}
+	e, err := d.GetEntry(ctx, *slug)
+	if err != nil {
+		fatal("review: %v", err)
+	}
+
+	fmt.Printf("Proposed %s of %s (%s)", p.Operation, p.Slug, e.Title)
+	if p.Operation != db.OpCreate {
+		fmt.Printf(" against version %d", p.BaseVersion)
+	}
+	if p.Token != "" || p.Client != "" {
+		fmt.Printf(" by %s", strings.TrimSpace(p.Token+" "+p.Client))
+	}
+	fmt.Printf(" at %s\n", p.CreatedAt)
+	if p.Operation == db.OpUpdate && e.Version != p.BaseVersion {
+		fmt.Printf("Warning: the entry is now at version %d; approving will fail unless forced\n", e.Version)
+	}
+	fmt.Println()
+
+	before, after := e, p.Apply(e)
+	if p.Operation == db.OpCreate {
+		before = &db.Entry{}
+	}
+	if after == nil {
+		after = &db.Entry{}
+	}
+	for _, f := range []struct{ name, old, new string }{
+		{"title", before.Title, after.Title},
+		{"description", before.Description, after.Description},
+		{"kind", before.Kind, after.Kind},
+		{"language", before.Language, after.Language},
+		{"domain", before.Domain, after.Domain},
+		{"project", before.Project, after.Project},
+		{"tags", strings.Join(before.Tags, ", "), strings.Join(after.Tags, ", ")},
+		{"review_after", before.ReviewAfter, after.ReviewAfter},
+		{"expires_at", before.ExpiresAt, after.ExpiresAt},
+	} {
+		if f.old != f.new {
+			fmt.Printf("%s: %q -> %q\n", f.name, f.old, f.new)
+		}
+	}
+	if out := diff.Unified(before.Content, after.Content, "current", "proposed", 3); out != "" {
+		fmt.Printf("\n%s", out)
+	}
+}
+
+// cmdReviewDecide approves or rejects the change of an entry awaiting review.
+func cmdReviewDecide(decision string, args []string) {
+	fs := flag.NewFlagSet("review "+decision, flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the entry to review (required)")
+	var force *bool
+	if decision == "approve" {
+		force = fs.Bool("force", false, "Apply a proposed change even if the entry changed since it was proposed")
+	}
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *slug == "" {
+		fmt.Fprintln(os.Stderr, "Error: --slug is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	if decision == "approve" {
+		if err := d.Approve(ctx, *slug, *force); err != nil {
+			if errors.Is(err, db.ErrConflict) {
+				fatal("approve: %v (see 'mcpedia review diff --slug %s', then reject or approve with --force)", err, *slug)
+			}
+			fatal("approve: %v", err)
+		}
+		fmt.Printf("Change approved: %s\n", *slug)
+		return
+	}
+	if err := d.Reject(ctx, *slug); err != nil {
+		fatal("reject: %v", err)
+	}
+	fmt.Printf("Change rejected: %s\n", *slug)
+}
+
+// --- token ---
+
+func cmdToken(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: mcpedia token <create|list|revoke> [flags]")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "create":
+		cmdTokenCreate(args[1:])
+	case "list":
+		cmdTokenList(args[1:])
+	case "revoke":
+		cmdTokenRevoke(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown token command: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, "Usage: mcpedia token <create|list|revoke> [flags]")
+		os.Exit(1)
+	}
+}
+
+func cmdTokenCreate(args []string) {
+	fs := flag.NewFlagSet("token create", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	name := fs.String("name", "", "Token name, e.g. the agent using it (required)")
+	role := fs.String("role", db.RoleRead, "Role: read, write, or admin")
+	project := fs.String("project", "", "Only allow writes to entries of this project (write role)")
+	kind := fs.String("kind", "", "Only allow writes to entries of this kind (write role)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "Error: --name is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	secret, t, err := d.CreateToken(context.Background(), *name, *role, *project, *kind)
+	if err != nil {
+		fatal("token: %v", err)
+	}
+	fmt.Printf("Token created: %s (%s", t.Name, t.Role)
+	if scope := t.Scope(); scope != "" {
+		fmt.Printf(", %s", scope)
+	}
+	fmt.Println(")")
+	fmt.Printf("\n  %s\n\n", secret)
+	fmt.Println("Store it now: it cannot be shown again. Send it as 'Authorization: Bearer <token>'.")
+}
+
+func cmdTokenList(args []string) {
+	fs := flag.NewFlagSet("token list", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	tokens, err := d.ListTokens(context.Background())
+	if err != nil {
+		fatal("token: %v", err)
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No tokens.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLE\tPROJECT\tKIND\tCREATED\tREVOKED")
+	for _, t := range tokens {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, t.Role, t.Project, t.Kind, t.CreatedAt, t.RevokedAt)
+	}
+	w.Flush()
+	fmt.Printf("\n%d tokens\n", len(tokens))
+}
+
+func cmdTokenRevoke(args []string) {
+	fs := flag.NewFlagSet("token revoke", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	name := fs.String("name", "", "Token name (required)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "Error: --name is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	if err := d.RevokeToken(context.Background(), *name); err != nil {
+		fatal("token: %v", err)
+	}
+	fmt.Printf("Token revoked: %s\n", *name)
+}
+
+// --- attach / detach ---
+
+func cmdAttach(args []string) {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the entry (required)")
+	file := fs.String("file", "", "Path to the file to attach (required)")
+	name := fs.String("name", "", "Attachment name (default: the file name)")
+	mimeType := fs.String("mime", "", "MIME type (default: detected from the name, then the content)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *slug == "" || *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: --slug and --file are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *name == "" {
+		*name = filepath.Base(*file)
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		fatal("read file: %v", err)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	a := &db.Attachment{Name: *name, MIMEType: *mimeType, Data: data}
+	if err := d.PutAttachment(ctx, *slug, a); err != nil {
+		fatal("attach: %v", err)
+	}
+	fmt.Printf("Attached: %s to %s (%s, %d bytes)\n", a.Name, *slug, a.MIMEType, a.Size)
+	printAttachments(ctx, d, *slug)
+}
+
+func cmdDetach(args []string) {
+	fs := flag.NewFlagSet("detach", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	slug := fs.String("slug", "", "Slug of the entry (required)")
+	name := fs.String("name", "", "Attachment name (required)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *slug == "" || *name == "" {
+		fmt.Fprintln(os.Stderr, "Error: --slug and --name are required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	if err := d.DeleteAttachment(ctx, *slug, *name); err != nil {
+		fatal("detach: %v", err)
+	}
+	fmt.Printf("Detached: %s from %s\n", *name, *slug)
+	printAttachments(ctx, d, *slug)
+}
+
+// printAttachments lists the remaining attachments of an entry, if any.
+func printAttachments(ctx context.Context, d *db.DB, slug string) {
+	attachments, err := d.ListAttachments(ctx, slug)
+	if err != nil {
+		fatal("list attachments: %v", err)
+	}
+	if len(attachments) == 0 {
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMIME TYPE\tSIZE\tADDED")
+	for _, a := range attachments {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", a.Name, a.MIMEType, a.Size, a.CreatedAt)
+	}
+	w.Flush()
+	fmt.Printf("\n%d attachments\n", len(attachments))
+}
+
+// --- export ---
+
+func cmdExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	out := fs.String("out", "export", "Output directory")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	ctx := context.Background()
+	entries, err := d.AllEntries(ctx)
+	if err != nil {
+		fatal("export: %v", err)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No entries to export.")
+		return
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fatal("mkdir: %v", err)
+	}
+
+	for _, e := range entries {
+		filename := filepath.Join(*out, e.Slug+".md")
+		attachments, err := d.ListAttachments(ctx, e.Slug)
+		if err != nil {
+			fatal("export %s: %v", e.Slug, err)
+		}
+
+		var sb strings.Builder
+		sb.WriteString("---\n")
+		sb.WriteString(fmt.Sprintf("title: %q\n", e.Title))
+		sb.WriteString(fmt.Sprintf("kind: %s\n", e.Kind))
+		sb.WriteString(fmt.Sprintf("language: %s\n", e.Language))
+		sb.WriteString(fmt.Sprintf("domain: %s\n", e.Domain))
+		sb.WriteString(fmt.Sprintf("project: %s\n", e.Project))
+		if len(e.Tags) > 0 {
+			sb.WriteString(fmt.Sprintf("tags: [%s]\n", strings.Join(e.Tags, ", ")))
+		} else {
+			sb.WriteString("tags: []\n")
+		}
+		if e.Description != "" {
+			sb.WriteString(fmt.Sprintf("description: %q\n", e.Description))
+		}
+		if e.ReviewAfter != "" {
+			sb.WriteString(fmt.Sprintf("review_after: %s\n", e.ReviewAfter))
+		}
+		if e.ExpiresAt != "" {
+			sb.WriteString(fmt.Sprintf("expires_at: %s\n", e.ExpiresAt))
+		}
+		if e.Status != db.StatusApproved {
+			sb.WriteString(fmt.Sprintf("status: %s\n", e.Status))
+		}
+		if len(attachments) > 0 {
+			items := make([]string, len(attachments))
+			for i, a := range attachments {
+				items[i] = a.Name + ":" + a.MIMEType
+			}
+			sb.WriteString(fmt.Sprintf("attachments: [%s]\n", strings.Join(items, ", ")))
+		}
+		sb.WriteString("---\n\n")
+		sb.WriteString(e.Content)
+		sb.WriteString("\n")
+
+		if err := os.WriteFile(filename, []byte(sb.String()), 0o644); err != nil {
+			fatal("write %s: %v", filename, err)
+		}
+		if err := exportAttachments(ctx, d, e.Slug, attachments, importfm.AttachmentsDir(filename)); err != nil {
+			fatal("export %s: %v", e.Slug, err)
+		}
+		fmt.Printf("Exported: %s\n", filename)
+	}
+	fmt.Printf("\n%d entries exported to %s/\n", len(entries), *out)
+}
+
+// exportAttachments writes the attachments of an entry as files in dir.
+func exportAttachments(ctx context.Context, d *db.DB, slug string, attachments []db.Attachment, dir string) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, meta := range attachments {
+		a, err := d.GetAttachment(ctx, slug, meta.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, a.Name), a.Data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- import ---
+
+func cmdImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Database path")
+	file := fs.String("file", "", "Path to export-format markdown file (required)")
+	fs.Parse(args)
+
+	path := resolve(*dbPath, "MCPEDIA_DB", defaultDB)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: --file is required")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		fatal("read file: %v", err)
+	}
+
+	e, err := importfm.ParseImportFile(content, *file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := importfm.ReadAttachments(e, *file); err != nil {
+		fatal("%v", err)
+	}
+
+	d, err := db.Open(path)
+	if err != nil {
+		fatal("open db: %v", err)
+	}
+	defer d.Close()
+
+	if err := d.CreateEntry(context.Background(), e); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			fmt.Fprintln(os.Stderr, "Entry already exists. Remove it and retry if you want to replace it.")
 		} else {
 			fatal("create: %v", err)
@@ -507,6 +1808,9 @@ func cmdImport(args []string) {
 		fmt.Printf("  Tags: %s\n", strings.Join(e.Tags, ", "))
 	}
 	fmt.Printf("  Content: %d bytes\n", len(e.Content))
+	if len(e.Attachments) > 0 {
+		fmt.Printf("  Attachments: %d\n", len(e.Attachments))
+	}
 }
 
 // --- helpers ---
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+)
+
+const (
+	// MaxAttachmentSize is the largest single attachment accepted.
+	MaxAttachmentSize = 1 << 20
+	// MaxEntryAttachmentsSize bounds the total size of one entry's attachments.
+	MaxEntryAttachmentsSize = 8 << 20
+)
+
+// ErrAttachmentTooLarge is returned when an attachment is over
+// MaxAttachmentSize, or would take its entry over MaxEntryAttachmentsSize.
+var ErrAttachmentTooLarge = errors.New("attachment too large")
+
+// attachmentNameRe matches attachment names: safe as a file name and in a resource URI.
+var attachmentNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Attachment is a file attached to an entry. Data is only loaded by
+// GetAttachment, and is set by callers of PutAttachment and CreateEntry.
+type Attachment struct {
+	Name      string `json:"name"`
+	MIMEType  string `json:"mime_type"`
+	Size      int    `json:"size"`
+	CreatedAt string `json:"created_at,omitempty"`
+	Data      []byte `json:"-"`
+}
+
+// ValidAttachmentName reports whether name can be used for an attachment:
+// letters, digits, dots, underscores and hyphens, not starting with a symbol.
+func ValidAttachmentName(name string) bool {
+	return attachmentNameRe.MatchString(name)
+}
+
+// PutAttachment attaches a file to an entry, replacing any attachment with
+// the same name. An empty MIMEType is detected from the name, then the data.
+func (d *DB) PutAttachment(ctx context.Context, slug string, a *Attachment) error {
+	defer d.cache.clear()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	entryID, err := lookupEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	before, err := attachmentHash(ctx, tx, entryID, a.Name)
+	if err != nil {
+		return err
+	}
+	if err := putAttachment(ctx, tx, entryID, a); err != nil {
+		return err
+	}
+	if err := audit(ctx, tx, OpAttach, slug, a.Name, before, contentHash(a.Data)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// attachmentHash returns the content hash of an attachment, or "" if the
+// entry has no attachment with that name.
+func attachmentHash(ctx context.Context, tx *sql.Tx, entryID int64, name string) (string, error) {
+	var data []byte
+	err := tx.QueryRowContext(ctx, `SELECT data FROM entry_attachments WHERE entry_id = ? AND name = ?`, entryID, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("get attachment: %w", err)
+	}
+	return contentHash(data), nil
+}
+
+// putAttachment validates and stores an attachment within a transaction.
+func putAttachment(ctx context.Context, tx *sql.Tx, entryID int64, a *Attachment) error {
+	if !ValidAttachmentName(a.Name) {
+		return fmt.Errorf("invalid attachment name %q: use letters, digits, '.', '_' and '-'", a.Name)
+	}
+	if len(a.Data) > MaxAttachmentSize {
+		return fmt.Errorf("%w: %s is %d bytes, max %d", ErrAttachmentTooLarge, a.Name, len(a.Data), MaxAttachmentSize)
+	}
+	var others int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(length(data)), 0) FROM entry_attachments WHERE entry_id = ? AND name != ?`, entryID, a.Name,
+	).Scan(&others); err != nil {
+		return fmt.Errorf("attachments size: %w", err)
+	}
+	if others+len(a.Data) > MaxEntryAttachmentsSize {
+		return fmt.Errorf("%w: attachments of an entry may total at most %d bytes", ErrAttachmentTooLarge, MaxEntryAttachmentsSize)
+	}
+	if a.MIMEType == "" {
+		a.MIMEType = detectMIMEType(a.Name, a.Data)
+	}
+	a.Size = len(a.Data)
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO entry_attachments (entry_id, name, mime_type, data) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(entry_id, name) DO UPDATE SET mime_type = excluded.mime_type, data = excluded.data, created_at = datetime('now')`,
+		entryID, a.Name, a.MIMEType, a.Data,
+	)
+	if err != nil {
+		return fmt.Errorf("put attachment: %w", err)
+	}
+	return nil
+}
+
+// detectMIMEType guesses a MIME type from the file extension, then from the content.
+func detectMIMEType(name string, data []byte) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// DeleteAttachment removes an attachment from an entry.
+func (d *DB) DeleteAttachment(ctx context.Context, slug, name string) error {
+	defer d.cache.clear()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	entryID, err := lookupEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	before, err := attachmentHash(ctx, tx, entryID, name)
+	if err != nil {
+		return err
+	}
+	if before == "" {
+		return fmt.Errorf("attachment not found: %s/%s: %w", slug, name, ErrNotFound)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entry_attachments WHERE entry_id = ? AND name = ?`, entryID, name); err != nil {
+		return fmt.Errorf("delete attachment: %w", err)
+	}
+	if err := audit(ctx, tx, OpDetach, slug, name, before, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListAttachments returns the attachments of an entry, without data, ordered by name.
+func (d *DB) ListAttachments(ctx context.Context, slug string) ([]Attachment, error) {
+	entryID, err := lookupEntryID(ctx, d.read, slug)
+	if err != nil {
+		return nil, err
+	}
+	return listAttachments(ctx, d.read, entryID)
+}
+
+func listAttachments(ctx context.Context, q querier, entryID int64) ([]Attachment, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT name, mime_type, length(data), created_at FROM entry_attachments WHERE entry_id = ? ORDER BY name`, entryID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	defer rows.Close()
+	var out []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.Name, &a.MIMEType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// GetAttachment returns one attachment of an entry, with its data.
+func (d *DB) GetAttachment(ctx context.Context, slug, name string) (*Attachment, error) {
+	entryID, err := lookupEntryID(ctx, d.read, slug)
+	if err != nil {
+		return nil, err
+	}
+	a := &Attachment{Name: name}
+	err = d.read.QueryRowContext(ctx,
+		`SELECT mime_type, data, created_at FROM entry_attachments WHERE entry_id = ? AND name = ?`, entryID, name,
+	).Scan(&a.MIMEType, &a.Data, &a.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("attachment not found: %s/%s: %w", slug, name, ErrNotFound)
+		}
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	a.Size = len(a.Data)
+	return a, nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Audited operations.
+const (
+	OpCreate          = "create"
+	OpUpdate          = "update"
+	OpDelete          = "delete"
+	OpRestore         = "restore"
+	OpRestoreRevision = "restore_revision"
+	OpPurge           = "purge"
+	OpAttach          = "attach"
+	OpDetach          = "detach"
+	OpLink            = "link"
+	OpUnlink          = "unlink"
+	OpPropose         = "propose"
+	OpApprove         = "approve"
+	OpReject          = "reject"
+)
+
+// Actor is who makes a change: the MCP session and client, and the token
+// the request was authenticated with. Changes made without an actor in their
+// context (from the command line) are logged with empty fields.
+type Actor struct {
+	Session string
+	Client  string
+	Token   string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose changes are logged as made by a.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+func actorFrom(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
+
+// AuditEvent is one row of the audit log. BeforeHash and AfterHash are the
+// SHA-256 of the entry content (of the attachment data for attach and
+// detach) before and after the change; empty when there is none, e.g.
+// AfterHash of a delete.
+type AuditEvent struct {
+	ID        int64  `json:"id"`
+	Operation string `json:"operation"`
+	Slug      string `json:"slug"`
+	// Detail is the attachment name for attach and detach, the restored
+	// version for restore_revision, and the operation proposed (create,
+	// update or delete) for propose, approve and reject.
+	Detail     string `json:"detail,omitempty"`
+	BeforeHash string `json:"before_hash,omitempty"`
+	AfterHash  string `json:"after_hash,omitempty"`
+	Session    string `json:"session_id,omitempty"`
+	Client     string `json:"client,omitempty"`
+	Token      string `json:"token,omitempty"`
+	At         string `json:"at"`
+}
+
+// AuditFilter selects audit events. Empty fields match all events.
+type AuditFilter struct {
+	// Since keeps events at or after this UTC time, as "YYYY-MM-DD HH:MM:SS".
+	Since string
+	Slug  string
+	// Limit caps the number of events (0 = no limit).
+	Limit int
+}
+
+// AuditLog returns the audit events matching f, newest first.
+func (d *DB) AuditLog(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	var where []string
+	var args []any
+	if f.Since != "" {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since)
+	}
+	if f.Slug != "" {
+		where = append(where, "slug = ?")
+		args = append(args, f.Slug)
+	}
+	query := `SELECT id, operation, slug, detail, before_hash, after_hash, session_id, client, token, created_at FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+	rows, err := d.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	defer rows.Close()
+	var out []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.Operation, &e.Slug, &e.Detail, &e.BeforeHash, &e.AfterHash,
+			&e.Session, &e.Client, &e.Token, &e.At); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// audit records a change within the transaction making it, so the log and
+// the data cannot disagree. The actor is taken from ctx.
+func audit(ctx context.Context, tx *sql.Tx, op, slug, detail, before, after string) error {
+	a := actorFrom(ctx)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_log (operation, slug, detail, before_hash, after_hash, session_id, client, token)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		op, slug, detail, before, after, a.Session, a.Client, a.Token,
+	); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+// contentHash returns the hex SHA-256 of content, as stored in the audit log.
+func contentHash[T string | []byte](content T) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// benchEntries is the size of the synthetic knowledge base the benchmarks run against.
+const benchEntries = 5000
+
+// benchFanout is how many entries each entry links to, forming a tree rooted
+// at entry-00000.
+const benchFanout = 4
+
+var (
+	benchOnce sync.Once
+	benchDir  string
+	benchErr  error
+)
+
+// benchDB opens a database seeded with benchEntries entries of 3 tags each,
+// linked into a tree of benchFanout children per entry.
+// It is built once per test binary run and shared by all benchmarks.
+func benchDB(b *testing.B) *DB {
+	b.Helper()
+	benchOnce.Do(func() {
+		benchDir, benchErr = os.MkdirTemp("", "mcpedia-bench-")
+		if benchErr != nil {
+			return
+		}
+		var d *DB
+		d, benchErr = Open(filepath.Join(benchDir, "bench.db"))
+		if benchErr != nil {
+			return
+		}
+		defer d.Close()
+		ctx := context.Background()
+		langs := []string{"go", "rust", "python", "typescript"}
+		for i := 0; i < benchEntries && benchErr == nil; i++ {
+			benchErr = d.CreateEntry(ctx, &Entry{
+				Slug:        fmt.Sprintf("entry-%05d", i),
+				Title:       fmt.Sprintf("Entry %05d", i),
+				Description: "Synthetic entry for benchmarks",
+				Content:     fmt.Sprintf("Benchmark content %d about error handling and testing.", i),
+				Language:    langs[i%len(langs)],
+				Tags:        []string{langs[i%len(langs)], fmt.Sprintf("group-%d", i%50), "bench"},
+			})
+		}
+		for i := 0; i*benchFanout+1 < benchEntries && benchErr == nil; i++ {
+			for c := i*benchFanout + 1; c <= min(i*benchFanout+benchFanout, benchEntries-1) && benchErr == nil; c++ {
+				benchErr = d.AddLink(ctx, fmt.Sprintf("entry-%05d", i), fmt.Sprintf("entry-%05d", c), LinkRelated)
+			}
+		}
+	})
+	if benchErr != nil {
+		b.Fatalf("seed benchmark database: %v", benchErr)
+	}
+	d, err := Open(filepath.Join(benchDir, "bench.db"))
+	if err != nil {
+		b.Fatalf("open: %v", err)
+	}
+	b.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+func BenchmarkListEntries(b *testing.B) {
+	d := benchDB(b)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := d.ListEntries(ctx, Filter{}, Page{Limit: 200}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchEntries(b *testing.B) {
+	d := benchDB(b)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := d.SearchEntries(ctx, "error handling", Filter{}, Page{Limit: 50}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetEntriesByContext(b *testing.B) {
+	d := benchDB(b)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := d.GetEntriesByContext(ctx, Filter{Language: "go"}, Page{Limit: 50}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAllEntries(b *testing.B) {
+	d := benchDB(b)
+	ctx := context.Background()
+	for b.Loop() {
+		entries, err := d.AllEntries(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(entries) != benchEntries {
+			b.Fatalf("got %d entries, want %d", len(entries), benchEntries)
+		}
+	}
+}
+
+func BenchmarkGetRelated(b *testing.B) {
+	d := benchDB(b)
+	ctx := context.Background()
+	for b.Loop() {
+		related, err := d.GetRelated(ctx, "entry-00000", MaxLinkDepth, nil, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(related) == 0 {
+			b.Fatal("no related entries")
+		}
+	}
+}
+
+// BenchmarkLoadTags compares loading the tags of every entry in batches with
+// the one-query-per-entry approach it replaced.
+func BenchmarkLoadTags(b *testing.B) {
+	d := benchDB(b)
+	ctx := context.Background()
+	entries, err := d.AllEntries(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("batched", func(b *testing.B) {
+		for b.Loop() {
+			if err := loadTags(ctx, d.read, entries); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per-entry", func(b *testing.B) {
+		for b.Loop() {
+			for i := range entries {
+				tags, err := getTagsForEntry(ctx, d.read, entries[i].ID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				entries[i].Tags = tags
+			}
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// budgetCandidates is how many of the best-ranked matching entries
+// PackEntriesByContext considers; the rest are counted in OmittedUnlisted.
+const budgetCandidates = 200
+
+// kindPriority orders entry kinds for PackEntriesByContext: rules and project
+// context first, reference material last. Unknown kinds come after all of these.
+var kindPriority = []string{"rule", "context", "skill", "pattern", "guide", "reference"}
+
+// ContextPack is a size-limited set of entries from PackEntriesByContext.
+// Entries are in rank order; those listed in Truncated come with their
+// description but no content.
+type ContextPack struct {
+	Entries []Entry `json:"entries"`
+	// Total counts all matching entries, including those left out.
+	Total       int `json:"total"`
+	BudgetBytes int `json:"budget_bytes"`
+	UsedBytes   int `json:"used_bytes"`
+	// Truncated lists the entries returned without content, and Omitted the
+	// ranked entries that did not fit even as a description. OmittedUnlisted
+	// counts the matching entries ranked past the first budgetCandidates,
+	// which are left out without being listed.
+	Truncated       []string `json:"truncated,omitempty"`
+	Omitted         []string `json:"omitted,omitempty"`
+	OmittedUnlisted int      `json:"omitted_unlisted,omitempty"`
+}
+
+// PackEntriesByContext returns the entries matching f that fit in maxBytes,
+// counting the title, description and content of each. Entries are ranked by
+// kind (see kindPriority), then usage (reads and searches), then most recently
+// updated. Entries are packed in rank order: each whole if it fits, else with
+// its description only if that fits, else not at all, so a lower-ranked entry
+// never takes the room of a higher-ranked one. Only entries returned with
+// content count as read.
+func (d *DB) PackEntriesByContext(ctx context.Context, f Filter, maxBytes int) (*ContextPack, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("budget must be positive, got %d bytes", maxBytes)
+	}
+	wheres, args := filterClauses(f)
+	where := " WHERE " + strings.Join(append([]string{"e.deleted_at IS NULL"}, wheres...), " AND ")
+
+	pack := &ContextPack{Entries: []Entry{}, BudgetBytes: maxBytes}
+	if err := d.read.QueryRowContext(ctx, `SELECT COUNT(*) FROM entries e`+where, args...).Scan(&pack.Total); err != nil {
+		return nil, fmt.Errorf("count: %w", err)
+	}
+
+	kindOrder := "CASE e.kind"
+	for i, k := range kindPriority {
+		kindOrder += fmt.Sprintf(" WHEN '%s' THEN %d", k, i)
+	}
+	kindOrder += fmt.Sprintf(" ELSE %d END", len(kindPriority))
+	// Sizes are computed in SQL so content is only read for the entries packed whole
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at, e.review_after, e.expires_at, e.status,
+		        length(CAST(e.content AS BLOB)) + COALESCE((SELECT SUM(length(CAST(s.content AS BLOB))) FROM entry_sections s WHERE s.entry_id = e.id), 0)
+		 FROM entries e LEFT JOIN entry_stats es ON es.entry_id = e.id`+where+`
+		 ORDER BY `+kindOrder+`, COALESCE(es.reads + es.searches, 0) DESC, e.updated_at DESC, e.title, e.id LIMIT ?`,
+		append(args, budgetCandidates)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("rank entries: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []Entry
+	var sizes []int
+	for rows.Next() {
+		var e Entry
+		var size int
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status, &size); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		candidates = append(candidates, e)
+		sizes = append(sizes, size)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	pack.OmittedUnlisted = max(pack.Total-len(candidates), 0)
+
+	whole := make([]bool, len(candidates))
+	brief := make([]bool, len(candidates))
+	for i, e := range candidates {
+		cost := len(e.Title) + len(e.Description)
+		switch {
+		case pack.UsedBytes+cost+sizes[i] <= maxBytes:
+			whole[i] = true
+			pack.UsedBytes += cost + sizes[i]
+		case pack.UsedBytes+cost <= maxBytes:
+			brief[i] = true
+			pack.UsedBytes += cost
+		}
+	}
+
+	var packed []Entry
+	for i, e := range candidates {
+		switch {
+		case whole[i]:
+			packed = append(packed, e)
+		case brief[i]:
+			pack.Truncated = append(pack.Truncated, e.Slug)
+		default:
+			pack.Omitted = append(pack.Omitted, e.Slug)
+		}
+	}
+	if err := loadFullContent(ctx, d.read, packed); err != nil {
+		return nil, err
+	}
+	content := make(map[int64]string, len(packed))
+	for _, e := range packed {
+		content[e.ID] = e.Content
+	}
+	for i, e := range candidates {
+		if whole[i] || brief[i] {
+			e.Content = content[e.ID]
+			pack.Entries = append(pack.Entries, e)
+		}
+	}
+	if err := loadTags(ctx, d.read, pack.Entries); err != nil {
+		return nil, err
+	}
+	markStale(pack.Entries)
+	d.stats.addReads(entryIDs(packed)...)
+	return pack, nil
+}
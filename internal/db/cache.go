@@ -0,0 +1,141 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// CacheStats reports how the entry cache is doing.
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Size     int   `json:"size"`
+	Capacity int   `json:"capacity"`
+}
+
+// entryCache is an LRU cache of GetEntry and GetEntriesByContext results.
+// Any write to entries clears it, including writes by other processes (see
+// syncCache): context results and backlinks depend on many entries, so finer
+// invalidation is not worth the bookkeeping.
+//
+// A nil *entryCache is valid and caches nothing.
+type entryCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List // front is most recently used
+	items    map[string]*list.Element
+	// gen is bumped by clear, so a result read from the database before a
+	// write is not cached after it.
+	gen          uint64
+	hits, misses int64
+}
+
+type cacheItem struct {
+	key string
+	val any
+}
+
+func newEntryCache(capacity int) *entryCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &entryCache{capacity: capacity, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns the cached value for key and the generation to pass to put on a miss.
+func (c *entryCache) get(key string) (val any, ok bool, gen uint64) {
+	if c == nil {
+		return nil, false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.hits++
+		return el.Value.(*cacheItem).val, true, c.gen
+	}
+	c.misses++
+	return nil, false, c.gen
+}
+
+// put caches val unless the cache was cleared since gen was returned by get.
+func (c *entryCache) put(key string, val any, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheItem).val = val
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheItem{key: key, val: val})
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheItem).key)
+	}
+}
+
+func (c *entryCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	clear(c.items)
+	c.gen++
+}
+
+// versionWatch keeps one read connection for PRAGMA data_version, which
+// changes whenever another connection commits to the database.
+type versionWatch struct {
+	mu   sync.Mutex
+	conn *sql.Conn
+	last int64
+}
+
+// syncCache clears the cache if the database changed through another
+// connection since the last call. That catches writes by other processes,
+// which the cache cannot see otherwise; this DB's own writes and stats
+// flushes count too, as the watch connection cannot tell them apart.
+func (d *DB) syncCache(ctx context.Context) error {
+	w := d.version
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var v int64
+	if err := w.conn.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&v); err != nil {
+		return fmt.Errorf("check data version: %w", err)
+	}
+	if v != w.last {
+		d.cache.clear()
+		w.last = v
+	}
+	return nil
+}
+
+func (c *entryCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Size: c.ll.Len(), Capacity: c.capacity}
+}
+
+// CacheStats returns the entry cache counters. They are all zero when the
+// cache is disabled (Options.CacheSize 0).
+func (d *DB) CacheStats() CacheStats {
+	return d.cache.stats()
+}
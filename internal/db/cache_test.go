@@ -0,0 +1,42 @@
+package db
+
+import "testing"
+
+func TestEntryCacheEviction(t *testing.T) {
+	c := newEntryCache(2)
+	for _, k := range []string{"a", "b"} {
+		_, _, gen := c.get(k)
+		c.put(k, k, gen)
+	}
+	c.get("a") // b is now least recently used
+	_, _, gen := c.get("c")
+	c.put("c", "c", gen)
+
+	if _, ok, _ := c.get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if v, ok, _ := c.get(k); !ok || v != k {
+			t.Errorf("%s: got %v, %v", k, v, ok)
+		}
+	}
+	if s := c.stats(); s.Size != 2 || s.Hits != 3 || s.Misses != 4 {
+		t.Errorf("stats: %+v", s)
+	}
+}
+
+func TestEntryCacheStalePut(t *testing.T) {
+	c := newEntryCache(2)
+	_, _, gen := c.get("a")
+	c.clear() // a write lands between the read and the put
+	c.put("a", "stale", gen)
+	if _, ok, _ := c.get("a"); ok {
+		t.Error("value read before a clear should not be cached")
+	}
+
+	var disabled *entryCache
+	disabled.put("a", "x", 0)
+	if _, ok, _ := disabled.get("a"); ok || disabled.stats() != (CacheStats{}) {
+		t.Error("nil cache should cache nothing")
+	}
+}
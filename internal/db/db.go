@@ -4,29 +4,60 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
-	_ "embed"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
+
+	"github.com/pouriya/mcpedia/internal/sections"
 )
 
+// DefaultKind is the kind of entries created without one.
+const DefaultKind = "skill"
+
 // Sentinel errors for known failure conditions. Use errors.Is(err, db.ErrNotFound) to check.
 var (
 	ErrNotFound = errors.New("entry not found")
 	ErrLocked   = errors.New("database is locked")
+	// ErrConflict is returned when a write expects a version of the entry
+	// that is no longer the current one: someone else changed it first.
+	ErrConflict = errors.New("version conflict")
+	// ErrInTrash is returned when creating an entry whose slug belongs to a
+	// trashed entry, which would otherwise be lost with its history.
+	ErrInTrash = errors.New("slug is in the trash: restore or purge it first")
 )
 
-//go:embed schema.sql
-var schemaSQL string
-
-// DB wraps the SQLite connection and provides all data operations.
+// DB wraps the SQLite connections and provides all data operations.
+//
+// SQLite allows one writer at a time, so writes go through a pool of a single
+// connection whose transactions start with BEGIN IMMEDIATE: concurrent writers
+// queue in the pool instead of failing with SQLITE_BUSY when they upgrade a
+// read transaction. Reads use a separate, read-only pool, and with WAL they
+// never wait for the writer.
 type DB struct {
-	db *sql.DB
+	db    *sql.DB // writer
+	read  *sql.DB
+	stats *statsWriter
+	cache *entryCache
+	// version watches for commits from other processes to keep the cache
+	// current; nil when the cache is disabled.
+	version *versionWatch
+}
+
+// Options tunes a database opened with OpenWithOptions. The zero value
+// selects the defaults.
+type Options struct {
+	// StatsFlushInterval is how often buffered read and search counts are
+	// written to entry_stats (default DefaultStatsFlushInterval).
+	StatsFlushInterval time.Duration
+	// CacheSize is how many GetEntry and GetEntriesByContext results to keep
+	// in memory (0 disables the cache). Writes by other processes, such as
+	// `mcpedia review approve`, clear it too: see syncCache.
+	CacheSize int
 }
 
 // Entry represents a knowledge entry in the database.
@@ -44,8 +75,33 @@ type Entry struct {
 	CreatedAt   string   `json:"created_at"`
 	UpdatedAt   string   `json:"updated_at"`
 	Tags        []string `json:"tags"`
+	// ReviewAfter is the date (YYYY-MM-DD) from which the entry is due for
+	// review, and ExpiresAt the date from which it no longer applies; empty
+	// when not set.
+	ReviewAfter string `json:"review_after,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	// Stale is StaleReviewDue or StaleExpired once those dates are reached.
+	Stale string `json:"stale,omitempty"`
+	// Status is StatusDraft, StatusProposed or StatusApproved (the default
+	// for CreateEntry). Only approved entries are live; see ReviewQueue.
+	Status string `json:"status,omitempty"`
 	// Snippet is populated by search results only.
 	Snippet string `json:"snippet,omitempty"`
+	// Score is populated by semantic and hybrid search only; higher is better.
+	Score float64 `json:"score,omitempty"`
+	// Section is the heading of the section Content was cut to by
+	// GetEntrySection or, in search results for entries over 32 KB, the
+	// heading of the section the snippet comes from.
+	Section string `json:"section,omitempty"`
+	// DeletedAt is set for entries in the trash only.
+	DeletedAt string `json:"deleted_at,omitempty"`
+	// Links and Backlinks are populated by GetEntry only: the slugs this entry
+	// references as [[slug]] or mcpedia://entries/<slug>, and the entries referencing it.
+	Links     []string `json:"links,omitempty"`
+	Backlinks []string `json:"backlinks,omitempty"`
+	// Attachments is populated by GetEntry only, without data. CreateEntry
+	// stores the attachments given here, with their data.
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 // EntryStats holds usage statistics for an entry.
@@ -72,71 +128,168 @@ type Filter struct {
 	Project  string
 	Tag      string
 	Tags     []string // for get_entries_by_context
+	// ExcludeExpired leaves out entries past their expiry date.
+	ExcludeExpired bool
+	// IncludeUnapproved keeps draft and proposed entries, which are left
+	// out by default.
+	IncludeUnapproved bool
 }
 
-// Open opens (or creates) a SQLite database at path, runs PRAGMAs and schema.
+// filterClauses returns the WHERE conditions and arguments for f, for
+// queries over entries aliased as e. Tag and every one of Tags must match.
+func filterClauses(f Filter) (wheres []string, args []any) {
+	if !f.IncludeUnapproved {
+		wheres = append(wheres, "e.status = 'approved'")
+	}
+	for _, c := range []struct{ col, val string }{
+		{"e.kind", f.Kind}, {"e.language", f.Language}, {"e.domain", f.Domain}, {"e.project", f.Project},
+	} {
+		if c.val != "" {
+			wheres = append(wheres, c.col+" = ?")
+			args = append(args, c.val)
+		}
+	}
+	tags := f.Tags
+	if f.Tag != "" {
+		tags = append([]string{f.Tag}, tags...)
+	}
+	for _, tag := range tags {
+		wheres = append(wheres, `EXISTS (SELECT 1 FROM entry_tags et JOIN tags t ON t.id = et.tag_id WHERE et.entry_id = e.id AND t.name = ?)`)
+		args = append(args, tag)
+	}
+	if f.ExcludeExpired {
+		wheres = append(wheres, notExpiredClause)
+		args = append(args, today())
+	}
+	return wheres, args
+}
+
+// Open opens (or creates) a SQLite database at path, runs PRAGMAs and applies
+// pending schema migrations. It fails with ErrSchemaTooNew if the database was
+// migrated by a newer binary.
 func Open(path string) (*DB, error) {
-	sqlDB, err := sql.Open("sqlite", path)
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions is like Open, with tuning options.
+func OpenWithOptions(path string, opts Options) (*DB, error) {
+	d, err := open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(context.Background(), d.db, LatestVersion()); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return d, nil
+}
+
+// OpenNoMigrate opens a SQLite database at path and runs PRAGMAs, leaving the
+// schema as it is. Use it to inspect or migrate a database step by step.
+func OpenNoMigrate(path string) (*DB, error) {
+	return open(path, Options{})
+}
+
+func open(path string, opts Options) (*DB, error) {
+	// foreign_keys and busy_timeout are per-connection settings, so they go in
+	// the DSN and the driver applies them to every connection in the pool.
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+	writer, err := sql.Open("sqlite", dsn+"&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
 	// Set PRAGMAs
 	for _, pragma := range []string{
 		"PRAGMA journal_mode=WAL",
-		"PRAGMA foreign_keys=ON",
-		"PRAGMA busy_timeout=5000",
 	} {
-		if _, err := sqlDB.Exec(pragma); err != nil {
-			sqlDB.Close()
+		if _, err := writer.Exec(pragma); err != nil {
+			writer.Close()
 			return nil, fmt.Errorf("pragma %q: %w", pragma, err)
 		}
 	}
-	// Run main schema
-	if _, err := sqlDB.Exec(schemaSQL); err != nil {
-		sqlDB.Close()
-		return nil, fmt.Errorf("schema: %w", err)
-	}
-	// Create FTS5 table if it doesn't exist.
-	// We use a standalone FTS5 table (not external content) and manage sync manually
-	// in CreateEntry/UpdateEntry/DeleteEntry for maximum reliability.
-	var ftsExists int
-	err = sqlDB.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type='table' AND name='entries_fts'`).Scan(&ftsExists)
+	writer.SetMaxOpenConns(1)
+
+	reader, err := sql.Open("sqlite", dsn+"&_pragma=query_only(1)")
 	if err != nil {
-		sqlDB.Close()
-		return nil, fmt.Errorf("check fts: %w", err)
+		writer.Close()
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	// Connection pool limits (database/sql best practices)
+	reader.SetMaxOpenConns(25)
+	reader.SetMaxIdleConns(5)
+	reader.SetConnMaxLifetime(5 * time.Minute)
+
+	interval := opts.StatsFlushInterval
+	if interval <= 0 {
+		interval = DefaultStatsFlushInterval
 	}
-	if ftsExists == 0 {
-		ftsSQL := `CREATE VIRTUAL TABLE entries_fts USING fts5(title, description, content)`
-		if _, err := sqlDB.Exec(ftsSQL); err != nil {
-			sqlDB.Close()
-			return nil, fmt.Errorf("create fts: %w", err)
+	d := &DB{db: writer, read: reader, stats: startStatsWriter(writer, interval), cache: newEntryCache(opts.CacheSize)}
+	if d.cache != nil {
+		conn, err := reader.Conn(context.Background())
+		if err != nil {
+			writer.Close()
+			reader.Close()
+			return nil, fmt.Errorf("open db: %w", err)
 		}
+		d.version = &versionWatch{conn: conn}
 	}
-	// Connection pool limits (database/sql best practices)
-	sqlDB.SetMaxOpenConns(25)
-	sqlDB.SetMaxIdleConns(5)
-	sqlDB.SetConnMaxLifetime(5 * time.Minute)
-	return &DB{db: sqlDB}, nil
+	return d, nil
 }
 
-// Close closes the database connection.
+// Close writes buffered stats and closes the database connections.
 func (d *DB) Close() error {
-	return d.db.Close()
+	var err error
+	if d.version != nil {
+		err = d.version.conn.Close()
+	}
+	return errors.Join(d.stats.close(), err, d.read.Close(), d.db.Close())
 }
 
-// CreateEntry inserts a new entry with its tags and stats row.
+// CreateEntry inserts a new entry with its tags and stats row. Content over
+// 32 KB is stored as sections split on its headings (see package sections).
+// Entries created as draft or proposed are queued for review. A slug that is
+// in the trash is not reused: ErrInTrash is returned.
 func (d *DB) CreateEntry(ctx context.Context, e *Entry) error {
+	defer d.cache.clear()
+	e.Status = defaultStr(e.Status, StatusApproved)
+	if err := checkStatus(e.Status); err != nil {
+		return err
+	}
+	for _, date := range []string{e.ReviewAfter, e.ExpiresAt} {
+		if err := checkDate(date); err != nil {
+			return err
+		}
+	}
+	inline, secs, err := splitContent(e.Content)
+	if err != nil {
+		return err
+	}
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin: %w", err)
 	}
 	defer tx.Rollback()
 
+	var trashed bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM entries WHERE slug = ? AND deleted_at IS NOT NULL)`, e.Slug,
+	).Scan(&trashed); err != nil {
+		return fmt.Errorf("lookup trash: %w", err)
+	}
+	if trashed {
+		return fmt.Errorf("%s: %w", e.Slug, ErrInTrash)
+	}
+
 	res, err := tx.ExecContext(ctx,
-		`INSERT INTO entries (slug, title, description, content, kind, language, domain, project)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		e.Slug, e.Title, e.Description, e.Content,
-		defaultStr(e.Kind, "skill"), e.Language, e.Domain, e.Project,
+		`INSERT INTO entries (slug, title, description, content, kind, language, domain, project, review_after, expires_at, status)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Slug, e.Title, e.Description, inline,
+		defaultStr(e.Kind, DefaultKind), e.Language, e.Domain, e.Project, e.ReviewAfter, e.ExpiresAt, e.Status,
 	)
 	if err != nil {
 		return fmt.Errorf("insert entry: %w", err)
@@ -146,6 +299,9 @@ func (d *DB) CreateEntry(ctx context.Context, e *Entry) error {
 		return fmt.Errorf("last insert id: %w", err)
 	}
 	e.ID = entryID
+	if err := setSections(ctx, tx, entryID, secs); err != nil {
+		return fmt.Errorf("set sections: %w", err)
+	}
 
 	// Insert into FTS
 	if _, err := tx.ExecContext(ctx, `INSERT INTO entries_fts(rowid, title, description, content) VALUES (?, ?, ?, ?)`,
@@ -163,67 +319,174 @@ func (d *DB) CreateEntry(ctx context.Context, e *Entry) error {
 		return fmt.Errorf("set tags: %w", err)
 	}
 
+	// Index [[slug]] references
+	if err := setRefs(ctx, tx, entryID, e.Slug, e.Content); err != nil {
+		return fmt.Errorf("set refs: %w", err)
+	}
+
+	for i := range e.Attachments {
+		if err := putAttachment(ctx, tx, entryID, &e.Attachments[i]); err != nil {
+			return err
+		}
+	}
+
+	// Embed for semantic search
+	if err := setVector(ctx, tx, entryID); err != nil {
+		return fmt.Errorf("set vector: %w", err)
+	}
+
+	if err := audit(ctx, tx, OpCreate, e.Slug, "", "", contentHash(e.Content)); err != nil {
+		return err
+	}
+	if e.Status != StatusApproved {
+		if err := propose(ctx, tx, entryID, OpCreate, nil, 1); err != nil {
+			return err
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("commit: %w", err)
 	}
 
 	// Read back the created_at/updated_at/version that the DB set
-	row := d.db.QueryRowContext(ctx, `SELECT version, created_at, updated_at FROM entries WHERE id = ?`, entryID)
+	row := d.read.QueryRowContext(ctx, `SELECT version, created_at, updated_at FROM entries WHERE id = ?`, entryID)
 	return row.Scan(&e.Version, &e.CreatedAt, &e.UpdatedAt)
 }
 
 // GetEntry retrieves a full entry by slug and bumps the read counter.
 func (d *DB) GetEntry(ctx context.Context, slug string) (*Entry, error) {
+	key := "entry\x00" + slug
+	if err := d.syncCache(ctx); err != nil {
+		return nil, err
+	}
+	v, ok, gen := d.cache.get(key)
+	if !ok {
+		e, err := d.getEntry(ctx, slug)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		// Misses are cached too (as nil): how-to-use is looked up by every
+		// session whether or not the user has written one.
+		v = e
+		d.cache.put(key, e, gen)
+	}
+	e := v.(*Entry)
+	if e == nil {
+		return nil, fmt.Errorf("entry not found: %s: %w", slug, ErrNotFound)
+	}
+	d.stats.addReads(e.ID)
+	cp := *e
+	cp.Stale = staleness(cp.ReviewAfter, cp.ExpiresAt, today())
+	return &cp, nil
+}
+
+func (d *DB) getEntry(ctx context.Context, slug string) (*Entry, error) {
 	e := &Entry{}
-	row := d.db.QueryRowContext(ctx,
-		`SELECT id, slug, title, description, content, kind, language, domain, project, version, created_at, updated_at
-		 FROM entries WHERE slug = ?`, slug,
+	row := d.read.QueryRowContext(ctx,
+		`SELECT id, slug, title, description, content, kind, language, domain, project, version, created_at, updated_at, review_after, expires_at, status
+		 FROM entries WHERE slug = ? AND deleted_at IS NULL`, slug,
 	)
 	if err := row.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Content,
 		&e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version,
-		&e.CreatedAt, &e.UpdatedAt); err != nil {
+		&e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("entry not found: %s: %w", slug, ErrNotFound)
 		}
 		return nil, fmt.Errorf("get entry: %w", err)
 	}
-	tags, err := getTagsForEntry(ctx, d.db, e.ID)
+	full := []Entry{*e}
+	if err := loadContent(ctx, d.read, full); err != nil {
+		return nil, err
+	}
+	e.Content = full[0].Content
+	tags, err := getTagsForEntry(ctx, d.read, e.ID)
 	if err != nil {
 		return nil, fmt.Errorf("get tags: %w", err)
 	}
 	e.Tags = tags
+	if e.Links, e.Backlinks, err = getRefs(ctx, d.read, e.ID, e.Slug); err != nil {
+		return nil, err
+	}
+	if e.Attachments, err = listAttachments(ctx, d.read, e.ID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
 
-	// Bump read stats (best-effort; do not fail the request)
-	now := time.Now().UTC().Format(time.DateTime)
-	if _, err := d.db.ExecContext(ctx, `UPDATE entry_stats SET reads = reads + 1, last_read_at = ? WHERE entry_id = ?`, now, e.ID); err != nil {
-		slog.Debug("update read stats", "err", err, "entry_id", e.ID)
+// GetEntryMeta returns an entry's metadata and tags, without content, and
+// does not count as a read.
+func (d *DB) GetEntryMeta(ctx context.Context, slug string) (*Entry, error) {
+	id, err := lookupEntryID(ctx, d.read, slug)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{ID: id}
+	if err := loadEntryMeta(ctx, d.read, e); err != nil {
+		return nil, err
 	}
 	return e, nil
 }
 
 // UpdateEntry updates only the provided fields for the entry identified by slug.
-// Supported keys: title, description, content, kind, language, domain, project, tags.
-func (d *DB) UpdateEntry(ctx context.Context, slug string, fields map[string]any) error {
+// Supported keys: title, description, content, kind, language, domain, project,
+// review_after, expires_at, tags. The previous version is kept in entry_revisions (see ListRevisions).
+// If expectedVersion is not 0 and the entry is at another version, nothing
+// is changed and ErrConflict is returned.
+func (d *DB) UpdateEntry(ctx context.Context, slug string, expectedVersion int, fields map[string]any) error {
+	defer d.cache.clear()
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get entry ID
-	var entryID int64
-	if err := tx.QueryRowContext(ctx, `SELECT id FROM entries WHERE slug = ?`, slug).Scan(&entryID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("entry not found: %s: %w", slug, ErrNotFound)
+	if err := updateEntry(ctx, tx, OpUpdate, "", slug, expectedVersion, fields); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateEntry applies fields to the entry identified by slug within tx, and
+// records the change in the audit log as op with the given detail.
+func updateEntry(ctx context.Context, tx *sql.Tx, op, detail, slug string, expectedVersion int, fields map[string]any) error {
+	entryID, err := lookupEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(ctx, tx, entryID, slug, expectedVersion); err != nil {
+		return err
+	}
+	before, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
+	}
+
+	// Keep the current version before overwriting it
+	if err := saveRevision(ctx, tx, entryID); err != nil {
+		return fmt.Errorf("save revision: %w", err)
+	}
+
+	if err := checkFieldDates(fields); err != nil {
+		return err
+	}
+
+	// Content over 32 KB goes to entry_sections instead of entries.content
+	content, setContent := fields["content"]
+	var secs []sections.Section
+	if setContent {
+		s, _ := content.(string)
+		if content, secs, err = splitContent(s); err != nil {
+			return err
 		}
-		return fmt.Errorf("lookup: %w", err)
 	}
 
 	// Build dynamic UPDATE
 	setClauses := []string{}
 	args := []any{}
-	for _, col := range []string{"title", "description", "content", "kind", "language", "domain", "project"} {
+	for _, col := range []string{"title", "description", "content", "kind", "language", "domain", "project", "review_after", "expires_at"} {
 		if v, ok := fields[col]; ok {
+			if col == "content" {
+				v = content
+			}
 			setClauses = append(setClauses, col+" = ?")
 			args = append(args, v)
 		}
@@ -235,19 +498,33 @@ func (d *DB) UpdateEntry(ctx context.Context, slug string, fields map[string]any
 	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("update entry: %w", err)
 	}
+	if setContent {
+		if err := setSections(ctx, tx, entryID, secs); err != nil {
+			return fmt.Errorf("update sections: %w", err)
+		}
+	}
 
 	// Sync FTS: delete old row, re-insert with current values from entries
 	if _, err := tx.ExecContext(ctx, `DELETE FROM entries_fts WHERE rowid = ?`, entryID); err != nil {
 		return fmt.Errorf("fts delete: %w", err)
 	}
-	var ftsTitle, ftsDesc, ftsContent string
-	if err := tx.QueryRowContext(ctx, `SELECT title, description, content FROM entries WHERE id = ?`, entryID).Scan(&ftsTitle, &ftsDesc, &ftsContent); err != nil {
+	var ftsTitle, ftsDesc string
+	if err := tx.QueryRowContext(ctx, `SELECT title, description FROM entries WHERE id = ?`, entryID).Scan(&ftsTitle, &ftsDesc); err != nil {
+		return fmt.Errorf("fts read: %w", err)
+	}
+	ftsContent, err := entryContent(ctx, tx, entryID)
+	if err != nil {
 		return fmt.Errorf("fts read: %w", err)
 	}
 	if _, err := tx.ExecContext(ctx, `INSERT INTO entries_fts(rowid, title, description, content) VALUES (?, ?, ?, ?)`,
 		entryID, ftsTitle, ftsDesc, ftsContent); err != nil {
 		return fmt.Errorf("fts insert: %w", err)
 	}
+	if _, ok := fields["content"]; ok {
+		if err := setRefs(ctx, tx, entryID, slug, ftsContent); err != nil {
+			return fmt.Errorf("update refs: %w", err)
+		}
+	}
 
 	// Handle tags if provided
 	if tagsVal, ok := fields["tags"]; ok {
@@ -267,72 +544,107 @@ func (d *DB) UpdateEntry(ctx context.Context, slug string, fields map[string]any
 		}
 	}
 
+	if err := setVector(ctx, tx, entryID); err != nil {
+		return fmt.Errorf("update vector: %w", err)
+	}
+
 	// Bump update stats
 	now := time.Now().UTC().Format(time.DateTime)
 	if _, err := tx.ExecContext(ctx, `UPDATE entry_stats SET updates = updates + 1, last_update_at = ? WHERE entry_id = ?`, now, entryID); err != nil {
 		return fmt.Errorf("update stats: %w", err)
 	}
-
-	return tx.Commit()
+	return audit(ctx, tx, op, slug, detail, contentHash(before), contentHash(ftsContent))
 }
 
-// DeleteEntry removes an entry by slug. CASCADE handles entry_tags and entry_stats.
-// FTS and entry deletion are done in a single transaction for consistency.
-func (d *DB) DeleteEntry(ctx context.Context, slug string) error {
+// DeleteEntry moves an entry to the trash. Trashed entries are hidden from all
+// reads until restored with RestoreEntry or removed for good with PurgeEntry.
+// If expectedVersion is not 0 and the entry is at another version, it is
+// kept and ErrConflict is returned.
+func (d *DB) DeleteEntry(ctx context.Context, slug string, expectedVersion int) error {
+	defer d.cache.clear()
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin: %w", err)
 	}
 	defer tx.Rollback()
 
-	var entryID int64
-	if err := tx.QueryRowContext(ctx, `SELECT id FROM entries WHERE slug = ?`, slug).Scan(&entryID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("entry not found: %s: %w", slug, ErrNotFound)
-		}
-		return fmt.Errorf("lookup: %w", err)
+	if err := deleteEntry(ctx, tx, OpDelete, "", slug, expectedVersion); err != nil {
+		return err
 	}
-	if _, err := tx.ExecContext(ctx, `DELETE FROM entries_fts WHERE rowid = ?`, entryID); err != nil {
-		return fmt.Errorf("delete fts: %w", err)
+	return tx.Commit()
+}
+
+// deleteEntry moves the entry identified by slug to the trash within tx, and
+// records the change in the audit log as op with the given detail.
+func deleteEntry(ctx context.Context, tx *sql.Tx, op, detail, slug string, expectedVersion int) error {
+	entryID, err := lookupEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(ctx, tx, entryID, slug, expectedVersion); err != nil {
+		return err
+	}
+	content, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
 	}
-	if _, err := tx.ExecContext(ctx, `DELETE FROM entries WHERE id = ?`, entryID); err != nil {
+	if _, err := tx.ExecContext(ctx, `UPDATE entries SET deleted_at = datetime('now') WHERE id = ?`, entryID); err != nil {
 		return fmt.Errorf("delete entry: %w", err)
 	}
-	return tx.Commit()
+	return audit(ctx, tx, op, slug, detail, contentHash(content), "")
 }
 
-// ListEntries returns entries without content, optionally filtered.
-func (d *DB) ListEntries(ctx context.Context, f Filter) ([]Entry, error) {
-	query := `SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at FROM entries e`
-	args := []any{}
-	wheres := []string{}
-	if f.Kind != "" {
-		wheres = append(wheres, "e.kind = ?")
-		args = append(args, f.Kind)
-	}
-	if f.Language != "" {
-		wheres = append(wheres, "e.language = ?")
-		args = append(args, f.Language)
+// ListEntries returns a page of entries without content, optionally filtered,
+// ordered by title. Pages hold 50 entries by default and at most 200.
+func (d *DB) ListEntries(ctx context.Context, f Filter, page Page) (*EntryPage, error) {
+	limit, offset, err := page.window(50, 200)
+	if err != nil {
+		return nil, err
 	}
-	if f.Domain != "" {
-		wheres = append(wheres, "e.domain = ?")
-		args = append(args, f.Domain)
+	wheres, args := filterClauses(f)
+	where := " WHERE " + strings.Join(append([]string{"e.deleted_at IS NULL"}, wheres...), " AND ")
+
+	var total int
+	if err := d.read.QueryRowContext(ctx, `SELECT COUNT(*) FROM entries e`+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count entries: %w", err)
+	}
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at, e.review_after, e.expires_at, e.status
+		 FROM entries e`+where+` ORDER BY e.title, e.id LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list entries: %w", err)
 	}
-	if f.Project != "" {
-		wheres = append(wheres, "e.project = ?")
-		args = append(args, f.Project)
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		entries = append(entries, e)
 	}
-	if f.Tag != "" {
-		query += ` JOIN entry_tags et ON et.entry_id = e.id JOIN tags t ON t.id = et.tag_id`
-		wheres = append(wheres, "t.name = ?")
-		args = append(args, f.Tag)
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	if len(wheres) > 0 {
-		query += " WHERE " + strings.Join(wheres, " AND ")
+	if err := loadTags(ctx, d.read, entries); err != nil {
+		return nil, err
 	}
-	query += " ORDER BY e.title"
+	markStale(entries)
+	return newEntryPage(entries, total, offset), nil
+}
 
-	rows, err := d.db.QueryContext(ctx, query, args...)
+// ListEntriesAfter returns up to limit live, approved entries ordered by slug, starting
+// after the slug after ("" for the first page), with metadata only (no content
+// or tags). Unlike an offset, a slug stays a valid page boundary while entries
+// are created and deleted.
+func (d *DB) ListEntriesAfter(ctx context.Context, after string, limit int) ([]Entry, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, slug, title, description, kind, language, domain, project, version, created_at, updated_at
+		 FROM entries WHERE deleted_at IS NULL AND status = 'approved' AND slug > ? ORDER BY slug LIMIT ?`, after, limit,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("list entries: %w", err)
 	}
@@ -344,157 +656,172 @@ func (d *DB) ListEntries(ctx context.Context, f Filter) ([]Entry, error) {
 		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
-		tags, err := getTagsForEntry(ctx, d.db, e.ID)
-		if err != nil {
-			return nil, fmt.Errorf("get tags for entry %d: %w", e.ID, err)
-		}
-		e.Tags = tags
 		entries = append(entries, e)
 	}
 	return entries, rows.Err()
 }
 
-// SearchEntries runs FTS5 search with optional filters, returns entries with snippets (no full content).
-func (d *DB) SearchEntries(ctx context.Context, queryStr string, f Filter, limit int) ([]Entry, error) {
-	if limit <= 0 || limit > 50 {
-		limit = 10
-	}
-	q := `SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at,
-	             snippet(entries_fts, 2, '>>>', '<<<', '...', 32) as snip
-	      FROM entries_fts fts
-	      JOIN entries e ON e.id = fts.rowid`
-	args := []any{}
-	wheres := []string{"fts.entries_fts MATCH ?"}
-	args = append(args, queryStr)
-
-	if f.Kind != "" {
-		wheres = append(wheres, "e.kind = ?")
-		args = append(args, f.Kind)
+// SearchEntries runs a keyword search with optional filters and returns a
+// page of entries with snippets (no full content). Pages hold 10 entries by
+// default and at most 50. The query uses the syntax described at ParseQuery;
+// unparseable queries fail with ErrInvalidQuery.
+func (d *DB) SearchEntries(ctx context.Context, queryStr string, f Filter, page Page) (*EntryPage, error) {
+	limit, offset, err := page.window(10, 50)
+	if err != nil {
+		return nil, err
 	}
-	if f.Language != "" {
-		wheres = append(wheres, "e.language = ?")
-		args = append(args, f.Language)
+	query, err := ParseQuery(queryStr)
+	if err != nil {
+		return nil, err
 	}
-	if f.Domain != "" {
-		wheres = append(wheres, "e.domain = ?")
-		args = append(args, f.Domain)
+	entries, total, err := d.searchKeyword(ctx, query, f, limit, offset)
+	if err != nil {
+		return nil, err
 	}
-	if f.Project != "" {
-		wheres = append(wheres, "e.project = ?")
-		args = append(args, f.Project)
+	d.bumpSearchStats(entries)
+	markStale(entries)
+	return newEntryPage(entries, total, offset), nil
+}
+
+// searchKeyword runs an FTS5 query ranked by BM25, without touching stats, and
+// returns one window of results and the total number of matches.
+// Queries with filters only are ordered by title and use the description as snippet.
+func (d *DB) searchKeyword(ctx context.Context, query *Query, f Filter, limit, offset int) ([]Entry, int, error) {
+	cols := `SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at, e.review_after, e.expires_at, e.status,
+	             snippet(entries_fts, 2, '>>>', '<<<', '...', 32) as snip`
+	from := ` FROM entries_fts fts JOIN entries e ON e.id = fts.rowid`
+	wheres := []string{"fts.entries_fts MATCH ?", "e.deleted_at IS NULL"}
+	args := []any{query.match}
+	order := " ORDER BY rank"
+	if query.match == "" {
+		cols = `SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at, e.review_after, e.expires_at, e.status,
+		            e.description`
+		from = ` FROM entries e`
+		wheres, args = []string{"e.deleted_at IS NULL"}, nil
+		order = " ORDER BY e.title, e.id"
 	}
-	if f.Tag != "" {
-		q += ` JOIN entry_tags et ON et.entry_id = e.id JOIN tags t ON t.id = et.tag_id`
-		wheres = append(wheres, "t.name = ?")
-		args = append(args, f.Tag)
+
+	fw, fa := filterClauses(f)
+	qw, qa := query.clauses()
+	wheres = append(append(wheres, fw...), qw...)
+	args = append(append(args, fa...), qa...)
+	where := " WHERE " + strings.Join(wheres, " AND ")
+
+	var total int
+	if err := d.read.QueryRowContext(ctx, `SELECT COUNT(*)`+from+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count: %w", err)
 	}
-	q += " WHERE " + strings.Join(wheres, " AND ")
-	q += " ORDER BY rank LIMIT ?"
-	args = append(args, limit)
+	q := cols + from + where + order + " LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
 
-	rows, err := d.db.QueryContext(ctx, q, args...)
+	rows, err := d.read.QueryContext(ctx, q, args...)
 	if err != nil {
-		return nil, fmt.Errorf("search: %w", err)
+		return nil, 0, fmt.Errorf("search: %w", err)
 	}
 	defer rows.Close()
 
-	now := time.Now().UTC().Format(time.DateTime)
 	var entries []Entry
 	for rows.Next() {
 		var e Entry
-		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.Snippet); err != nil {
-			return nil, fmt.Errorf("scan: %w", err)
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status, &e.Snippet); err != nil {
+			return nil, 0, fmt.Errorf("scan: %w", err)
 		}
-		tags, err := getTagsForEntry(ctx, d.db, e.ID)
-		if err != nil {
-			return nil, fmt.Errorf("get tags for entry %d: %w", e.ID, err)
-		}
-		e.Tags = tags
 		entries = append(entries, e)
-		// Bump search stats (best-effort)
-		if _, err := d.db.ExecContext(ctx, `UPDATE entry_stats SET searches = searches + 1, last_search_at = ? WHERE entry_id = ?`, now, e.ID); err != nil {
-			slog.Debug("update search stats", "err", err, "entry_id", e.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := loadTags(ctx, d.read, entries); err != nil {
+		return nil, 0, err
+	}
+	if query.match != "" {
+		if err := setSnippetSections(ctx, d.read, entries); err != nil {
+			return nil, 0, err
 		}
 	}
-	return entries, rows.Err()
+	return entries, total, nil
 }
 
-// GetEntriesByContext returns full entries matching the given filters (language, domain, kind, tags, project).
-func (d *DB) GetEntriesByContext(ctx context.Context, f Filter, limit int) ([]Entry, error) {
-	if limit <= 0 || limit > 50 {
-		limit = 20
-	}
-	q := `SELECT e.id, e.slug, e.title, e.description, e.content, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at FROM entries e`
-	args := []any{}
-	wheres := []string{}
+// bumpSearchStats counts a search hit for each entry.
+func (d *DB) bumpSearchStats(entries []Entry) {
+	d.stats.addSearches(entryIDs(entries)...)
+}
 
-	if f.Kind != "" {
-		wheres = append(wheres, "e.kind = ?")
-		args = append(args, f.Kind)
-	}
-	if f.Language != "" {
-		wheres = append(wheres, "e.language = ?")
-		args = append(args, f.Language)
-	}
-	if f.Domain != "" {
-		wheres = append(wheres, "e.domain = ?")
-		args = append(args, f.Domain)
-	}
-	if f.Project != "" {
-		wheres = append(wheres, "e.project = ?")
-		args = append(args, f.Project)
+// GetEntriesByContext returns a page of full entries matching the given filters
+// (language, domain, kind, tags, project), ordered by title. Pages hold 20
+// entries by default and at most 50.
+func (d *DB) GetEntriesByContext(ctx context.Context, f Filter, page Page) (*EntryPage, error) {
+	key := fmt.Sprintf("context\x00%#v\x00%#v", f, page)
+	if f.ExcludeExpired {
+		// Which entries are expired changes with the date
+		key += "\x00" + today()
+	}
+	if err := d.syncCache(ctx); err != nil {
+		return nil, err
 	}
-	// Tags filter: entry must have ALL specified tags
-	if len(f.Tags) > 0 {
-		for i, tag := range f.Tags {
-			alias := fmt.Sprintf("et%d", i)
-			talias := fmt.Sprintf("t%d", i)
-			q += fmt.Sprintf(` JOIN entry_tags %s ON %s.entry_id = e.id JOIN tags %s ON %s.id = %s.tag_id`, alias, alias, talias, talias, alias)
-			wheres = append(wheres, talias+".name = ?")
-			args = append(args, tag)
+	v, ok, gen := d.cache.get(key)
+	if !ok {
+		p, err := d.getEntriesByContext(ctx, f, page)
+		if err != nil {
+			return nil, err
 		}
-	} else if f.Tag != "" {
-		q += ` JOIN entry_tags et ON et.entry_id = e.id JOIN tags t ON t.id = et.tag_id`
-		wheres = append(wheres, "t.name = ?")
-		args = append(args, f.Tag)
+		v = p
+		d.cache.put(key, p, gen)
+	}
+	p := *v.(*EntryPage)
+	p.Entries = slices.Clone(p.Entries)
+	markStale(p.Entries)
+	d.stats.addReads(entryIDs(p.Entries)...)
+	return &p, nil
+}
+
+func (d *DB) getEntriesByContext(ctx context.Context, f Filter, page Page) (*EntryPage, error) {
+	limit, offset, err := page.window(20, 50)
+	if err != nil {
+		return nil, err
 	}
+	wheres, args := filterClauses(f)
+	where := " WHERE " + strings.Join(append([]string{"e.deleted_at IS NULL"}, wheres...), " AND ")
 
-	if len(wheres) > 0 {
-		q += " WHERE " + strings.Join(wheres, " AND ")
+	var total int
+	if err := d.read.QueryRowContext(ctx, `SELECT COUNT(*) FROM entries e`+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count: %w", err)
 	}
-	q += " ORDER BY e.title LIMIT ?"
-	args = append(args, limit)
+	q := `SELECT e.id, e.slug, e.title, e.description, e.content, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at, e.review_after, e.expires_at, e.status
+	      FROM entries e` + where + ` ORDER BY e.title, e.id LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
 
-	rows, err := d.db.QueryContext(ctx, q, args...)
+	rows, err := d.read.QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, fmt.Errorf("get by context: %w", err)
 	}
 	defer rows.Close()
 
-	now := time.Now().UTC().Format(time.DateTime)
 	var entries []Entry
 	for rows.Next() {
 		var e Entry
-		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Content, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Content, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
-		tags, err := getTagsForEntry(ctx, d.db, e.ID)
-		if err != nil {
-			return nil, fmt.Errorf("get tags for entry %d: %w", e.ID, err)
-		}
-		e.Tags = tags
 		entries = append(entries, e)
-		// Bump read stats (best-effort)
-		if _, err := d.db.ExecContext(ctx, `UPDATE entry_stats SET reads = reads + 1, last_read_at = ? WHERE entry_id = ?`, now, e.ID); err != nil {
-			slog.Debug("update read stats", "err", err, "entry_id", e.ID)
-		}
 	}
-	return entries, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadTags(ctx, d.read, entries); err != nil {
+		return nil, err
+	}
+	if err := loadContent(ctx, d.read, entries); err != nil {
+		return nil, err
+	}
+	return newEntryPage(entries, total, offset), nil
 }
 
-// ListTags returns all tags with their entry counts.
+// ListTags returns all tags with their counts of approved entries.
 func (d *DB) ListTags(ctx context.Context) ([]Tag, error) {
-	rows, err := d.db.QueryContext(ctx, `SELECT t.name, COUNT(et.entry_id) as cnt FROM tags t JOIN entry_tags et ON et.tag_id = t.id GROUP BY t.id ORDER BY cnt DESC, t.name`)
+	rows, err := d.read.QueryContext(ctx, `SELECT t.name, COUNT(et.entry_id) as cnt FROM tags t
+		 JOIN entry_tags et ON et.tag_id = t.id JOIN entries e ON e.id = et.entry_id
+		 WHERE e.deleted_at IS NULL AND e.status = 'approved' GROUP BY t.id ORDER BY cnt DESC, t.name`)
 	if err != nil {
 		return nil, fmt.Errorf("list tags: %w", err)
 	}
@@ -514,7 +841,7 @@ func (d *DB) ListTags(ctx context.Context) ([]Tag, error) {
 // GetStats returns usage statistics for an entry.
 func (d *DB) GetStats(ctx context.Context, slug string) (*EntryStats, error) {
 	s := &EntryStats{}
-	err := d.db.QueryRowContext(ctx,
+	err := d.read.QueryRowContext(ctx,
 		`SELECT es.reads, es.searches, es.updates, es.last_read_at, es.last_search_at, es.last_update_at
 		 FROM entry_stats es JOIN entries e ON e.id = es.entry_id WHERE e.slug = ?`, slug,
 	).Scan(&s.Reads, &s.Searches, &s.Updates, &s.LastReadAt, &s.LastSearchAt, &s.LastUpdateAt)
@@ -529,9 +856,9 @@ func (d *DB) GetStats(ctx context.Context, slug string) (*EntryStats, error) {
 
 // AllEntries returns all entries with full content and tags (for export).
 func (d *DB) AllEntries(ctx context.Context) ([]Entry, error) {
-	rows, err := d.db.QueryContext(ctx,
-		`SELECT id, slug, title, description, content, kind, language, domain, project, version, created_at, updated_at
-		 FROM entries ORDER BY slug`,
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, slug, title, description, content, kind, language, domain, project, version, created_at, updated_at, review_after, expires_at, status
+		 FROM entries WHERE deleted_at IS NULL ORDER BY slug`,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("all entries: %w", err)
@@ -541,69 +868,58 @@ func (d *DB) AllEntries(ctx context.Context) ([]Entry, error) {
 	var entries []Entry
 	for rows.Next() {
 		var e Entry
-		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Content, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Content, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
-		tags, err := getTagsForEntry(ctx, d.db, e.ID)
-		if err != nil {
-			return nil, fmt.Errorf("get tags for entry %d: %w", e.ID, err)
-		}
-		e.Tags = tags
 		entries = append(entries, e)
 	}
-	return entries, rows.Err()
-}
-
-// IsLocked returns true if the database write lock is active.
-func (d *DB) IsLocked(ctx context.Context) (bool, error) {
-	var active int
-	if err := d.db.QueryRowContext(ctx, `SELECT active FROM lock WHERE id = 1`).Scan(&active); err != nil {
-		return false, fmt.Errorf("check lock: %w", err)
-	}
-	return active == 1, nil
-}
-
-// Lock activates the write lock with the given token. Fails if already locked.
-func (d *DB) Lock(ctx context.Context, token string) error {
-	if token == "" {
-		return fmt.Errorf("token must not be empty")
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	locked, err := d.IsLocked(ctx)
-	if err != nil {
-		return err
+	if err := loadTags(ctx, d.read, entries); err != nil {
+		return nil, err
 	}
-	if locked {
-		return fmt.Errorf("database is already locked: %w", ErrLocked)
+	if err := loadContent(ctx, d.read, entries); err != nil {
+		return nil, err
 	}
-	hashed := hashToken(token)
-	_, err = d.db.ExecContext(ctx, `UPDATE lock SET active = 1, token = ? WHERE id = 1`, hashed)
-	return err
+	return entries, nil
 }
 
-// Unlock deactivates the write lock. The provided token must match the one used to lock.
-func (d *DB) Unlock(ctx context.Context, token string) error {
-	if token == "" {
-		return fmt.Errorf("token must not be empty")
-	}
-	locked, err := d.IsLocked(ctx)
-	if err != nil {
-		return err
-	}
-	if !locked {
-		return fmt.Errorf("database is not locked")
+// --- helpers ---
+
+// checkVersion returns ErrConflict if expected is not 0 and the entry is at
+// another version. Called within the write transaction, so the version
+// cannot change between the check and the write.
+func checkVersion(ctx context.Context, tx *sql.Tx, entryID int64, slug string, expected int) error {
+	if expected == 0 {
+		return nil
 	}
-	var storedHash string
-	if err := d.db.QueryRowContext(ctx, `SELECT token FROM lock WHERE id = 1`).Scan(&storedHash); err != nil {
-		return fmt.Errorf("read lock: %w", err)
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT version FROM entries WHERE id = ?`, entryID).Scan(&current); err != nil {
+		return fmt.Errorf("read version: %w", err)
 	}
-	if storedHash != hashToken(token) {
-		return fmt.Errorf("invalid token")
+	if current != expected {
+		return fmt.Errorf("%s is at version %d, not %d: %w", slug, current, expected, ErrConflict)
 	}
-	_, err = d.db.ExecContext(ctx, `UPDATE lock SET active = 0, token = '' WHERE id = 1`)
-	return err
+	return nil
 }
 
-// --- helpers ---
+// checkFieldDates validates the review and expiry dates among the fields
+// of an update.
+func checkFieldDates(fields map[string]any) error {
+	for _, col := range []string{"review_after", "expires_at"} {
+		if v, ok := fields[col]; ok {
+			date, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a date string", col)
+			}
+			if err := checkDate(date); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
 func hashToken(token string) string {
 	h := sha256.Sum256([]byte(token))
@@ -646,6 +962,49 @@ func setTags(ctx context.Context, tx *sql.Tx, entryID int64, tags []string) erro
 	return nil
 }
 
+// idBatchSize bounds the number of ids bound in one loadTags or loadSections
+// query, well under SQLite's limit on host parameters.
+const idBatchSize = 500
+
+// loadTags fills in the tags of every entry with one query per batch of
+// entries, rather than one per entry.
+func loadTags(ctx context.Context, q querier, entries []Entry) error {
+	byID := make(map[int64]*Entry, len(entries))
+	for i := range entries {
+		entries[i].Tags = []string{}
+		byID[entries[i].ID] = &entries[i]
+	}
+	for start := 0; start < len(entries); start += idBatchSize {
+		batch := entries[start:min(start+idBatchSize, len(entries))]
+		args := make([]any, len(batch))
+		for i, e := range batch {
+			args[i] = e.ID
+		}
+		rows, err := q.QueryContext(ctx,
+			`SELECT et.entry_id, t.name FROM entry_tags et JOIN tags t ON t.id = et.tag_id
+			 WHERE et.entry_id IN (?`+strings.Repeat(", ?", len(batch)-1)+`) ORDER BY et.entry_id, t.name`, args...,
+		)
+		if err != nil {
+			return fmt.Errorf("get tags: %w", err)
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return fmt.Errorf("get tags: %w", err)
+			}
+			e := byID[id]
+			e.Tags = append(e.Tags, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("get tags: %w", err)
+		}
+	}
+	return nil
+}
+
 // getTagsForEntry returns all tag names for a given entry.
 func getTagsForEntry(ctx context.Context, q querier, entryID int64) ([]string, error) {
 	rows, err := q.QueryContext(ctx,
@@ -0,0 +1,314 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Link types. Links are directed: "a supersedes b", "a depends-on b".
+const (
+	LinkRelated    = "related"
+	LinkSupersedes = "supersedes"
+	LinkDependsOn  = "depends-on"
+)
+
+// LinkTypes lists the valid link types.
+var LinkTypes = []string{LinkRelated, LinkSupersedes, LinkDependsOn}
+
+// MaxLinkDepth bounds how far GetRelated walks the link graph.
+const MaxLinkDepth = 5
+
+// Link is a typed, directed edge between two entries.
+type Link struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// RelatedEntry is an entry (without content) reached by walking links.
+// Depth is the number of links from the start entry; Via is the link it was reached through.
+type RelatedEntry struct {
+	Entry
+	Depth int  `json:"depth"`
+	Via   Link `json:"via"`
+}
+
+// ValidLinkType reports whether t is one of LinkTypes.
+func ValidLinkType(t string) bool {
+	for _, lt := range LinkTypes {
+		if t == lt {
+			return true
+		}
+	}
+	return false
+}
+
+// AddLink creates a link from one entry to another. Adding an existing link is a no-op.
+func (d *DB) AddLink(ctx context.Context, from, to, linkType string) error {
+	if !ValidLinkType(linkType) {
+		return fmt.Errorf("invalid link type %q (want one of %s)", linkType, strings.Join(LinkTypes, ", "))
+	}
+	if from == to {
+		return fmt.Errorf("cannot link entry %s to itself", from)
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	fromID, err := lookupEntryID(ctx, tx, from)
+	if err != nil {
+		return err
+	}
+	toID, err := lookupEntryID(ctx, tx, to)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO entry_links (from_id, to_id, type) VALUES (?, ?, ?)`, fromID, toID, linkType,
+	)
+	if err != nil {
+		return fmt.Errorf("add link: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return nil
+	}
+	if err := audit(ctx, tx, OpLink, from, linkType+":"+to, "", ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveLink deletes a link. It returns ErrNotFound if the link does not exist.
+func (d *DB) RemoveLink(ctx context.Context, from, to, linkType string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM entry_links
+		 WHERE from_id = (SELECT id FROM entries WHERE slug = ?)
+		   AND to_id = (SELECT id FROM entries WHERE slug = ?)
+		   AND type = ?`, from, to, linkType,
+	)
+	if err != nil {
+		return fmt.Errorf("remove link: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("link not found: %s %s %s: %w", from, linkType, to, ErrNotFound)
+	}
+	if err := audit(ctx, tx, OpUnlink, from, linkType+":"+to, "", ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListLinks returns the links from and to an entry, including those of draft
+// and proposed entries. Links to entries in the trash are left out.
+func (d *DB) ListLinks(ctx context.Context, slug string) ([]Link, error) {
+	entryID, err := lookupEntryID(ctx, d.read, slug)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := linksOf(ctx, d.read, []int64{entryID}, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]Link, 0, len(edges))
+	for _, e := range edges {
+		links = append(links, e.Link)
+	}
+	return links, nil
+}
+
+// GetRelated walks the link graph from an entry, following links in both
+// directions, up to depth hops (clamped to 1..MaxLinkDepth). If types is non-empty
+// only links of those types are followed. Each entry is returned once, at the
+// shortest depth it was found, ordered by depth then title. Draft and proposed
+// entries, including the start entry, are not found unless includeUnapproved is set.
+func (d *DB) GetRelated(ctx context.Context, slug string, depth int, types []string, includeUnapproved bool) ([]RelatedEntry, error) {
+	for _, t := range types {
+		if !ValidLinkType(t) {
+			return nil, fmt.Errorf("invalid link type %q (want one of %s)", t, strings.Join(LinkTypes, ", "))
+		}
+	}
+	depth = max(1, min(depth, MaxLinkDepth))
+
+	startID, err := lookupEntryID(ctx, d.read, slug)
+	if err != nil {
+		return nil, err
+	}
+	if !includeUnapproved {
+		var status string
+		if err := d.read.QueryRowContext(ctx, `SELECT status FROM entries WHERE id = ?`, startID).Scan(&status); err != nil {
+			return nil, fmt.Errorf("get status: %w", err)
+		}
+		if status != StatusApproved {
+			return nil, fmt.Errorf("entry not found: %s is %s and awaiting review: %w", slug, status, ErrNotFound)
+		}
+	}
+	seen := map[int64]bool{startID: true}
+	frontier := []int64{startID}
+	related := []RelatedEntry{}
+	// One links query per level, then one metadata query for all related entries.
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		edges, err := linksOf(ctx, d.read, frontier, types, includeUnapproved)
+		if err != nil {
+			return nil, err
+		}
+		var next []int64
+		for _, e := range edges {
+			// An edge between two frontier entries leads nowhere new, as both
+			// ends are already seen.
+			for _, other := range []int64{e.toID, e.fromID} {
+				if seen[other] {
+					continue
+				}
+				seen[other] = true
+				next = append(next, other)
+				related = append(related, RelatedEntry{Entry: Entry{ID: other}, Depth: level, Via: e.Link})
+			}
+		}
+		frontier = next
+	}
+
+	entries := make([]Entry, len(related))
+	for i := range related {
+		entries[i].ID = related[i].ID
+	}
+	if err := loadEntriesMeta(ctx, d.read, entries); err != nil {
+		return nil, err
+	}
+	for i := range related {
+		related[i].Entry = entries[i]
+	}
+	slices.SortStableFunc(related, func(a, b RelatedEntry) int {
+		if a.Depth != b.Depth {
+			return a.Depth - b.Depth
+		}
+		return strings.Compare(a.Title, b.Title)
+	})
+	return related, nil
+}
+
+type linkEdge struct {
+	Link
+	fromID, toID int64
+}
+
+// linksOf returns the links touching any of ids in either direction, skipping
+// trashed entries, and draft and proposed ones unless includeUnapproved is set.
+func linksOf(ctx context.Context, q querier, ids []int64, types []string, includeUnapproved bool) ([]linkEdge, error) {
+	var edges []linkEdge
+	for start := 0; start < len(ids); start += idBatchSize {
+		batch, err := linksOfBatch(ctx, q, ids[start:min(start+idBatchSize, len(ids))], types, includeUnapproved)
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, batch...)
+	}
+	return edges, nil
+}
+
+func linksOfBatch(ctx context.Context, q querier, ids []int64, types []string, includeUnapproved bool) ([]linkEdge, error) {
+	in := `(?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	query := `SELECT f.slug, t.slug, l.type, l.from_id, l.to_id
+		 FROM entry_links l
+		 JOIN entries f ON f.id = l.from_id
+		 JOIN entries t ON t.id = l.to_id
+		 WHERE (l.from_id IN ` + in + ` OR l.to_id IN ` + in + `) AND f.deleted_at IS NULL AND t.deleted_at IS NULL`
+	args := make([]any, 0, 2*len(ids)+len(types))
+	for range 2 {
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if !includeUnapproved {
+		query += ` AND f.status = 'approved' AND t.status = 'approved'`
+	}
+	if len(types) > 0 {
+		query += ` AND l.type IN (?` + strings.Repeat(", ?", len(types)-1) + `)`
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+	query += ` ORDER BY l.type, f.slug, t.slug`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	defer rows.Close()
+
+	var edges []linkEdge
+	for rows.Next() {
+		var e linkEdge
+		if err := rows.Scan(&e.From, &e.To, &e.Type, &e.fromID, &e.toID); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
+
+// loadEntriesMeta fills entries (identified by their ID) with metadata and
+// tags, but not content, with one query per batch of entries.
+func loadEntriesMeta(ctx context.Context, q querier, entries []Entry) error {
+	byID := make(map[int64]*Entry, len(entries))
+	for i := range entries {
+		byID[entries[i].ID] = &entries[i]
+	}
+	for start := 0; start < len(entries); start += idBatchSize {
+		batch := entries[start:min(start+idBatchSize, len(entries))]
+		args := make([]any, len(batch))
+		for i, e := range batch {
+			args[i] = e.ID
+		}
+		rows, err := q.QueryContext(ctx,
+			`SELECT id, slug, title, description, kind, language, domain, project, version, created_at, updated_at, review_after, expires_at, status
+			 FROM entries WHERE id IN (?`+strings.Repeat(", ?", len(batch)-1)+`)`, args...,
+		)
+		if err != nil {
+			return fmt.Errorf("get entries: %w", err)
+		}
+		for rows.Next() {
+			var m Entry
+			if err := rows.Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Kind, &m.Language, &m.Domain, &m.Project, &m.Version, &m.CreatedAt, &m.UpdatedAt, &m.ReviewAfter, &m.ExpiresAt, &m.Status); err != nil {
+				rows.Close()
+				return fmt.Errorf("get entries: %w", err)
+			}
+			*byID[m.ID] = m
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("get entries: %w", err)
+		}
+	}
+	return loadTags(ctx, q, entries)
+}
+
+// loadEntryMeta fills e (identified by e.ID) with metadata and tags, but not content.
+func loadEntryMeta(ctx context.Context, q *sql.DB, e *Entry) error {
+	if err := q.QueryRowContext(ctx,
+		`SELECT slug, title, description, kind, language, domain, project, version, created_at, updated_at, review_after, expires_at, status
+		 FROM entries WHERE id = ?`, e.ID,
+	).Scan(&e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status); err != nil {
+		return fmt.Errorf("get entry %d: %w", e.ID, err)
+	}
+	tags, err := getTagsForEntry(ctx, q, e.ID)
+	if err != nil {
+		return fmt.Errorf("get tags for entry %d: %w", e.ID, err)
+	}
+	e.Tags = tags
+	return nil
+}
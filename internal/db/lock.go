@@ -0,0 +1,271 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LockSpec is the scope of a write lock: the entries with the given project,
+// kind and tag. Empty fields match any entry, so the zero LockSpec locks the
+// whole database.
+type LockSpec struct {
+	Project string `json:"project,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// IsGlobal reports whether the lock covers every entry.
+func (l LockSpec) IsGlobal() bool {
+	return l == LockSpec{}
+}
+
+// Matches reports whether the lock covers e.
+func (l LockSpec) Matches(e *Entry) bool {
+	return (l.Project == "" || l.Project == e.Project) &&
+		(l.Kind == "" || l.Kind == e.Kind) &&
+		(l.Tag == "" || slices.Contains(e.Tags, l.Tag))
+}
+
+// String describes the scope, e.g. "project=api kind=rule", or "database"
+// for a global lock.
+func (l LockSpec) String() string {
+	var parts []string
+	for _, p := range [][2]string{{"project", l.Project}, {"kind", l.Kind}, {"tag", l.Tag}} {
+		if p[1] != "" {
+			parts = append(parts, p[0]+"="+p[1])
+		}
+	}
+	if len(parts) == 0 {
+		return "database"
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteLock is an active write lock.
+type WriteLock struct {
+	LockSpec
+	Reason string `json:"reason,omitempty"`
+	// Since is when the lock was taken, and ExpiresAt when it lifts on its
+	// own (empty for locks that last until unlocked); both UTC, as
+	// "YYYY-MM-DD HH:MM:SS".
+	Since     string `json:"since"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// LockOptions are the optional details of a lock.
+type LockOptions struct {
+	// Reason is shown to agents whose writes the lock rejects.
+	Reason string
+	// For is how long the lock lasts (0 = until unlocked).
+	For time.Duration
+}
+
+// LockEvent is one entry of the lock history: a lock taken, released, or
+// expired. At is when it happened (for expiry, the expiry time).
+type LockEvent struct {
+	ID    int64  `json:"id"`
+	Event string `json:"event"`
+	LockSpec
+	Reason    string `json:"reason,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	At        string `json:"at"`
+}
+
+// IsLocked returns true if the whole database is locked. Expired locks do not count.
+func (d *DB) IsLocked(ctx context.Context) (bool, error) {
+	locks, err := d.Locks(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(locks, func(l WriteLock) bool { return l.IsGlobal() }), nil
+}
+
+// Locks returns the active write locks, oldest first. Expired locks are left out.
+func (d *DB) Locks(ctx context.Context) ([]WriteLock, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT project, kind, tag, reason, created_at, COALESCE(expires_at, '') FROM lock
+		 WHERE expires_at IS NULL OR expires_at > datetime('now') ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("check lock: %w", err)
+	}
+	defer rows.Close()
+	var out []WriteLock
+	for rows.Next() {
+		var l WriteLock
+		if err := rows.Scan(&l.Project, &l.Kind, &l.Tag, &l.Reason, &l.Since, &l.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// Lock activates the global write lock with the given token. Fails if already locked.
+func (d *DB) Lock(ctx context.Context, token string) error {
+	return d.LockScope(ctx, LockSpec{}, token, LockOptions{})
+}
+
+// Unlock deactivates the global write lock. The provided token must match the one used to lock.
+func (d *DB) Unlock(ctx context.Context, token string) error {
+	return d.UnlockScope(ctx, LockSpec{}, token)
+}
+
+// LockScope locks the entries matching spec with the given token. Fails if
+// that scope is already locked; other scopes can be locked independently.
+func (d *DB) LockScope(ctx context.Context, spec LockSpec, token string, opts LockOptions) error {
+	if token == "" {
+		return fmt.Errorf("token must not be empty")
+	}
+	if opts.For < 0 {
+		return fmt.Errorf("lock duration must not be negative")
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := expireLocks(ctx, tx); err != nil {
+		return err
+	}
+	if _, err := lockToken(ctx, tx, spec); err == nil {
+		if spec.IsGlobal() {
+			return fmt.Errorf("database is already locked: %w", ErrLocked)
+		}
+		return fmt.Errorf("%s is already locked: %w", spec, ErrLocked)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	var expires any
+	if opts.For > 0 {
+		expires = time.Now().UTC().Add(opts.For).Format(time.DateTime)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO lock (project, kind, tag, token, reason, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		spec.Project, spec.Kind, spec.Tag, hashToken(token), opts.Reason, expires,
+	); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO lock_events (event, project, kind, tag, reason, expires_at) VALUES ('lock', ?, ?, ?, ?, ?)`,
+		spec.Project, spec.Kind, spec.Tag, opts.Reason, expires,
+	); err != nil {
+		return fmt.Errorf("lock event: %w", err)
+	}
+	return tx.Commit()
+}
+
+// UnlockScope removes the lock on spec. The provided token must match the
+// one used to lock it.
+func (d *DB) UnlockScope(ctx context.Context, spec LockSpec, token string) error {
+	if token == "" {
+		return fmt.Errorf("token must not be empty")
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := expireLocks(ctx, tx); err != nil {
+		return err
+	}
+	storedHash, err := lockToken(ctx, tx, spec)
+	if errors.Is(err, sql.ErrNoRows) {
+		if spec.IsGlobal() {
+			return fmt.Errorf("database is not locked")
+		}
+		return fmt.Errorf("%s is not locked", spec)
+	} else if err != nil {
+		return err
+	}
+	if storedHash != hashToken(token) {
+		return fmt.Errorf("invalid token")
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO lock_events (event, project, kind, tag, reason, expires_at)
+		 SELECT 'unlock', project, kind, tag, reason, expires_at FROM lock WHERE project = ? AND kind = ? AND tag = ?`,
+		spec.Project, spec.Kind, spec.Tag,
+	); err != nil {
+		return fmt.Errorf("lock event: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM lock WHERE project = ? AND kind = ? AND tag = ?`, spec.Project, spec.Kind, spec.Tag,
+	); err != nil {
+		return fmt.Errorf("unlock: %w", err)
+	}
+	return tx.Commit()
+}
+
+// LockHistory returns the most recent lock events, newest first. Locks
+// that have expired since the last lock or unlock are recorded first.
+func (d *DB) LockHistory(ctx context.Context, limit int) ([]LockEvent, error) {
+	if err := d.ExpireLocks(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, event, project, kind, tag, reason, COALESCE(expires_at, ''), created_at
+		 FROM lock_events ORDER BY created_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("lock history: %w", err)
+	}
+	defer rows.Close()
+	var out []LockEvent
+	for rows.Next() {
+		var e LockEvent
+		if err := rows.Scan(&e.ID, &e.Event, &e.Project, &e.Kind, &e.Tag, &e.Reason, &e.ExpiresAt, &e.At); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// ExpireLocks removes the locks past their expiry time and records their
+// expiry in the lock history. Expired locks stop applying on their own; this
+// only cleans them up.
+func (d *DB) ExpireLocks(ctx context.Context) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+	if err := expireLocks(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func expireLocks(ctx context.Context, tx *sql.Tx) error {
+	const expired = `expires_at IS NOT NULL AND expires_at <= datetime('now')`
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO lock_events (event, project, kind, tag, reason, expires_at, created_at)
+		 SELECT 'expire', project, kind, tag, reason, expires_at, expires_at FROM lock WHERE `+expired+` ORDER BY expires_at`,
+	); err != nil {
+		return fmt.Errorf("expire locks: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM lock WHERE `+expired); err != nil {
+		return fmt.Errorf("expire locks: %w", err)
+	}
+	return nil
+}
+
+// lockToken returns the token hash of the lock on exactly spec, or sql.ErrNoRows.
+func lockToken(ctx context.Context, q rowQuerier, spec LockSpec) (string, error) {
+	var hash string
+	err := q.QueryRowContext(ctx,
+		`SELECT token FROM lock WHERE project = ? AND kind = ? AND tag = ?`, spec.Project, spec.Kind, spec.Tag,
+	).Scan(&hash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("read lock: %w", err)
+	}
+	return hash, err
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer mcpedia binary.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one ordered schema step. The schema version of a database is
+// stored in PRAGMA user_version and equals the number of applied migrations.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	sql     string
+}
+
+var migrations = mustLoadMigrations()
+
+// migrationHooks run after the SQL of the migration with the same version, in
+// the same transaction, for data changes that cannot be expressed in SQL.
+var migrationHooks = map[int]func(context.Context, *sql.Tx) error{
+	5: backfillRefs,
+	6: backfillVectors,
+}
+
+// Migrations returns all migrations known to this binary, in order.
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// LatestVersion returns the schema version this binary migrates to.
+func LatestVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns the schema version of the open database.
+func (d *DB) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, d.db)
+}
+
+// Migrate applies pending migrations up to and including version target.
+// Migrating down is not supported.
+func (d *DB) Migrate(ctx context.Context, target int) error {
+	return migrate(ctx, d.db, target)
+}
+
+// mustLoadMigrations reads the embedded NNNN_name.sql files. Versions must start
+// at 1 and have no gaps; anything else is a build mistake, so it panics.
+func mustLoadMigrations() []Migration {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(names)
+	out := make([]Migration, 0, len(names))
+	for i, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".sql")
+		num, label, ok := strings.Cut(base, "_")
+		if !ok {
+			panic(fmt.Sprintf("migration %s: name must be NNNN_name.sql", name))
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil || version != i+1 {
+			panic(fmt.Sprintf("migration %s: expected version %d", name, i+1))
+		}
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, Migration{Version: version, Name: label, sql: string(body)})
+	}
+	return out
+}
+
+func schemaVersion(ctx context.Context, q rowQuerier) (int, error) {
+	var v int
+	if err := q.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return v, nil
+}
+
+// migrate applies migrations (current, target] in a single transaction.
+func migrate(ctx context.Context, sqlDB *sql.DB, target int) error {
+	if target > len(migrations) {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", target, len(migrations))
+	}
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		if err := checkBaseline(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("schema version %d, binary supports up to %d: %w", current, len(migrations), ErrSchemaTooNew)
+	}
+	if target < current {
+		return fmt.Errorf("cannot migrate down from schema version %d to %d", current, target)
+	}
+
+	for _, m := range migrations[current:target] {
+		if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if hook := migrationHooks[m.Version]; hook != nil {
+			if err := hook(ctx, tx); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+			}
+		}
+	}
+	// PRAGMA does not accept bound parameters; target is an int we validated above.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", target)); err != nil {
+		return fmt.Errorf("set schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// baselineColumns are the columns of entries in databases created before
+// versioned migrations.
+var baselineColumns = []string{
+	"id", "slug", "title", "description", "content", "kind", "language",
+	"domain", "project", "version", "created_at", "updated_at",
+}
+
+// baselineTables are the tables such databases may have. Migration 1 is
+// written with IF NOT EXISTS, so it adopts them as-is.
+var baselineTables = []string{"entries", "tags", "entry_tags", "entry_stats", "lock", "entries_fts"}
+
+// checkBaseline verifies that a database at schema version 0 is either new
+// or has the schema mcpedia used before versioned migrations. Anything else
+// was changed by hand, and migrating it could lose data.
+func checkBaseline(ctx context.Context, q querier) error {
+	tables, err := queryStrings(ctx, q,
+		`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'entries_fts_%' ORDER BY name`)
+	if err != nil {
+		return fmt.Errorf("inspect schema: %w", err)
+	}
+	for _, t := range tables {
+		if !slices.Contains(baselineTables, t) {
+			return fmt.Errorf("unrecognized schema at version 0: unexpected table %s", t)
+		}
+	}
+	columns, err := queryStrings(ctx, q, `SELECT name FROM pragma_table_info('entries') ORDER BY cid`)
+	if err != nil {
+		return fmt.Errorf("inspect schema: %w", err)
+	}
+	if len(columns) > 0 && !slices.Equal(columns, baselineColumns) {
+		return fmt.Errorf("unrecognized schema at version 0: entries has columns %s", strings.Join(columns, ", "))
+	}
+	return nil
+}
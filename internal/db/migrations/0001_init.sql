@@ -1,8 +1,11 @@
--- MCPedia schema
+-- MCPedia base schema.
 -- Set these PRAGMAs at connection time, not here:
 --   PRAGMA journal_mode=WAL;
 --   PRAGMA foreign_keys=ON;
 --   PRAGMA busy_timeout=5000;
+--
+-- Statements use IF NOT EXISTS so databases created before migrations
+-- existed can adopt this step as-is.
 
 CREATE TABLE IF NOT EXISTS entries (
     id          INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -57,6 +60,7 @@ CREATE INDEX IF NOT EXISTS idx_entries_kind     ON entries(kind);
 CREATE INDEX IF NOT EXISTS idx_entries_project  ON entries(project);
 CREATE INDEX IF NOT EXISTS idx_tags_name        ON tags(name);
 
--- FTS5 virtual table for full-text search
--- Note: FTS5 does not support IF NOT EXISTS, so we handle this in Go code
--- by checking if the table already exists before creating it.
+-- FTS5 table for full-text search.
+-- We use a standalone FTS5 table (not external content) and manage sync manually
+-- in CreateEntry/UpdateEntry/PurgeEntry for maximum reliability.
+CREATE VIRTUAL TABLE IF NOT EXISTS entries_fts USING fts5(title, description, content);
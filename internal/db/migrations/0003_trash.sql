@@ -0,0 +1,2 @@
+-- Soft delete: set while the entry is in the trash
+ALTER TABLE entries ADD COLUMN deleted_at TEXT;
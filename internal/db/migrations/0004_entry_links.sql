@@ -0,0 +1,11 @@
+-- Typed, directed relationships between entries
+CREATE TABLE IF NOT EXISTS entry_links (
+    from_id    INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    to_id      INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    type       TEXT NOT NULL CHECK (type IN ('related', 'supersedes', 'depends-on')),
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (from_id, to_id, type),
+    CHECK (from_id != to_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_entry_links_to ON entry_links(to_id);
@@ -0,0 +1,10 @@
+-- Slugs referenced from entry content as [[slug]] or mcpedia://entries/<slug>.
+-- Targets are stored by slug so references to entries that do not exist yet
+-- resolve as soon as the entry is created. Existing entries are backfilled in Go.
+CREATE TABLE IF NOT EXISTS entry_refs (
+    entry_id    INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    target_slug TEXT NOT NULL,
+    PRIMARY KEY (entry_id, target_slug)
+);
+
+CREATE INDEX IF NOT EXISTS idx_entry_refs_target ON entry_refs(target_slug);
@@ -0,0 +1,6 @@
+-- Local embeddings for semantic search (see internal/semantic). Existing
+-- entries are backfilled in Go.
+CREATE TABLE IF NOT EXISTS entry_vectors (
+    entry_id INTEGER PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+    vector   BLOB NOT NULL
+);
@@ -0,0 +1,10 @@
+-- Content of entries over 32 KB, split on Markdown headings. Such entries
+-- keep an empty entries.content; smaller entries have no rows here.
+CREATE TABLE IF NOT EXISTS entry_sections (
+    entry_id INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    heading  TEXT NOT NULL DEFAULT '',
+    level    INTEGER NOT NULL DEFAULT 0,
+    content  TEXT NOT NULL CHECK(length(content) <= 32768),
+    PRIMARY KEY (entry_id, position)
+);
@@ -0,0 +1,10 @@
+-- Files attached to entries (diagrams, sample configs, fixtures), kept out
+-- of the Markdown content and served as blob resources.
+CREATE TABLE IF NOT EXISTS entry_attachments (
+    entry_id   INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+    name       TEXT NOT NULL,
+    mime_type  TEXT NOT NULL,
+    data       BLOB NOT NULL CHECK(length(data) <= 1048576),
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    PRIMARY KEY (entry_id, name)
+);
@@ -0,0 +1,17 @@
+-- Scoped write locks: each row locks the entries matching its project, kind
+-- and tag (empty = any), so a row with no scope locks the whole database.
+-- Replaces the single-row lock table; an active lock becomes a global one.
+CREATE TABLE lock_scopes (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    project    TEXT NOT NULL DEFAULT '',
+    kind       TEXT NOT NULL DEFAULT '',
+    tag        TEXT NOT NULL DEFAULT '',
+    token      TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+    UNIQUE (project, kind, tag)
+);
+
+INSERT INTO lock_scopes (token) SELECT token FROM lock WHERE active = 1;
+
+DROP TABLE lock;
+ALTER TABLE lock_scopes RENAME TO lock;
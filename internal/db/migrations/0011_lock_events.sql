@@ -0,0 +1,15 @@
+-- Why a lock was taken and when it lifts on its own, plus the history of
+-- locks taken, released and expired.
+ALTER TABLE lock ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE lock ADD COLUMN expires_at TEXT;
+
+CREATE TABLE IF NOT EXISTS lock_events (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    event      TEXT NOT NULL CHECK(event IN ('lock', 'unlock', 'expire')),
+    project    TEXT NOT NULL DEFAULT '',
+    kind       TEXT NOT NULL DEFAULT '',
+    tag        TEXT NOT NULL DEFAULT '',
+    reason     TEXT NOT NULL DEFAULT '',
+    expires_at TEXT,
+    created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
@@ -0,0 +1,4 @@
+-- When an entry is due for review and when it stops applying, as
+-- YYYY-MM-DD ('' = never).
+ALTER TABLE entries ADD COLUMN review_after TEXT NOT NULL DEFAULT '';
+ALTER TABLE entries ADD COLUMN expires_at TEXT NOT NULL DEFAULT '';
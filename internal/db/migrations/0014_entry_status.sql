@@ -0,0 +1,20 @@
+-- Review workflow: entries are live once approved. Drafts and proposed
+-- entries are hidden from retrieval until a human approves them.
+ALTER TABLE entries ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'
+    CHECK(status IN ('draft', 'proposed', 'approved'));
+
+-- Changes awaiting review: a new entry (create), or an update or delete of an
+-- approved entry, which stays as it is until the change is approved. fields
+-- is the JSON object of the fields an update sets, and base_version the
+-- version of the entry the change was proposed against.
+CREATE TABLE IF NOT EXISTS entry_proposals (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    entry_id     INTEGER NOT NULL UNIQUE REFERENCES entries(id) ON DELETE CASCADE,
+    operation    TEXT NOT NULL CHECK(operation IN ('create', 'update', 'delete')),
+    fields       TEXT NOT NULL DEFAULT '{}',
+    base_version INTEGER NOT NULL,
+    session_id   TEXT NOT NULL DEFAULT '',
+    client       TEXT NOT NULL DEFAULT '',
+    token        TEXT NOT NULL DEFAULT '',
+    created_at   TEXT NOT NULL DEFAULT (datetime('now'))
+);
@@ -0,0 +1,4 @@
+-- Revisions keep the review and expiry dates of the version they capture, so
+-- restoring a version brings its dates back too.
+ALTER TABLE entry_revisions ADD COLUMN review_after TEXT NOT NULL DEFAULT '';
+ALTER TABLE entry_revisions ADD COLUMN expires_at TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not produced by a previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects a window of results. Cursor is the NextCursor of the previous
+// page, or empty for the first page. A Limit of zero or less selects the
+// default page size of the method.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// EntryPage is one page of entries. Total counts all matching entries, not
+// only those on this page; NextCursor is empty on the last page.
+type EntryPage struct {
+	Entries    []Entry `json:"entries"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+const offsetCursorPrefix = "offset:"
+
+// window returns the limit (def if unset, capped at max) and offset of p.
+func (p Page) window(def, max int) (limit, offset int, err error) {
+	limit = p.Limit
+	if limit <= 0 {
+		limit = def
+	}
+	limit = min(limit, max)
+	if p.Cursor == "" {
+		return limit, 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil || !strings.HasPrefix(string(raw), offsetCursorPrefix) {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, p.Cursor)
+	}
+	offset, err = strconv.Atoi(strings.TrimPrefix(string(raw), offsetCursorPrefix))
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, p.Cursor)
+	}
+	return limit, offset, nil
+}
+
+// newEntryPage builds the page that starts at offset, with a cursor to the next one if any remain.
+func newEntryPage(entries []Entry, total, offset int) *EntryPage {
+	if entries == nil {
+		entries = []Entry{}
+	}
+	p := &EntryPage{Entries: entries, Total: total}
+	if next := offset + len(entries); len(entries) > 0 && next < total {
+		p.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(offsetCursorPrefix + strconv.Itoa(next)))
+	}
+	return p
+}
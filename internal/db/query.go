@@ -0,0 +1,264 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned when a search query cannot be parsed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query is a parsed search query. See ParseQuery for the syntax.
+type Query struct {
+	// match is the FTS5 expression every result must match ("" if none).
+	match string
+	// exclude is an FTS5 expression no result may match ("" if none).
+	exclude string
+	// text is the plain text of the required terms, for semantic ranking.
+	text  string
+	conds []queryCond
+}
+
+// queryCond is a qualifier that filters on an entry column or tag.
+type queryCond struct {
+	field  string // kind, language, domain, project, or tag
+	value  string
+	prefix bool
+	negate bool
+}
+
+// queryQualifiers maps the accepted qualifier names to fields.
+var queryQualifiers = map[string]string{
+	"title":    "title",
+	"tag":      "tag",
+	"lang":     "language",
+	"language": "language",
+	"kind":     "kind",
+	"domain":   "domain",
+	"project":  "project",
+}
+
+// ParseQuery parses the search syntax:
+//
+//	error handling         entries containing both words (anywhere)
+//	"error handling"       the exact phrase
+//	title:result           the word in the title only (also title:"a phrase")
+//	handl*                 words starting with a prefix
+//	panic OR unwrap        either word
+//	-unsafe                entries not containing the word (also -"a phrase", -tag:x)
+//	tag:rust kind:skill    filters; also lang:, domain:, project:; tag: may repeat
+//
+// Every term is quoted before it reaches FTS5, so punctuation in terms is
+// matched literally rather than read as FTS5 syntax. A query may consist of
+// filters only.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	var groups [][]string // OR-groups of required FTS terms, ANDed together
+	var excluded, text []string
+	for i, t := range tokens {
+		if t.or {
+			if i == 0 || i == len(tokens)-1 || !tokens[i-1].isRequiredText() || !tokens[i+1].isRequiredText() {
+				return nil, fmt.Errorf("%w: OR must stand between two search terms", ErrInvalidQuery)
+			}
+			continue
+		}
+		if !t.isText() {
+			q.conds = append(q.conds, queryCond{field: t.field, value: t.value, prefix: t.prefix, negate: t.negate})
+			continue
+		}
+		if !hasWordChars(t.value) {
+			// Nothing FTS5 could index, e.g. a stray "-" or "&&"
+			continue
+		}
+		term := ftsTerm(t)
+		switch {
+		case t.negate:
+			excluded = append(excluded, term)
+		case i > 0 && tokens[i-1].or && len(groups) > 0:
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+			text = append(text, t.value)
+		default:
+			groups = append(groups, []string{term})
+			text = append(text, t.value)
+		}
+	}
+
+	parts := make([]string, 0, len(groups))
+	for _, g := range groups {
+		if len(g) == 1 {
+			parts = append(parts, g[0])
+		} else {
+			parts = append(parts, "("+strings.Join(g, " OR ")+")")
+		}
+	}
+	q.match = strings.Join(parts, " AND ")
+	q.exclude = strings.Join(excluded, " OR ")
+	q.text = strings.Join(text, " ")
+	if q.match == "" && q.exclude == "" && len(q.conds) == 0 {
+		return nil, fmt.Errorf("%w: no search terms or filters", ErrInvalidQuery)
+	}
+	return q, nil
+}
+
+// clauses returns the WHERE conditions and arguments for the query's
+// qualifiers and exclusions, for queries over entries aliased as e.
+func (q *Query) clauses() (wheres []string, args []any) {
+	for _, c := range q.conds {
+		op, val := "=", c.value
+		if c.prefix {
+			op, val = "LIKE", escapeLike(c.value)+"%"
+		}
+		var cond string
+		if c.field == "tag" {
+			cond = `EXISTS (SELECT 1 FROM entry_tags et JOIN tags t ON t.id = et.tag_id WHERE et.entry_id = e.id AND t.name ` + op + ` ?` + likeEscape(c.prefix) + `)`
+		} else {
+			cond = "e." + c.field + " " + op + " ?" + likeEscape(c.prefix)
+		}
+		if c.negate {
+			cond = "NOT " + cond
+		}
+		wheres = append(wheres, cond)
+		args = append(args, val)
+	}
+	if q.exclude != "" {
+		wheres = append(wheres, `e.id NOT IN (SELECT rowid FROM entries_fts WHERE entries_fts MATCH ?)`)
+		args = append(args, q.exclude)
+	}
+	return wheres, args
+}
+
+type queryToken struct {
+	field  string // "" for plain text, "title", or a filter field
+	value  string
+	phrase bool
+	prefix bool
+	negate bool
+	or     bool
+}
+
+func (t queryToken) isText() bool {
+	return !t.or && (t.field == "" || t.field == "title")
+}
+
+func (t queryToken) isRequiredText() bool {
+	return t.isText() && !t.negate
+}
+
+func lexQuery(s string) ([]queryToken, error) {
+	r := []rune(s)
+	var tokens []queryToken
+	i := 0
+	for {
+		for i < len(r) && unicode.IsSpace(r[i]) {
+			i++
+		}
+		if i >= len(r) {
+			return tokens, nil
+		}
+		start := i
+		var t queryToken
+		if r[i] == '-' && i+1 < len(r) && !unicode.IsSpace(r[i+1]) {
+			t.negate = true
+			i++
+		}
+		// A qualifier is a known name followed by ':'; anything else with a
+		// colon (std::io, http://...) is an ordinary term.
+		j := i
+		for j < len(r) && unicode.IsLetter(r[j]) {
+			j++
+		}
+		if j > i && j < len(r) && r[j] == ':' {
+			if field, ok := queryQualifiers[strings.ToLower(string(r[i:j]))]; ok {
+				t.field = field
+				i = j + 1
+			}
+		}
+
+		if i < len(r) && r[i] == '"' {
+			end := i + 1
+			for end < len(r) && r[end] != '"' {
+				end++
+			}
+			if end >= len(r) {
+				return nil, fmt.Errorf("%w: unterminated quote at position %d", ErrInvalidQuery, i+1)
+			}
+			t.value, t.phrase = strings.TrimSpace(string(r[i+1:end])), true
+			i = end + 1
+			if i < len(r) && r[i] == '*' {
+				t.prefix = true
+				i++
+			}
+			if i < len(r) && !unicode.IsSpace(r[i]) {
+				return nil, fmt.Errorf("%w: unexpected %q after closing quote at position %d", ErrInvalidQuery, r[i], i+1)
+			}
+			if t.value == "" {
+				return nil, fmt.Errorf("%w: empty phrase at position %d", ErrInvalidQuery, start+1)
+			}
+		} else {
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) {
+				j++
+			}
+			t.value = string(r[i:j])
+			i = j
+			if strings.HasSuffix(t.value, "*") {
+				t.value, t.prefix = strings.TrimRight(t.value, "*"), true
+			}
+			if t.value == "" && t.field != "" {
+				return nil, fmt.Errorf("%w: %s needs a value at position %d", ErrInvalidQuery, string(r[start:i]), start+1)
+			}
+		}
+
+		if t.field == "" && !t.phrase && !t.negate && !t.prefix {
+			switch t.value {
+			case "OR":
+				t.or = true
+			case "AND":
+				continue // implicit
+			case "NOT":
+				return nil, fmt.Errorf("%w: use -term instead of NOT to exclude a term", ErrInvalidQuery)
+			}
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+// ftsTerm renders a text token as a quoted FTS5 phrase, so its characters are
+// never interpreted as FTS5 operators.
+func ftsTerm(t queryToken) string {
+	term := `"` + strings.ReplaceAll(t.value, `"`, `""`) + `"`
+	if t.prefix {
+		term += "*"
+	}
+	if t.field == "title" {
+		term = "title : " + term
+	}
+	return term
+}
+
+func hasWordChars(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func likeEscape(prefix bool) string {
+	if prefix {
+		return ` ESCAPE '\'`
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in      string
+		match   string
+		exclude string
+		text    string
+		conds   []queryCond
+	}{
+		{in: "error handling", match: `"error" AND "handling"`, text: "error handling"},
+		{in: `"error handling" rust`, match: `"error handling" AND "rust"`, text: "error handling rust"},
+		{in: "title:result", match: `title : "result"`, text: "result"},
+		{in: `title:"error handling"`, match: `title : "error handling"`, text: "error handling"},
+		{in: "handl*", match: `"handl"*`, text: "handl"},
+		{in: "panic OR unwrap rust", match: `("panic" OR "unwrap") AND "rust"`, text: "panic unwrap rust"},
+		{in: "rust -unsafe -title:ffi", match: `"rust"`, exclude: `"unsafe" OR title : "ffi"`, text: "rust"},
+		{in: "say don't well-known std::io", match: `"say" AND "don't" AND "well-known" AND "std::io"`, text: "say don't well-known std::io"},
+		{in: `a"b c`, match: `"a""b" AND "c"`, text: `a"b c`},
+		{in: "or and - &&", match: `"or" AND "and"`, text: "or and"},
+		{in: "tag:rust tag:errors kind:skill", conds: []queryCond{
+			{field: "tag", value: "rust"}, {field: "tag", value: "errors"}, {field: "kind", value: "skill"},
+		}},
+		{in: `Lang:go -project:old domain:back* x`, match: `"x"`, text: "x", conds: []queryCond{
+			{field: "language", value: "go"}, {field: "project", value: "old", negate: true}, {field: "domain", value: "back", prefix: true},
+		}},
+		{in: "foo:bar", match: `"foo:bar"`, text: "foo:bar"},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.in, err)
+			continue
+		}
+		if q.match != tt.match || q.exclude != tt.exclude || q.text != tt.text || !slices.Equal(q.conds, tt.conds) {
+			t.Errorf("ParseQuery(%q):\n got match=%s exclude=%s text=%q conds=%v\nwant match=%s exclude=%s text=%q conds=%v",
+				tt.in, q.match, q.exclude, q.text, q.conds, tt.match, tt.exclude, tt.text, tt.conds)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for in, want := range map[string]string{
+		`"error handling`: "invalid query: unterminated quote at position 1",
+		`rust title:"err`: "invalid query: unterminated quote at position 12",
+		`"a"b`:            `invalid query: unexpected 'b' after closing quote at position 4`,
+		`""`:              "invalid query: empty phrase at position 1",
+		`tag:`:            "invalid query: tag: needs a value at position 1",
+		`OR rust`:         "invalid query: OR must stand between two search terms",
+		`rust OR`:         "invalid query: OR must stand between two search terms",
+		`rust OR tag:x`:   "invalid query: OR must stand between two search terms",
+		`rust OR -go`:     "invalid query: OR must stand between two search terms",
+		`rust NOT go`:     "invalid query: use -term instead of NOT to exclude a term",
+		`   `:             "invalid query: no search terms or filters",
+		`&& ||`:           "invalid query: no search terms or filters",
+	} {
+		_, err := ParseQuery(in)
+		if !errors.Is(err, ErrInvalidQuery) || err.Error() != want {
+			t.Errorf("ParseQuery(%q): got %v, want %q", in, err, want)
+		}
+	}
+}
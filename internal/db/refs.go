@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DanglingRef is a reference from an entry's content to a slug with no live entry.
+type DanglingRef struct {
+	Slug   string `json:"slug"`
+	Target string `json:"target"`
+}
+
+var (
+	// [[slug]] or [[slug|label]]
+	wikiLinkRe = regexp.MustCompile(`\[\[\s*([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\|[^\]]*)?\]\]`)
+	// mcpedia://entries/<slug>, stopping at any character that cannot be part of a slug
+	uriRefRe = regexp.MustCompile(`mcpedia://entries/([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+	fencedCodeRe = regexp.MustCompile("(?ms)^\\s*```.*?^\\s*```")
+	inlineCodeRe = regexp.MustCompile("`[^`\n]*`")
+)
+
+// ParseRefs returns the slugs referenced in markdown content as [[slug]] or
+// mcpedia://entries/<slug>, sorted and without duplicates. References inside
+// code blocks and inline code are ignored.
+func ParseRefs(content string) []string {
+	content = fencedCodeRe.ReplaceAllString(content, "")
+	content = inlineCodeRe.ReplaceAllString(content, "")
+
+	seen := map[string]bool{}
+	var refs []string
+	for _, re := range []*regexp.Regexp{wikiLinkRe, uriRefRe} {
+		for _, m := range re.FindAllStringSubmatch(content, -1) {
+			// Trailing dots come from prose ("see mcpedia://entries/foo.")
+			slug := strings.TrimRight(m[1], ".")
+			if slug != "" && !seen[slug] {
+				seen[slug] = true
+				refs = append(refs, slug)
+			}
+		}
+	}
+	slices.Sort(refs)
+	return refs
+}
+
+// DanglingRefs reports references to slugs that have no live entry, across all
+// live entries, ordered by source slug then target.
+func (d *DB) DanglingRefs(ctx context.Context) ([]DanglingRef, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT e.slug, r.target_slug FROM entry_refs r
+		 JOIN entries e ON e.id = r.entry_id
+		 WHERE e.deleted_at IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM entries t WHERE t.slug = r.target_slug AND t.deleted_at IS NULL)
+		 ORDER BY e.slug, r.target_slug`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dangling refs: %w", err)
+	}
+	defer rows.Close()
+
+	refs := []DanglingRef{}
+	for rows.Next() {
+		var r DanglingRef
+		if err := rows.Scan(&r.Slug, &r.Target); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		refs = append(refs, r)
+	}
+	return refs, rows.Err()
+}
+
+// setRefs replaces the references indexed for an entry within a transaction.
+func setRefs(ctx context.Context, tx *sql.Tx, entryID int64, slug, content string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entry_refs WHERE entry_id = ?`, entryID); err != nil {
+		return fmt.Errorf("delete refs: %w", err)
+	}
+	for _, target := range ParseRefs(content) {
+		if target == slug {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO entry_refs (entry_id, target_slug) VALUES (?, ?)`, entryID, target); err != nil {
+			return fmt.Errorf("insert ref %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// Backlinks returns the live entries that reference slug. Draft and proposed
+// entries are left out unless includeUnapproved is set.
+func (d *DB) Backlinks(ctx context.Context, slug string, includeUnapproved bool) ([]string, error) {
+	return backlinksOf(ctx, d.read, slug, includeUnapproved)
+}
+
+// getRefs returns the slugs an entry references (links) and the live,
+// approved entries that reference it (backlinks).
+func getRefs(ctx context.Context, q querier, entryID int64, slug string) (links, backlinks []string, err error) {
+	if links, err = queryStrings(ctx, q,
+		`SELECT target_slug FROM entry_refs WHERE entry_id = ? ORDER BY target_slug`, entryID); err != nil {
+		return nil, nil, fmt.Errorf("get links: %w", err)
+	}
+	if backlinks, err = backlinksOf(ctx, q, slug, false); err != nil {
+		return nil, nil, err
+	}
+	return links, backlinks, nil
+}
+
+func backlinksOf(ctx context.Context, q querier, slug string, includeUnapproved bool) ([]string, error) {
+	query := `SELECT e.slug FROM entry_refs r JOIN entries e ON e.id = r.entry_id
+		 WHERE r.target_slug = ? AND e.deleted_at IS NULL`
+	if !includeUnapproved {
+		query += ` AND e.status = 'approved'`
+	}
+	backlinks, err := queryStrings(ctx, q, query+` ORDER BY e.slug`, slug)
+	if err != nil {
+		return nil, fmt.Errorf("get backlinks: %w", err)
+	}
+	return backlinks, nil
+}
+
+func queryStrings(ctx context.Context, q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slugs []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		slugs = append(slugs, s)
+	}
+	return slugs, rows.Err()
+}
+
+// backfillRefs indexes references for every existing entry. It runs once, as
+// part of the migration that adds entry_refs.
+func backfillRefs(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, slug, content FROM entries`)
+	if err != nil {
+		return fmt.Errorf("list entries: %w", err)
+	}
+	type entryRefs struct {
+		id            int64
+		slug, content string
+	}
+	var entries []entryRefs
+	for rows.Next() {
+		var e entryRefs
+		if err := rows.Scan(&e.id, &e.slug, &e.content); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := setRefs(ctx, tx, e.id, e.slug, e.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Entry statuses. Only approved entries are live: drafts and proposed
+// entries are left out of lists, searches and context queries unless
+// Filter.IncludeUnapproved is set.
+const (
+	// StatusDraft marks entries a human is still writing.
+	StatusDraft = "draft"
+	// StatusProposed marks entries awaiting review, typically written by an agent.
+	StatusProposed = "proposed"
+	StatusApproved = "approved"
+)
+
+// Statuses are the valid values of Entry.Status.
+var Statuses = []string{StatusDraft, StatusProposed, StatusApproved}
+
+// Proposal is a change awaiting review: a new draft or proposed entry
+// (operation create), or an update or delete of an approved entry, which
+// stays as it is until the change is approved.
+type Proposal struct {
+	ID        int64  `json:"id"`
+	Slug      string `json:"slug"`
+	Operation string `json:"operation"`
+	// Status is the status of the entry: draft or proposed for a create,
+	// approved for an update or delete.
+	Status string `json:"status"`
+	// Fields are the fields an update sets, with the keys of UpdateEntry.
+	Fields map[string]any `json:"fields,omitempty"`
+	// BaseVersion is the version of the entry the change was proposed against.
+	BaseVersion int    `json:"base_version"`
+	Session     string `json:"session_id,omitempty"`
+	Client      string `json:"client,omitempty"`
+	Token       string `json:"token,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// Apply returns e as it is after the proposed update: e itself for a
+// create, and nil for a delete.
+func (p *Proposal) Apply(e *Entry) *Entry {
+	switch p.Operation {
+	case OpDelete:
+		return nil
+	case OpCreate:
+		return e
+	}
+	cp := *e
+	for key, dst := range map[string]*string{
+		"title": &cp.Title, "description": &cp.Description, "content": &cp.Content,
+		"kind": &cp.Kind, "language": &cp.Language, "domain": &cp.Domain, "project": &cp.Project,
+		"review_after": &cp.ReviewAfter, "expires_at": &cp.ExpiresAt,
+	} {
+		if v, ok := p.Fields[key].(string); ok {
+			*dst = v
+		}
+	}
+	if tags, ok := p.Fields["tags"].([]any); ok {
+		cp.Tags = []string{}
+		for _, t := range tags {
+			if s, ok := t.(string); ok {
+				cp.Tags = append(cp.Tags, s)
+			}
+		}
+	}
+	return &cp
+}
+
+func checkStatus(s string) error {
+	if !slices.Contains(Statuses, s) {
+		return fmt.Errorf("invalid status %q: use %s", s, strings.Join(Statuses, ", "))
+	}
+	return nil
+}
+
+// ProposeUpdate queues an update of an approved entry for review, with the
+// fields of UpdateEntry; the entry is unchanged until the update is
+// approved. It merges with an update of the same entry already awaiting
+// review, and replaces a pending delete. If expectedVersion is not 0 and
+// the entry is at another version, ErrConflict is returned.
+func (d *DB) ProposeUpdate(ctx context.Context, slug string, expectedVersion int, fields map[string]any) (*Proposal, error) {
+	if err := checkFieldDates(fields); err != nil {
+		return nil, err
+	}
+	return d.proposeChange(ctx, OpUpdate, slug, expectedVersion, fields)
+}
+
+// ProposeDelete queues the deletion of an approved entry for review,
+// replacing any change of it already awaiting review.
+func (d *DB) ProposeDelete(ctx context.Context, slug string, expectedVersion int) (*Proposal, error) {
+	return d.proposeChange(ctx, OpDelete, slug, expectedVersion, nil)
+}
+
+func (d *DB) proposeChange(ctx context.Context, op, slug string, expectedVersion int, fields map[string]any) (*Proposal, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	entryID, err := lookupEntryID(ctx, tx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(ctx, tx, entryID, slug, expectedVersion); err != nil {
+		return nil, err
+	}
+	var version int
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT version, status FROM entries WHERE id = ?`, entryID).Scan(&version, &status); err != nil {
+		return nil, fmt.Errorf("read entry: %w", err)
+	}
+	if status != StatusApproved {
+		return nil, fmt.Errorf("%s is %s, not approved: change it directly", slug, status)
+	}
+	pending, err := pendingProposal(ctx, tx, entryID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if op == OpUpdate && pending != nil && pending.Operation == OpUpdate {
+		// The earlier fields were proposed against the older base version
+		merged := map[string]any{}
+		maps.Copy(merged, pending.Fields)
+		maps.Copy(merged, fields)
+		fields, version = merged, pending.BaseVersion
+	}
+	if pending != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM entry_proposals WHERE entry_id = ?`, entryID); err != nil {
+			return nil, fmt.Errorf("replace proposal: %w", err)
+		}
+	}
+	if err := propose(ctx, tx, entryID, op, fields, version); err != nil {
+		return nil, err
+	}
+
+	current, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("read content: %w", err)
+	}
+	after := ""
+	if op == OpUpdate {
+		after = contentHash(current)
+		if content, ok := fields["content"].(string); ok {
+			after = contentHash(content)
+		}
+	}
+	if err := audit(ctx, tx, OpPropose, slug, op, contentHash(current), after); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return d.GetProposal(ctx, slug)
+}
+
+// propose records a change of entryID awaiting review, by the actor in ctx.
+func propose(ctx context.Context, tx *sql.Tx, entryID int64, op string, fields map[string]any, baseVersion int) error {
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("encode fields: %w", err)
+	}
+	a := actorFrom(ctx)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO entry_proposals (entry_id, operation, fields, base_version, session_id, client, token)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entryID, op, string(data), baseVersion, a.Session, a.Client, a.Token,
+	); err != nil {
+		return fmt.Errorf("propose: %w", err)
+	}
+	return nil
+}
+
+// ReviewQueue returns the changes awaiting review, oldest first. Changes of
+// entries in the trash are left out.
+func (d *DB) ReviewQueue(ctx context.Context) ([]Proposal, error) {
+	return queryProposals(ctx, d.read, "")
+}
+
+// GetProposal returns the change of an entry awaiting review, or an error
+// wrapping ErrNotFound if there is none.
+func (d *DB) GetProposal(ctx context.Context, slug string) (*Proposal, error) {
+	ps, err := queryProposals(ctx, d.read, " AND e.slug = ?", slug)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("no change of %s awaiting review: %w", slug, ErrNotFound)
+	}
+	return &ps[0], nil
+}
+
+func queryProposals(ctx context.Context, q querier, where string, args ...any) ([]Proposal, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT p.id, e.slug, p.operation, e.status, p.fields, p.base_version, p.session_id, p.client, p.token, p.created_at
+		 FROM entry_proposals p JOIN entries e ON e.id = p.entry_id
+		 WHERE e.deleted_at IS NULL`+where+` ORDER BY p.created_at, p.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("review queue: %w", err)
+	}
+	defer rows.Close()
+	var out []Proposal
+	for rows.Next() {
+		var p Proposal
+		var fields string
+		if err := rows.Scan(&p.ID, &p.Slug, &p.Operation, &p.Status, &fields, &p.BaseVersion,
+			&p.Session, &p.Client, &p.Token, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if err := json.Unmarshal([]byte(fields), &p.Fields); err != nil {
+			return nil, fmt.Errorf("decode fields of proposal %d: %w", p.ID, err)
+		}
+		if len(p.Fields) == 0 {
+			p.Fields = nil
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// pendingProposal returns the change of entryID awaiting review, or sql.ErrNoRows.
+func pendingProposal(ctx context.Context, tx *sql.Tx, entryID int64) (*Proposal, error) {
+	ps, err := queryProposals(ctx, tx, " AND p.entry_id = ?", entryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &ps[0], nil
+}
+
+// Approve makes the change of an entry awaiting review: a draft or proposed
+// entry becomes approved, and a proposed update or delete is applied. A
+// proposed change fails with ErrConflict if the entry was changed since it
+// was proposed, unless force is set.
+func (d *DB) Approve(ctx context.Context, slug string, force bool) error {
+	defer d.cache.clear()
+	return d.review(ctx, slug, func(tx *sql.Tx, entryID int64, p *Proposal) error {
+		base := p.BaseVersion
+		if force {
+			base = 0
+		}
+		switch p.Operation {
+		case OpUpdate:
+			return updateEntry(ctx, tx, OpApprove, OpUpdate, slug, base, p.Fields)
+		case OpDelete:
+			return deleteEntry(ctx, tx, OpApprove, OpDelete, slug, base)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE entries SET status = 'approved' WHERE id = ?`, entryID); err != nil {
+			return fmt.Errorf("approve: %w", err)
+		}
+		content, err := entryContent(ctx, tx, entryID)
+		if err != nil {
+			return fmt.Errorf("read content: %w", err)
+		}
+		return audit(ctx, tx, OpApprove, slug, OpCreate, "", contentHash(content))
+	})
+}
+
+// Reject discards the change of an entry awaiting review: a draft or
+// proposed entry is moved to the trash, and a proposed update or delete is
+// dropped, leaving the entry as it is.
+func (d *DB) Reject(ctx context.Context, slug string) error {
+	defer d.cache.clear()
+	return d.review(ctx, slug, func(tx *sql.Tx, entryID int64, p *Proposal) error {
+		if p.Operation == OpCreate {
+			return deleteEntry(ctx, tx, OpReject, OpCreate, slug, 0)
+		}
+		content, err := entryContent(ctx, tx, entryID)
+		if err != nil {
+			return fmt.Errorf("read content: %w", err)
+		}
+		return audit(ctx, tx, OpReject, slug, p.Operation, contentHash(content), contentHash(content))
+	})
+}
+
+// review runs decide on the change of slug awaiting review within a
+// transaction, then removes the change from the queue. Entries that are not
+// approved but have no change queued (e.g. restored from the trash after a
+// rejection) are reviewed as a create.
+func (d *DB) review(ctx context.Context, slug string, decide func(tx *sql.Tx, entryID int64, p *Proposal) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	entryID, err := lookupEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	p, err := pendingProposal(ctx, tx, entryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		var status string
+		if err := tx.QueryRowContext(ctx, `SELECT status FROM entries WHERE id = ?`, entryID).Scan(&status); err != nil {
+			return fmt.Errorf("read status: %w", err)
+		}
+		if status == StatusApproved {
+			return fmt.Errorf("no change of %s awaiting review: %w", slug, ErrNotFound)
+		}
+		p = &Proposal{Slug: slug, Operation: OpCreate, Status: status}
+	} else if err != nil {
+		return err
+	}
+	if err := decide(tx, entryID, p); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entry_proposals WHERE entry_id = ?`, entryID); err != nil {
+		return fmt.Errorf("dequeue proposal: %w", err)
+	}
+	return tx.Commit()
+}
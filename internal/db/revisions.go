@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Revision is a prior version of an entry, captured before each update.
+type Revision struct {
+	Version     int      `json:"version"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Content     string   `json:"content,omitempty"`
+	Kind        string   `json:"kind"`
+	Language    string   `json:"language"`
+	Domain      string   `json:"domain"`
+	Project     string   `json:"project"`
+	Tags        []string `json:"tags"`
+	ReviewAfter string   `json:"review_after,omitempty"`
+	ExpiresAt   string   `json:"expires_at,omitempty"`
+	// UpdatedAt is when this version was written; ArchivedAt is when it was replaced.
+	UpdatedAt  string `json:"updated_at"`
+	ArchivedAt string `json:"archived_at"`
+}
+
+// ListRevisions returns the prior versions of an entry, newest first, without content.
+func (d *DB) ListRevisions(ctx context.Context, slug string) ([]Revision, error) {
+	entryID, err := lookupEntryID(ctx, d.read, slug)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT version, title, description, kind, language, domain, project, tags, review_after, expires_at, updated_at, archived_at
+		 FROM entry_revisions WHERE entry_id = ? ORDER BY version DESC`, entryID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var r Revision
+		var tags string
+		if err := rows.Scan(&r.Version, &r.Title, &r.Description, &r.Kind, &r.Language, &r.Domain, &r.Project, &tags, &r.ReviewAfter, &r.ExpiresAt, &r.UpdatedAt, &r.ArchivedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if r.Tags, err = decodeTags(tags); err != nil {
+			return nil, fmt.Errorf("decode tags for version %d: %w", r.Version, err)
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// GetRevision returns a single prior version of an entry, including its content.
+func (d *DB) GetRevision(ctx context.Context, slug string, version int) (*Revision, error) {
+	return getRevision(ctx, d.read, slug, version)
+}
+
+// RestoreRevision makes a prior version the current content of the entry.
+// The restore is itself an update: the version number keeps increasing and the
+// content being replaced is kept as a new revision.
+func (d *DB) RestoreRevision(ctx context.Context, slug string, version int) error {
+	defer d.cache.clear()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, err := getRevision(ctx, tx, slug, version)
+	if err != nil {
+		return err
+	}
+	if err := updateEntry(ctx, tx, OpRestoreRevision, fmt.Sprintf("version %d", version), slug, 0, r.Fields()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Fields returns the update that brings an entry back to this version, with
+// the keys of UpdateEntry.
+func (r *Revision) Fields() map[string]any {
+	return map[string]any{
+		"title":        r.Title,
+		"description":  r.Description,
+		"content":      r.Content,
+		"kind":         r.Kind,
+		"language":     r.Language,
+		"domain":       r.Domain,
+		"project":      r.Project,
+		"tags":         r.Tags,
+		"review_after": r.ReviewAfter,
+		"expires_at":   r.ExpiresAt,
+	}
+}
+
+// rowQuerier is satisfied by *sql.DB and *sql.Tx for single-row queries.
+type rowQuerier interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+func lookupEntryID(ctx context.Context, q rowQuerier, slug string) (int64, error) {
+	var entryID int64
+	if err := q.QueryRowContext(ctx, `SELECT id FROM entries WHERE slug = ? AND deleted_at IS NULL`, slug).Scan(&entryID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("entry not found: %s: %w", slug, ErrNotFound)
+		}
+		return 0, fmt.Errorf("lookup: %w", err)
+	}
+	return entryID, nil
+}
+
+func getRevision(ctx context.Context, q rowQuerier, slug string, version int) (*Revision, error) {
+	entryID, err := lookupEntryID(ctx, q, slug)
+	if err != nil {
+		return nil, err
+	}
+	r := &Revision{}
+	var tags string
+	err = q.QueryRowContext(ctx,
+		`SELECT version, title, description, content, kind, language, domain, project, tags, review_after, expires_at, updated_at, archived_at
+		 FROM entry_revisions WHERE entry_id = ? AND version = ?`, entryID, version,
+	).Scan(&r.Version, &r.Title, &r.Description, &r.Content, &r.Kind, &r.Language, &r.Domain, &r.Project, &tags, &r.ReviewAfter, &r.ExpiresAt, &r.UpdatedAt, &r.ArchivedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("revision not found: %s version %d: %w", slug, version, ErrNotFound)
+		}
+		return nil, fmt.Errorf("get revision: %w", err)
+	}
+	if r.Tags, err = decodeTags(tags); err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+	return r, nil
+}
+
+// saveRevision copies the current state of an entry (including tags) into entry_revisions.
+func saveRevision(ctx context.Context, tx *sql.Tx, entryID int64) error {
+	tags, err := getTagsForEntry(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("get tags: %w", err)
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return fmt.Errorf("encode tags: %w", err)
+	}
+	// Revisions keep content whole, however the entry stores it
+	content, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("get content: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO entry_revisions (entry_id, version, title, description, content, kind, language, domain, project, tags, review_after, expires_at, updated_at)
+		 SELECT id, version, title, description, ?, kind, language, domain, project, ?, review_after, expires_at, updated_at
+		 FROM entries WHERE id = ?`, content, string(encoded), entryID,
+	)
+	return err
+}
+
+func decodeTags(s string) ([]string, error) {
+	tags := []string{}
+	if s == "" {
+		return tags, nil
+	}
+	if err := json.Unmarshal([]byte(s), &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
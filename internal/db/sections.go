@@ -0,0 +1,260 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pouriya/mcpedia/internal/sections"
+)
+
+const (
+	// maxSectionLen is the most content one row holds, in entries.content or
+	// entry_sections.content. Longer content is stored as sections.
+	maxSectionLen = 32768
+	// MaxContentLen is the largest entry content accepted.
+	MaxContentLen = 1 << 20
+)
+
+// ErrContentTooLarge is returned for content over MaxContentLen, or with a
+// single section over 32 KB.
+var ErrContentTooLarge = errors.New("content too large")
+
+// splitContent decides how content is stored: inline in entries.content when
+// it fits in one row, otherwise as sections with an empty inline content.
+func splitContent(content string) (inline string, secs []sections.Section, err error) {
+	if len(content) <= maxSectionLen {
+		return content, nil, nil
+	}
+	if len(content) > MaxContentLen {
+		return "", nil, fmt.Errorf("%w: %d bytes, max %d", ErrContentTooLarge, len(content), MaxContentLen)
+	}
+	secs = sections.Split(content)
+	for _, s := range secs {
+		if len(s.Content) > maxSectionLen {
+			name := s.Heading
+			if name == "" {
+				name = "(before the first heading)"
+			}
+			return "", nil, fmt.Errorf("%w: section %q is %d bytes, max %d; split it with subheadings",
+				ErrContentTooLarge, name, len(s.Content), maxSectionLen)
+		}
+	}
+	return "", secs, nil
+}
+
+// setSections replaces the stored sections of an entry within a transaction.
+func setSections(ctx context.Context, tx *sql.Tx, entryID int64, secs []sections.Section) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entry_sections WHERE entry_id = ?`, entryID); err != nil {
+		return err
+	}
+	for i, s := range secs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO entry_sections (entry_id, position, heading, level, content) VALUES (?, ?, ?, ?, ?)`,
+			entryID, i, s.Heading, s.Level, s.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSections returns the stored sections of the given entries, in order,
+// with one query per batch of entries. Entries stored inline have none.
+func loadSections(ctx context.Context, q querier, ids []int64) (map[int64][]sections.Section, error) {
+	out := map[int64][]sections.Section{}
+	for start := 0; start < len(ids); start += idBatchSize {
+		batch := ids[start:min(start+idBatchSize, len(ids))]
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := q.QueryContext(ctx,
+			`SELECT entry_id, heading, level, content FROM entry_sections
+			 WHERE entry_id IN (?`+strings.Repeat(", ?", len(batch)-1)+`) ORDER BY entry_id, position`, args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("get sections: %w", err)
+		}
+		for rows.Next() {
+			var id int64
+			var s sections.Section
+			if err := rows.Scan(&id, &s.Heading, &s.Level, &s.Content); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("get sections: %w", err)
+			}
+			out[id] = append(out[id], s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("get sections: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// loadContent fills in the content of entries stored as sections, which
+// come out of entries.content empty.
+func loadContent(ctx context.Context, q querier, entries []Entry) error {
+	var ids []int64
+	for _, e := range entries {
+		if e.Content == "" {
+			ids = append(ids, e.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	secs, err := loadSections(ctx, q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if s, ok := secs[entries[i].ID]; ok {
+			entries[i].Content = sections.Join(s)
+		}
+	}
+	return nil
+}
+
+// loadFullContent reads the content of entries, inline or from sections.
+func loadFullContent(ctx context.Context, q querier, entries []Entry) error {
+	for start := 0; start < len(entries); start += idBatchSize {
+		batch := entries[start:min(start+idBatchSize, len(entries))]
+		args := make([]any, len(batch))
+		for i, e := range batch {
+			args[i] = e.ID
+		}
+		rows, err := q.QueryContext(ctx,
+			`SELECT id, content FROM entries WHERE id IN (?`+strings.Repeat(", ?", len(batch)-1)+`)`, args...)
+		if err != nil {
+			return fmt.Errorf("get content: %w", err)
+		}
+		content := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var c string
+			if err := rows.Scan(&id, &c); err != nil {
+				rows.Close()
+				return fmt.Errorf("get content: %w", err)
+			}
+			content[id] = c
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("get content: %w", err)
+		}
+		for i := range batch {
+			batch[i].Content = content[batch[i].ID]
+		}
+	}
+	return loadContent(ctx, q, entries)
+}
+
+// entryContent returns the full content of an entry within a transaction.
+func entryContent(ctx context.Context, tx *sql.Tx, entryID int64) (string, error) {
+	e := []Entry{{ID: entryID}}
+	if err := tx.QueryRowContext(ctx, `SELECT content FROM entries WHERE id = ?`, entryID).Scan(&e[0].Content); err != nil {
+		return "", err
+	}
+	if err := loadContent(ctx, tx, e); err != nil {
+		return "", err
+	}
+	return e[0].Content, nil
+}
+
+// setSnippetSections points the keyword snippets of entries stored as
+// sections to the section they were taken from.
+func setSnippetSections(ctx context.Context, q querier, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	secs, err := loadSections(ctx, q, entryIDs(entries))
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if s, ok := secs[entries[i].ID]; ok {
+			entries[i].Section = snippetSection(s, entries[i].Snippet)
+		}
+	}
+	return nil
+}
+
+// snippetSection returns the heading of the section a snippet was taken
+// from, found by the line holding its first highlighted match (or the longest
+// fragment between ellipses when nothing is highlighted).
+func snippetSection(secs []sections.Section, snippet string) string {
+	if i := strings.Index(snippet, ">>>"); i >= 0 {
+		start := strings.LastIndex(snippet[:i], "\n") + 1
+		end := len(snippet)
+		if j := strings.Index(snippet[i:], "\n"); j >= 0 {
+			end = i + j
+		}
+		snippet = snippet[start:end]
+	}
+	snippet = strings.NewReplacer(">>>", "", "<<<", "").Replace(snippet)
+	frag := ""
+	for _, f := range strings.Split(snippet, "...") {
+		if f = strings.TrimSpace(f); len(f) > len(frag) {
+			frag = f
+		}
+	}
+	if frag == "" {
+		return ""
+	}
+	for _, s := range secs {
+		if strings.Contains(s.Content, frag) {
+			return s.Heading
+		}
+	}
+	return ""
+}
+
+// Outline is the table of contents of an entry.
+type Outline struct {
+	Slug     string             `json:"slug"`
+	Title    string             `json:"title"`
+	Sections []sections.Heading `json:"sections"`
+}
+
+// EntryOutline returns the table of contents of e's content.
+func EntryOutline(e *Entry) *Outline {
+	return &Outline{Slug: e.Slug, Title: e.Title, Sections: sections.Outline(sections.Split(e.Content))}
+}
+
+// EntrySection returns a copy of e with only one section of its content: the
+// first section whose heading matches heading (case-insensitively), including
+// its subsections. Section is set to the matched heading.
+func EntrySection(e *Entry, heading string) (*Entry, error) {
+	secs := sections.Split(e.Content)
+	start, end, ok := sections.Find(secs, heading)
+	if !ok {
+		return nil, fmt.Errorf("section not found: %s#%s: %w", e.Slug, heading, ErrNotFound)
+	}
+	cp := *e
+	cp.Content = sections.Join(secs[start:end])
+	cp.Section = secs[start].Heading
+	return &cp, nil
+}
+
+// GetEntrySection is GetEntry followed by EntrySection. It counts as a read
+// of the entry.
+func (d *DB) GetEntrySection(ctx context.Context, slug, heading string) (*Entry, error) {
+	e, err := d.GetEntry(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return EntrySection(e, heading)
+}
+
+// GetEntryOutline is GetEntry followed by EntryOutline. It counts as a read
+// of the entry.
+func (d *DB) GetEntryOutline(ctx context.Context, slug string) (*Outline, error) {
+	e, err := d.GetEntry(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return EntryOutline(e), nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Values of Entry.Stale.
+const (
+	// StaleReviewDue marks entries on or past their review date.
+	StaleReviewDue = "review_due"
+	// StaleExpired marks entries on or past their expiry date.
+	StaleExpired = "expired"
+)
+
+// ValidDate reports whether s is a review or expiry date: YYYY-MM-DD, or
+// empty for none.
+func ValidDate(s string) bool {
+	if s == "" {
+		return true
+	}
+	_, err := time.Parse(time.DateOnly, s)
+	return err == nil
+}
+
+func checkDate(s string) error {
+	if !ValidDate(s) {
+		return fmt.Errorf("invalid date %q: use YYYY-MM-DD", s)
+	}
+	return nil
+}
+
+// today returns the current UTC date, to compare with review and expiry dates.
+func today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+// staleness returns the Stale value of an entry with the given dates on day.
+// Expiry wins over review.
+func staleness(reviewAfter, expiresAt, day string) string {
+	switch {
+	case expiresAt != "" && expiresAt <= day:
+		return StaleExpired
+	case reviewAfter != "" && reviewAfter <= day:
+		return StaleReviewDue
+	}
+	return ""
+}
+
+// markStale sets Stale on entries. It runs on every read rather than when
+// entries are loaded, so cached entries go stale on time.
+func markStale(entries []Entry) {
+	day := today()
+	for i := range entries {
+		entries[i].Stale = staleness(entries[i].ReviewAfter, entries[i].ExpiresAt, day)
+	}
+}
+
+// notExpiredClause is the filter clause of Filter.ExcludeExpired.
+const notExpiredClause = `(e.expires_at = '' OR e.expires_at > ?)`
+
+// StaleEntries returns the entries due for review or expired, without
+// content, the longest overdue first.
+func (d *DB) StaleEntries(ctx context.Context) ([]Entry, error) {
+	day := today()
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, slug, title, description, kind, language, domain, project, version, created_at, updated_at, review_after, expires_at, status
+		 FROM entries
+		 WHERE deleted_at IS NULL AND ((review_after != '' AND review_after <= ?) OR (expires_at != '' AND expires_at <= ?))
+		 ORDER BY min(CASE WHEN review_after = '' THEN expires_at ELSE review_after END,
+		              CASE WHEN expires_at = '' THEN review_after ELSE expires_at END), slug`, day, day,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("stale entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadTags(ctx, d.read, entries); err != nil {
+		return nil, err
+	}
+	markStale(entries)
+	return entries, nil
+}
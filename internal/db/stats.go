@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultStatsFlushInterval is how often buffered read and search counts are
+// written when Options.StatsFlushInterval is not set.
+const DefaultStatsFlushInterval = 5 * time.Second
+
+// statsWriter buffers read and search counts in memory and writes them in one
+// transaction per flush, so reads do not each need a write to entry_stats.
+type statsWriter struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	pending map[int64]*statsDelta
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type statsDelta struct {
+	reads, searches          int
+	lastReadAt, lastSearchAt sql.NullString
+}
+
+// startStatsWriter starts a writer that flushes every interval until close is called.
+func startStatsWriter(db *sql.DB, interval time.Duration) *statsWriter {
+	w := &statsWriter{
+		db:      db,
+		pending: map[int64]*statsDelta{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop(interval)
+	return w
+}
+
+func (w *statsWriter) loop(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.flush(context.Background()); err != nil {
+				slog.Warn("flush stats", "err", err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// addReads counts a read of each entry.
+func (w *statsWriter) addReads(ids ...int64) {
+	now := sql.NullString{String: time.Now().UTC().Format(time.DateTime), Valid: true}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range ids {
+		d := w.delta(id)
+		d.reads++
+		d.lastReadAt = now
+	}
+}
+
+// addSearches counts a search hit for each entry.
+func (w *statsWriter) addSearches(ids ...int64) {
+	now := sql.NullString{String: time.Now().UTC().Format(time.DateTime), Valid: true}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range ids {
+		d := w.delta(id)
+		d.searches++
+		d.lastSearchAt = now
+	}
+}
+
+// delta returns the pending counts for id; w.mu must be held.
+func (w *statsWriter) delta(id int64) *statsDelta {
+	d, ok := w.pending[id]
+	if !ok {
+		d = &statsDelta{}
+		w.pending[id] = d
+	}
+	return d
+}
+
+// flush writes the buffered counts. Stats are best-effort: counts that fail
+// to write are dropped rather than retried.
+func (w *statsWriter) flush(ctx context.Context) error {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = map[int64]*statsDelta{}
+	w.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx,
+		`UPDATE entry_stats SET reads = reads + ?, searches = searches + ?,
+		 last_read_at = COALESCE(?, last_read_at), last_search_at = COALESCE(?, last_search_at)
+		 WHERE entry_id = ?`)
+	if err != nil {
+		return fmt.Errorf("prepare: %w", err)
+	}
+	defer stmt.Close()
+	for id, d := range pending {
+		if _, err := stmt.ExecContext(ctx, d.reads, d.searches, d.lastReadAt, d.lastSearchAt, id); err != nil {
+			return fmt.Errorf("update stats for entry %d: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// close stops the flush loop and writes what is still buffered.
+func (w *statsWriter) close() error {
+	close(w.stop)
+	<-w.done
+	return w.flush(context.Background())
+}
+
+// FlushStats writes buffered read and search counts now. Counts are otherwise
+// written every Options.StatsFlushInterval and on Close, so GetStats may lag
+// behind recent reads until then.
+func (d *DB) FlushStats(ctx context.Context) error {
+	return d.stats.flush(ctx)
+}
+
+func entryIDs(entries []Entry) []int64 {
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
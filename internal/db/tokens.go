@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Token roles, from least to most privileged.
+const (
+	// RoleRead allows searching and reading entries.
+	RoleRead = "read"
+	// RoleWrite also allows creating, updating, deleting and restoring entries.
+	RoleWrite = "write"
+	// RoleAdmin is write access that is never limited by scopes.
+	RoleAdmin = "admin"
+)
+
+// Roles lists the valid token roles, from least to most privileged.
+var Roles = []string{RoleRead, RoleWrite, RoleAdmin}
+
+// ErrInvalidToken is returned by Authenticate for unknown and revoked tokens.
+var ErrInvalidToken = errors.New("invalid token")
+
+// tokenPrefix starts every generated token, so leaked tokens are easy to spot.
+const tokenPrefix = "mcpedia_"
+
+// APIToken describes a bearer token for the MCP server. The token itself is
+// only known when it is created; the database keeps its hash.
+type APIToken struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Project and Kind, when set, limit the entries a write token may change.
+	Project   string `json:"project,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+// Allows reports whether t has at least the given role.
+func (t *APIToken) Allows(role string) bool {
+	return slices.Index(Roles, t.Role) >= slices.Index(Roles, role)
+}
+
+// Covers reports whether t may change an entry of the given kind and project.
+func (t *APIToken) Covers(kind, project string) bool {
+	if t.Role == RoleAdmin {
+		return true
+	}
+	return (t.Kind == "" || t.Kind == kind) && (t.Project == "" || t.Project == project)
+}
+
+// Scope describes the scopes of t for messages, e.g. "project=api kind=rule".
+func (t *APIToken) Scope() string {
+	switch {
+	case t.Project != "" && t.Kind != "":
+		return "project=" + t.Project + " kind=" + t.Kind
+	case t.Project != "":
+		return "project=" + t.Project
+	case t.Kind != "":
+		return "kind=" + t.Kind
+	}
+	return ""
+}
+
+// CreateToken generates a token with the given name, role and scopes, and
+// returns it with its metadata. The token cannot be retrieved later.
+// Scopes only apply to the write role.
+func (d *DB) CreateToken(ctx context.Context, name, role, project, kind string) (string, *APIToken, error) {
+	if name == "" {
+		return "", nil, fmt.Errorf("token name must not be empty")
+	}
+	if !slices.Contains(Roles, role) {
+		return "", nil, fmt.Errorf("invalid role %q: use one of read, write, admin", role)
+	}
+	if role != RoleWrite && (project != "" || kind != "") {
+		return "", nil, fmt.Errorf("project and kind scopes only apply to write tokens")
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("generate token: %w", err)
+	}
+	secret := tokenPrefix + hex.EncodeToString(b)
+
+	res, err := d.db.ExecContext(ctx,
+		`INSERT INTO api_tokens (name, token_hash, role, project, kind) VALUES (?, ?, ?, ?, ?)`,
+		name, hashToken(secret), role, project, kind,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("create token: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", nil, fmt.Errorf("last insert id: %w", err)
+	}
+	t := &APIToken{ID: id}
+	if err := d.read.QueryRowContext(ctx,
+		`SELECT name, role, project, kind, created_at FROM api_tokens WHERE id = ?`, id,
+	).Scan(&t.Name, &t.Role, &t.Project, &t.Kind, &t.CreatedAt); err != nil {
+		return "", nil, fmt.Errorf("get token: %w", err)
+	}
+	return secret, t, nil
+}
+
+// ListTokens returns all tokens, revoked ones included, ordered by name.
+func (d *DB) ListTokens(ctx context.Context) ([]APIToken, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, name, role, project, kind, created_at, COALESCE(revoked_at, '') FROM api_tokens ORDER BY name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	defer rows.Close()
+	var out []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Role, &t.Project, &t.Kind, &t.CreatedAt, &t.RevokedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// RevokeToken disables a token. Revoked tokens stay listed.
+func (d *DB) RevokeToken(ctx context.Context, name string) error {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE api_tokens SET revoked_at = datetime('now') WHERE name = ? AND revoked_at IS NULL`, name)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("no active token named %q", name)
+	}
+	return nil
+}
+
+// HasTokens reports whether any token is active. Without one, the server
+// falls back to its shared token, if any.
+func (d *DB) HasTokens(ctx context.Context) (bool, error) {
+	var n int
+	if err := d.read.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_tokens WHERE revoked_at IS NULL`).Scan(&n); err != nil {
+		return false, fmt.Errorf("count tokens: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Authenticate returns the active token matching secret, or ErrInvalidToken.
+func (d *DB) Authenticate(ctx context.Context, secret string) (*APIToken, error) {
+	if secret == "" {
+		return nil, ErrInvalidToken
+	}
+	t := &APIToken{}
+	err := d.read.QueryRowContext(ctx,
+		`SELECT id, name, role, project, kind, created_at FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL`,
+		hashToken(secret),
+	).Scan(&t.ID, &t.Name, &t.Role, &t.Project, &t.Kind, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("authenticate: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ListTrash returns the entries in the trash (without content), most recently deleted first.
+func (d *DB) ListTrash(ctx context.Context) ([]Entry, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT id, slug, title, description, kind, language, domain, project, version, created_at, updated_at, deleted_at
+		 FROM entries WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, slug`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.DeletedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadTags(ctx, d.read, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RestoreEntry takes an entry out of the trash.
+func (d *DB) RestoreEntry(ctx context.Context, slug string) error {
+	defer d.cache.clear()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	entryID, err := trashedEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE entries SET deleted_at = NULL WHERE id = ?`, entryID); err != nil {
+		return fmt.Errorf("restore entry: %w", err)
+	}
+	content, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
+	}
+	if err := audit(ctx, tx, OpRestore, slug, "", "", contentHash(content)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeEntry permanently removes a trashed entry. CASCADE handles tags, stats and revisions.
+func (d *DB) PurgeEntry(ctx context.Context, slug string) error {
+	defer d.cache.clear()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	entryID, err := trashedEntryID(ctx, tx, slug)
+	if err != nil {
+		return err
+	}
+	if err := purgeEntry(ctx, tx, entryID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeTrash permanently removes entries that have been in the trash for longer
+// than olderThan (all trashed entries when olderThan is zero) and returns how many were removed.
+func (d *DB) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	defer d.cache.clear()
+	cutoff := time.Now().UTC().Add(-olderThan).Format(time.DateTime)
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM entries WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("list trash: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := purgeEntry(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(ids), nil
+}
+
+// trashedEntryID returns the id of the trashed entry with the given slug.
+func trashedEntryID(ctx context.Context, q rowQuerier, slug string) (int64, error) {
+	var entryID int64
+	if err := q.QueryRowContext(ctx, `SELECT id FROM entries WHERE slug = ? AND deleted_at IS NOT NULL`, slug).Scan(&entryID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("entry not in trash: %s: %w", slug, ErrNotFound)
+		}
+		return 0, fmt.Errorf("lookup: %w", err)
+	}
+	return entryID, nil
+}
+
+// purgeEntry deletes an entry row and its FTS row within a transaction, and
+// records the purge in the audit log.
+func purgeEntry(ctx context.Context, tx *sql.Tx, entryID int64) error {
+	var slug string
+	if err := tx.QueryRowContext(ctx, `SELECT slug FROM entries WHERE id = ?`, entryID).Scan(&slug); err != nil {
+		return fmt.Errorf("lookup: %w", err)
+	}
+	content, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entries_fts WHERE rowid = ?`, entryID); err != nil {
+		return fmt.Errorf("delete fts: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM entries WHERE id = ?`, entryID); err != nil {
+		return fmt.Errorf("delete entry: %w", err)
+	}
+	return audit(ctx, tx, OpPurge, slug, "", contentHash(content), "")
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pouriya/mcpedia/internal/semantic"
+)
+
+// Search modes accepted by the search_entries tool.
+const (
+	SearchKeyword  = "keyword"
+	SearchSemantic = "semantic"
+	SearchHybrid   = "hybrid"
+)
+
+// SearchModes lists the valid search modes.
+var SearchModes = []string{SearchKeyword, SearchSemantic, SearchHybrid}
+
+const (
+	// minSemanticScore drops matches that share only a very common term with the query.
+	minSemanticScore = 0.05
+	// rrfK is the usual reciprocal-rank fusion constant; it damps the weight
+	// of the very top ranks so neither list dominates.
+	rrfK = 60
+	// fusionCandidates is how many results each ranking contributes to hybrid
+	// search; results past that are not reachable by paging.
+	fusionCandidates = 200
+	maxSnippetLen    = 200
+)
+
+// SemanticSearch ranks entries by similarity to the query using local
+// embeddings (see package semantic), so entries match on related words and
+// synonyms, not only exact terms. Results carry a Score and a Snippet.
+// Paging works as for SearchEntries.
+func (d *DB) SemanticSearch(ctx context.Context, queryStr string, f Filter, page Page) (*EntryPage, error) {
+	limit, offset, err := page.window(10, 50)
+	if err != nil {
+		return nil, err
+	}
+	query, err := ParseQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	entries, total, err := d.searchSemantic(ctx, query, f, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.setSemanticSnippets(ctx, entries, query); err != nil {
+		return nil, err
+	}
+	d.bumpSearchStats(entries)
+	markStale(entries)
+	return newEntryPage(entries, total, offset), nil
+}
+
+// HybridSearch merges the keyword (BM25) and semantic rankings with
+// reciprocal-rank fusion. Paging works as for SearchEntries, over the fused
+// top results of both rankings.
+func (d *DB) HybridSearch(ctx context.Context, queryStr string, f Filter, page Page) (*EntryPage, error) {
+	limit, offset, err := page.window(10, 50)
+	if err != nil {
+		return nil, err
+	}
+	query, err := ParseQuery(queryStr)
+	if err != nil {
+		return nil, err
+	}
+	keyword, _, err := d.searchKeyword(ctx, query, f, fusionCandidates, 0)
+	if err != nil {
+		return nil, err
+	}
+	sem, _, err := d.searchSemantic(ctx, query, f, fusionCandidates, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[int64]*Entry{}
+	var fused []*Entry
+	for _, ranking := range [][]Entry{keyword, sem} {
+		for rank, e := range ranking {
+			got, ok := byID[e.ID]
+			if !ok {
+				e.Score = 0
+				got = &e
+				byID[e.ID] = got
+				fused = append(fused, got)
+			}
+			got.Score += 1 / float64(rrfK+rank+1)
+		}
+	}
+	slices.SortStableFunc(fused, func(a, b *Entry) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+
+	window := fused[min(offset, len(fused)):min(offset+limit, len(fused))]
+	// Keyword results come with snippets; semantic-only ones need theirs
+	var semOnly []Entry
+	for _, e := range window {
+		if e.Snippet == "" {
+			semOnly = append(semOnly, *e)
+		}
+	}
+	if err := d.setSemanticSnippets(ctx, semOnly, query); err != nil {
+		return nil, err
+	}
+	for _, e := range semOnly {
+		byID[e.ID].Snippet, byID[e.ID].Section = e.Snippet, e.Section
+	}
+	entries := make([]Entry, 0, len(window))
+	for _, e := range window {
+		entries = append(entries, *e)
+	}
+	d.bumpSearchStats(entries)
+	markStale(entries)
+	return newEntryPage(entries, len(fused), offset), nil
+}
+
+// searchSemantic scores every live entry matching f and the query's filters
+// against the query's search terms, without touching stats, and returns one
+// window of results and the total number of matches. Results have no content
+// and no snippet: see setSemanticSnippets.
+func (d *DB) searchSemantic(ctx context.Context, query *Query, f Filter, limit, offset int) ([]Entry, int, error) {
+	vec := semantic.EmbedQuery(query.text)
+	if vec.IsZero() {
+		return nil, 0, nil
+	}
+
+	fw, fa := filterClauses(f)
+	qw, qa := query.clauses()
+	wheres := append(append([]string{"e.deleted_at IS NULL"}, fw...), qw...)
+	args := append(fa, qa...)
+	q := `SELECT e.id, e.slug, e.title, e.description, e.kind, e.language, e.domain, e.project, e.version, e.created_at, e.updated_at, e.review_after, e.expires_at, e.status, v.vector
+	      FROM entry_vectors v JOIN entries e ON e.id = v.entry_id
+	      WHERE ` + strings.Join(wheres, " AND ")
+	rows, err := d.read.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("semantic search: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []Entry
+	var vectors []semantic.Vector
+	for rows.Next() {
+		var e Entry
+		var blob []byte
+		if err := rows.Scan(&e.ID, &e.Slug, &e.Title, &e.Description, &e.Kind, &e.Language, &e.Domain, &e.Project, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.ReviewAfter, &e.ExpiresAt, &e.Status, &blob); err != nil {
+			return nil, 0, fmt.Errorf("scan: %w", err)
+		}
+		v, err := semantic.Decode(blob)
+		if err != nil {
+			return nil, 0, fmt.Errorf("decode vector for entry %d: %w", e.ID, err)
+		}
+		candidates = append(candidates, e)
+		vectors = append(vectors, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	scores := semantic.Rank(vec, vectors)
+	var matches []Entry
+	for i, e := range candidates {
+		if scores[i] >= minSemanticScore {
+			e.Score = scores[i]
+			matches = append(matches, e)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b Entry) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return strings.Compare(a.Title, b.Title)
+	})
+	total := len(matches)
+	matches = matches[min(offset, total):min(offset+limit, total)]
+	if err := loadTags(ctx, d.read, matches); err != nil {
+		return nil, 0, err
+	}
+	return matches, total, nil
+}
+
+// setSemanticSnippets sets the snippet of each entry to the content line
+// sharing the most terms with the query, and its section for entries stored
+// as sections. Content is read for that and not kept.
+func (d *DB) setSemanticSnippets(ctx context.Context, entries []Entry, query *Query) error {
+	if err := loadFullContent(ctx, d.read, entries); err != nil {
+		return err
+	}
+	queryTerms := semantic.Terms(query.text)
+	for i := range entries {
+		entries[i].Snippet = bestSnippet(entries[i].Content, entries[i].Description, queryTerms)
+		entries[i].Content = ""
+	}
+	return setSnippetSections(ctx, d.read, entries)
+}
+
+// bestSnippet returns the content line sharing the most terms with the query,
+// or the description if no line does.
+func bestSnippet(content, description string, queryTerms []string) string {
+	best, bestHits := "", 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		// Headings repeat the title; prefer prose
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimLeft(line, ">*- ")
+		hits := 0
+		for _, t := range semantic.Terms(line) {
+			if slices.Contains(queryTerms, t) {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = line, hits
+		}
+	}
+	if best == "" {
+		best = description
+	}
+	if r := []rune(best); len(r) > maxSnippetLen {
+		best = string(r[:maxSnippetLen]) + "..."
+	}
+	return best
+}
+
+// setVector (re)computes the embedding of an entry from its stored fields and tags.
+func setVector(ctx context.Context, tx *sql.Tx, entryID int64) error {
+	var title, description string
+	if err := tx.QueryRowContext(ctx, `SELECT title, description FROM entries WHERE id = ?`, entryID).Scan(&title, &description); err != nil {
+		return fmt.Errorf("read entry: %w", err)
+	}
+	content, err := entryContent(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
+	}
+	return writeVector(ctx, tx, entryID, title, description, content)
+}
+
+// writeVector stores the embedding of an entry with the given fields and its
+// tags. It only uses tables of the schema that introduced entry_vectors, so
+// migration hooks can call it.
+func writeVector(ctx context.Context, tx *sql.Tx, entryID int64, title, description, content string) error {
+	tags, err := getTagsForEntry(ctx, tx, entryID)
+	if err != nil {
+		return fmt.Errorf("get tags: %w", err)
+	}
+	v := semantic.EmbedEntry(title, description, content, tags)
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO entry_vectors (entry_id, vector) VALUES (?, ?)
+		 ON CONFLICT(entry_id) DO UPDATE SET vector = excluded.vector`, entryID, semantic.Encode(v),
+	)
+	return err
+}
+
+// backfillVectors embeds every existing entry. It runs once, as part of the
+// migration that adds entry_vectors, before content moved to entry_sections,
+// so it reads entries.content directly.
+func backfillVectors(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, title, description, content FROM entries`)
+	if err != nil {
+		return fmt.Errorf("list entries: %w", err)
+	}
+	type entryFields struct {
+		id                          int64
+		title, description, content string
+	}
+	var entries []entryFields
+	for rows.Next() {
+		var e entryFields
+		if err := rows.Scan(&e.id, &e.title, &e.description, &e.content); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := writeVector(ctx, tx, e.id, e.title, e.description, e.content); err != nil {
+			return fmt.Errorf("entry %d: %w", e.id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package diff compares texts line by line and prints the differences in
+// unified format, as used by `mcpedia review diff` to show a proposed change.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCells bounds the size of the comparison table (the product of the line
+// counts that differ after trimming the common prefix and suffix). Larger
+// changes are shown as the whole old block removed and the new one added.
+const maxCells = 4 << 20
+
+// Op is the kind of a diff line.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// Line is one line of a diff, without its newline.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the edit script turning a into b, line by line: every line
+// of a and b in order, marked as kept, deleted or inserted. Deletions come
+// before insertions within a changed block.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+	var out []Line
+	for _, s := range x[:pre] {
+		out = append(out, Line{Equal, s})
+	}
+	out = append(out, middle(x[pre:len(x)-suf], y[pre:len(y)-suf])...)
+	for _, s := range x[len(x)-suf:] {
+		out = append(out, Line{Equal, s})
+	}
+	return out
+}
+
+// middle diffs the lines between the common prefix and suffix by longest
+// common subsequence.
+func middle(x, y []string) []Line {
+	var out []Line
+	if len(x)*len(y) > maxCells || len(x) == 0 || len(y) == 0 {
+		for _, s := range x {
+			out = append(out, Line{Delete, s})
+		}
+		for _, s := range y {
+			out = append(out, Line{Insert, s})
+		}
+		return out
+	}
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ins []Line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out = append(append(out, ins...), Line{Equal, x[i]})
+			ins = ins[:0]
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] > lcs[i+1][j]):
+			ins = append(ins, Line{Insert, y[j]})
+			j++
+		default:
+			out = append(out, Line{Delete, x[i]})
+			i++
+		}
+	}
+	return append(out, ins...)
+}
+
+// Unified returns the differences between a and b in unified format, with
+// context lines of context around each change, and "" if they are equal.
+// from and to name the two sides in the header.
+func Unified(a, b, from, to string, context int) string {
+	lines := Lines(a, b)
+	var sb strings.Builder
+	for start := 0; start < len(lines); {
+		// Find the next change and the end of its hunk: changes closer than
+		// 2*context lines share a hunk
+		first := start
+		for first < len(lines) && lines[first].Op == Equal {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		end := first
+		for k := first; k < len(lines) && k-end <= 2*context; k++ {
+			if lines[k].Op != Equal {
+				end = k + 1
+			}
+		}
+		lo, hi := max(first-context, start), min(end+context, len(lines))
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+		}
+		writeHunk(&sb, lines, lo, hi)
+		start = hi
+	}
+	return sb.String()
+}
+
+// writeHunk writes lines[lo:hi] with its @@ header.
+func writeHunk(sb *strings.Builder, lines []Line, lo, hi int) {
+	// Line numbers of the hunk start on each side, counted from 1
+	aStart, bStart := 1, 1
+	for _, l := range lines[:lo] {
+		if l.Op != Insert {
+			aStart++
+		}
+		if l.Op != Delete {
+			bStart++
+		}
+	}
+	var aLen, bLen int
+	for _, l := range lines[lo:hi] {
+		if l.Op != Insert {
+			aLen++
+		}
+		if l.Op != Delete {
+			bLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, l := range lines[lo:hi] {
+		sb.WriteByte(byte(l.Op))
+		sb.WriteString(l.Text)
+		sb.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side starts at the line before it, as in GNU diff.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// split returns the lines of s without their newlines.
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	got := Lines("a\nb\nc\nd\n", "a\nc\nx\nd\n")
+	want := []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}, {Insert, "x"}, {Equal, "d"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	if d := Unified("same\n", "same\n", "a", "b", 3); d != "" {
+		t.Errorf("equal texts: got %q, want empty", d)
+	}
+
+	d := Unified("one\ntwo\nthree\n", "one\n2\nthree\n", "current", "proposed", 1)
+	want := "--- current\n+++ proposed\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"
+	if d != want {
+		t.Errorf("got\n%s\nwant\n%s", d, want)
+	}
+
+	// Changes far apart get a hunk each
+	var a, b []string
+	for i := range 20 {
+		a = append(a, strings.Repeat("x", i+1))
+	}
+	b = append(b, a...)
+	b[1], b[18] = "changed", "changed too"
+	d = Unified(strings.Join(a, "\n"), strings.Join(b, "\n"), "a", "b", 2)
+	if n := strings.Count(d, "@@ -"); n != 2 {
+		t.Errorf("got %d hunks, want 2:\n%s", n, d)
+	}
+	if !strings.Contains(d, "@@ -1,4 +1,4 @@\n") || !strings.Contains(d, "@@ -17,4 +17,4 @@\n") {
+		t.Errorf("unexpected hunk headers:\n%s", d)
+	}
+
+	// From nothing
+	d = Unified("", "new\n", "a", "b", 3)
+	if !strings.Contains(d, "@@ -0,0 +1 @@\n+new\n") {
+		t.Errorf("got %q", d)
+	}
+}
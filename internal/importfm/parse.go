@@ -2,14 +2,16 @@ package importfm
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/pouriya/mcpedia/internal/db"
 )
 
-const maxContentLen = 32768
+const maxContentLen = db.MaxContentLen
 
 var validKinds = map[string]bool{
 	"skill": true, "rule": true, "context": true,
@@ -22,7 +24,8 @@ var slugRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
 // allowedKeys is the exact set of keys export produces; unknown keys are rejected.
 var allowedKeys = map[string]bool{
 	"title": true, "kind": true, "language": true, "domain": true,
-	"project": true, "tags": true, "description": true,
+	"project": true, "tags": true, "description": true, "attachments": true,
+	"review_after": true, "expires_at": true, "status": true,
 }
 
 // ParseImportFile parses file content (export-format Markdown with YAML frontmatter)
@@ -70,6 +73,20 @@ func ParseImportFile(content []byte, filename string) (*db.Entry, error) {
 	}
 	tagList := parseTagsList(tags)
 
+	attachments, err := parseAttachmentsList(meta["attachments"])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range []string{"review_after", "expires_at"} {
+		if !db.ValidDate(meta[k]) {
+			return nil, fmt.Errorf("invalid format: %s %q is not a date (YYYY-MM-DD)", k, meta[k])
+		}
+	}
+	if meta["status"] != "" && !slices.Contains(db.Statuses, meta["status"]) {
+		return nil, fmt.Errorf("invalid format: status %q is not one of %s", meta["status"], strings.Join(db.Statuses, ", "))
+	}
+
 	e := &db.Entry{
 		Slug:        slug,
 		Title:       meta["title"],
@@ -80,10 +97,34 @@ func ParseImportFile(content []byte, filename string) (*db.Entry, error) {
 		Domain:      meta["domain"],
 		Project:     meta["project"],
 		Tags:        tagList,
+		Attachments: attachments,
+		ReviewAfter: meta["review_after"],
+		ExpiresAt:   meta["expires_at"],
+		Status:      meta["status"],
 	}
 	return e, nil
 }
 
+// AttachmentsDir returns the directory export writes the attachments of the
+// entry in file to: <slug>.attachments next to it.
+func AttachmentsDir(file string) string {
+	return strings.TrimSuffix(file, ".md") + ".attachments"
+}
+
+// ReadAttachments loads the data of the attachments listed in e, parsed
+// from file, from AttachmentsDir(file).
+func ReadAttachments(e *db.Entry, file string) error {
+	dir := AttachmentsDir(file)
+	for i := range e.Attachments {
+		data, err := os.ReadFile(filepath.Join(dir, e.Attachments[i].Name))
+		if err != nil {
+			return fmt.Errorf("read attachment: %w", err)
+		}
+		e.Attachments[i].Data = data
+	}
+	return nil
+}
+
 func slugFromFilename(filename string) (string, error) {
 	base := filepath.Base(filename)
 	if base == "." || base == "/" {
@@ -108,7 +149,8 @@ func parseFrontmatter(block string) (map[string]string, error) {
 	seen := make(map[string]bool)
 	out := map[string]string{
 		"title": "", "kind": "", "language": "", "domain": "", "project": "",
-		"tags": "", "description": "",
+		"tags": "", "description": "", "attachments": "",
+		"review_after": "", "expires_at": "", "status": "",
 	}
 	lines := strings.Split(block, "\n")
 	for _, line := range lines {
@@ -152,6 +194,21 @@ func unquoteVal(s string) string {
 	return s
 }
 
+// parseAttachmentsList parses "[name:mime/type, ...]"; the MIME type may be
+// left out (name only) to have it detected.
+func parseAttachmentsList(s string) ([]db.Attachment, error) {
+	var out []db.Attachment
+	for _, item := range parseTagsList(s) {
+		name, mimeType, _ := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if !db.ValidAttachmentName(name) {
+			return nil, fmt.Errorf("invalid format: attachment name %q", name)
+		}
+		out = append(out, db.Attachment{Name: name, MIMEType: strings.TrimSpace(mimeType)})
+	}
+	return out, nil
+}
+
 // parseTagsList parses "[a, b, c]" or "[]" into a slice of strings.
 func parseTagsList(s string) []string {
 	s = strings.TrimSpace(s)
@@ -249,3 +249,86 @@ body
 		t.Errorf("description: got %q", e.Description)
 	}
 }
+
+func TestParseImportFile_Attachments(t *testing.T) {
+	content := `---
+title: "X"
+kind: skill
+language: ""
+domain: ""
+project: ""
+tags: []
+attachments: [diagram.png:image/png, sample.conf]
+---
+
+Body.
+`
+	e, err := ParseImportFile([]byte(content), "x.md")
+	if err != nil {
+		t.Fatalf("ParseImportFile: %v", err)
+	}
+	if len(e.Attachments) != 2 || e.Attachments[0].Name != "diagram.png" || e.Attachments[0].MIMEType != "image/png" ||
+		e.Attachments[1].Name != "sample.conf" || e.Attachments[1].MIMEType != "" {
+		t.Errorf("attachments: got %+v", e.Attachments)
+	}
+
+	bad := strings.Replace(content, "sample.conf", "../secret", 1)
+	if _, err := ParseImportFile([]byte(bad), "x.md"); err == nil {
+		t.Error("expected error for attachment name with a path")
+	}
+}
+
+func TestParseImportFile_ReviewDates(t *testing.T) {
+	content := `---
+title: "X"
+kind: skill
+language: ""
+domain: ""
+project: ""
+tags: []
+review_after: 2026-06-01
+expires_at: 2027-01-01
+---
+
+Body.
+`
+	e, err := ParseImportFile([]byte(content), "x.md")
+	if err != nil {
+		t.Fatalf("ParseImportFile: %v", err)
+	}
+	if e.ReviewAfter != "2026-06-01" || e.ExpiresAt != "2027-01-01" {
+		t.Errorf("dates: got %q, %q", e.ReviewAfter, e.ExpiresAt)
+	}
+
+	bad := strings.Replace(content, "2027-01-01", "soon", 1)
+	if _, err := ParseImportFile([]byte(bad), "x.md"); err == nil {
+		t.Error("expected error for invalid expires_at")
+	}
+}
+
+func TestParseImportFile_Status(t *testing.T) {
+	content := `---
+title: "X"
+kind: skill
+language: ""
+domain: ""
+project: ""
+tags: []
+status: proposed
+---
+
+Body.
+`
+	e, err := ParseImportFile([]byte(content), "x.md")
+	if err != nil {
+		t.Fatalf("ParseImportFile: %v", err)
+	}
+	if e.Status != "proposed" {
+		t.Errorf("status: got %q, want proposed", e.Status)
+	}
+
+	bad := strings.Replace(content, "proposed", "live", 1)
+	if _, err := ParseImportFile([]byte(bad), "x.md"); err == nil {
+		t.Error("expected error for invalid status")
+	}
+}
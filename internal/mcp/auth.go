@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pouriya/mcpedia/internal/db"
+)
+
+// tokenKey is the context key of the bearer token a request was sent with,
+// and principalKey that of the token it was authenticated as.
+type (
+	tokenKey     struct{}
+	principalKey struct{}
+)
+
+// errUnauthorized is returned by authenticate when a request must be refused.
+var errUnauthorized = errors.New("unauthorized")
+
+// writeTools are the tools that need the write role; all others need read.
+var writeTools = []string{"create_entry", "update_entry", "delete_entry", "restore_entry"}
+
+// authenticate returns the token a request with the given bearer token acts
+// as. The server's shared Token grants admin access. Otherwise the bearer
+// token must be one of the database's API tokens, unless there are none and
+// no shared token either, in which case the server is open to everyone.
+func (s *Server) authenticate(ctx context.Context, token string) (*db.APIToken, error) {
+	if s.Token != "" && token == s.Token {
+		return &db.APIToken{Name: "shared", Role: db.RoleAdmin}, nil
+	}
+	t, err := s.DB.Authenticate(ctx, token)
+	if err == nil {
+		return t, nil
+	}
+	if !errors.Is(err, db.ErrInvalidToken) {
+		return nil, err
+	}
+	if s.Token == "" {
+		has, err := s.DB.HasTokens(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return &db.APIToken{Name: "anonymous", Role: db.RoleAdmin}, nil
+		}
+	}
+	return nil, errUnauthorized
+}
+
+// principal returns the token the request in ctx was authenticated as.
+func principal(ctx context.Context) *db.APIToken {
+	if t, ok := ctx.Value(principalKey{}).(*db.APIToken); ok {
+		return t
+	}
+	return &db.APIToken{Name: "anonymous", Role: db.RoleAdmin}
+}
+
+// toolRole returns the role needed to call a tool.
+func toolRole(tool string) string {
+	if slices.Contains(writeTools, tool) {
+		return db.RoleWrite
+	}
+	return db.RoleRead
+}
+
+// checkAccess verifies that the caller may run a tool with the given
+// arguments: its role, and for scoped write tokens, the kind and project of
+// the entry before and after the change.
+func (s *Server) checkAccess(ctx context.Context, tool string, args map[string]any) error {
+	p := principal(ctx)
+	if role := toolRole(tool); !p.Allows(role) {
+		return fmt.Errorf("token %q has role %s; %s needs %s", p.Name, p.Role, tool, role)
+	}
+	if toolRole(tool) != db.RoleWrite || p.Covers("", "") {
+		return nil
+	}
+	before, after, err := s.writeTargets(ctx, tool, args)
+	if err != nil {
+		return err
+	}
+	if before != nil && !p.Covers(before.Kind, before.Project) {
+		return fmt.Errorf("token %q is limited to %s; %s is kind=%s project=%s", p.Name, p.Scope(), before.Slug, before.Kind, before.Project)
+	}
+	// The entry must stay in scope after the change
+	if after != nil && !p.Covers(after.Kind, after.Project) {
+		return fmt.Errorf("token %q is limited to %s; cannot write an entry with kind=%s project=%s", p.Name, p.Scope(), after.Kind, after.Project)
+	}
+	return nil
+}
+
+// writeTargets returns the entry a write tool changes, as it is before the
+// change (nil for create_entry) and as it will be after (nil for
+// delete_entry), with the attributes that access and lock checks look at.
+// after must match what the database will store, so a scoped token cannot
+// move an entry out of its scope.
+func (s *Server) writeTargets(ctx context.Context, tool string, args map[string]any) (before, after *db.Entry, err error) {
+	slug := str(args, "slug")
+	switch {
+	case tool == "create_entry":
+		return nil, &db.Entry{Slug: slug, Kind: cmp.Or(str(args, "kind"), db.DefaultKind), Project: str(args, "project"), Tags: strSlice(args, "tags")}, nil
+	case tool == "restore_entry" && intVal(args, "version", 0) <= 0:
+		trash, err := s.DB.ListTrash(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range trash {
+			if trash[i].Slug == slug {
+				return &trash[i], &trash[i], nil
+			}
+		}
+		return nil, nil, fmt.Errorf("entry not in trash: %s: %w", slug, db.ErrNotFound)
+	}
+	before, err = s.DB.GetEntryMeta(ctx, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch tool {
+	case "delete_entry":
+		return before, nil, nil
+	case "update_entry":
+		// UpdateEntry stores every field given, empty or not. Values that
+		// are not strings count as empty here, which no scope covers.
+		cp := *before
+		if v, ok := args["kind"]; ok {
+			cp.Kind, _ = v.(string)
+		}
+		if v, ok := args["project"]; ok {
+			cp.Project, _ = v.(string)
+		}
+		if _, ok := args["tags"]; ok {
+			cp.Tags = strSlice(args, "tags")
+		}
+		return before, &cp, nil
+	case "restore_entry":
+		rev, err := s.DB.GetRevision(ctx, slug, intVal(args, "version", 0))
+		if err != nil {
+			return nil, nil, err
+		}
+		return before, &db.Entry{Slug: slug, Kind: rev.Kind, Project: rev.Project, Tags: rev.Tags}, nil
+	}
+	return before, before, nil
+}
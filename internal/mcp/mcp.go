@@ -12,7 +12,8 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"strconv"
+	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -33,8 +34,16 @@ const (
 
 // Server implements the MCP protocol over HTTP.
 type Server struct {
-	DB       *db.DB
-	Token    string // empty = no auth required
+	DB    *db.DB
+	Token string // empty = no auth required
+	// ProposeWrites queues agent writes for human review (see mcpedia
+	// review): new entries are created as proposed, and updates and deletes
+	// of approved entries are stored as proposals, leaving the entry as it is.
+	ProposeWrites bool
+	// Namespace is the name the server is mounted under in a Federation.
+	Namespace  string
+	federation *Federation
+	// sessions maps session ids to the client name sent in initialize.
 	sessions sync.Map
 }
 
@@ -136,13 +145,17 @@ func (s *Server) serveRequest(w *responseWriter, r *http.Request) {
 	}
 
 	// Auth check
-	if s.Token != "" {
-		auth := r.Header.Get("Authorization")
-		if !strings.HasPrefix(auth, "Bearer ") || strings.TrimPrefix(auth, "Bearer ") != s.Token {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p, err := s.authenticate(r.Context(), token)
+	if errors.Is(err, errUnauthorized) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.Error("authenticate", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
+	ctx := context.WithValue(context.WithValue(r.Context(), tokenKey{}, token), principalKey{}, p)
 
 	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
 	if err != nil {
@@ -171,17 +184,22 @@ func (s *Server) serveRequest(w *responseWriter, r *http.Request) {
 	}
 
 	// Session validation for non-initialize requests
+	actor := db.Actor{Token: p.Name}
 	if req.Method != "initialize" {
 		sessionID := r.Header.Get("Mcp-Session-Id")
 		if sessionID != "" {
-			if _, ok := s.sessions.Load(sessionID); !ok {
+			client, ok := s.sessions.Load(sessionID)
+			if !ok {
 				writeJSON(w, http.StatusOK, rpcErr(req.ID, -32600, "Invalid session"))
 				return
 			}
+			actor.Session, actor.Client = sessionID, client.(string)
 		}
 	}
+	// Changes are audited as made by this session, client and token
+	ctx = db.WithActor(ctx, actor)
 
-	resp := s.dispatch(r.Context(), req)
+	resp := s.dispatch(ctx, req)
 
 	// For initialize, set session header
 	if req.Method == "initialize" && resp.Error == nil {
@@ -208,7 +226,7 @@ func (s *Server) dispatch(ctx context.Context, req jsonrpcRequest) *jsonrpcRespo
 	case "ping":
 		return rpcResult(req.ID, map[string]any{})
 	case "tools/list":
-		return s.handleToolsList(req)
+		return s.handleToolsList(ctx, req)
 	case "tools/call":
 		return s.handleToolsCall(ctx, req)
 	case "resources/list":
@@ -229,8 +247,15 @@ func (s *Server) dispatch(ctx context.Context, req jsonrpcRequest) *jsonrpcRespo
 // --- Initialize ---
 
 func (s *Server) handleInitialize(req jsonrpcRequest) *jsonrpcResponse {
+	var params struct {
+		ClientInfo struct {
+			Name string `json:"name"`
+		} `json:"clientInfo"`
+	}
+	// clientInfo is only used to label changes in the audit log
+	_ = json.Unmarshal(req.Params, &params)
 	sessionID := generateSessionID()
-	s.sessions.Store(sessionID, true)
+	s.sessions.Store(sessionID, params.ClientInfo.Name)
 
 	result := map[string]any{
 		"protocolVersion": protocolVersion,
@@ -250,8 +275,12 @@ func (s *Server) handleInitialize(req jsonrpcRequest) *jsonrpcResponse {
 
 // --- Tools ---
 
-func (s *Server) handleToolsList(req jsonrpcRequest) *jsonrpcResponse {
-	tools := toolDefinitions()
+func (s *Server) handleToolsList(ctx context.Context, req jsonrpcRequest) *jsonrpcResponse {
+	// Tools the caller's role does not allow are left out
+	p := principal(ctx)
+	tools := slices.DeleteFunc(toolDefinitions(), func(t map[string]any) bool {
+		return !p.Allows(toolRole(t["name"].(string)))
+	})
 	slog.Info("tool call", "tool", "list", "items", len(tools))
 	return rpcResult(req.ID, map[string]any{"tools": tools})
 }
@@ -264,12 +293,23 @@ func (s *Server) handleToolsCall(ctx context.Context, req jsonrpcRequest) *jsonr
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return rpcErr(req.ID, -32602, "Invalid params: "+err.Error())
 	}
+	if err := s.checkAccess(ctx, params.Name, params.Arguments); err != nil {
+		slog.Info("tool call denied", "tool", params.Name, "token", principal(ctx).Name, "err", err)
+		return toolError(req.ID, err.Error())
+	}
+	if toolRole(params.Name) == db.RoleWrite {
+		if err := s.checkLock(ctx, params.Name, params.Arguments); err != nil {
+			return toolError(req.ID, err.Error())
+		}
+	}
 
 	switch params.Name {
 	case "search_entries":
 		return s.toolSearchEntries(ctx, req.ID, params.Arguments)
 	case "get_entry":
 		return s.toolGetEntry(ctx, req.ID, params.Arguments)
+	case "get_entry_section":
+		return s.toolGetEntrySection(ctx, req.ID, params.Arguments)
 	case "get_entries_by_context":
 		return s.toolGetEntriesByContext(ctx, req.ID, params.Arguments)
 	case "list_entries":
@@ -282,41 +322,111 @@ func (s *Server) handleToolsCall(ctx context.Context, req jsonrpcRequest) *jsonr
 		return s.toolUpdateEntry(ctx, req.ID, params.Arguments)
 	case "delete_entry":
 		return s.toolDeleteEntry(ctx, req.ID, params.Arguments)
+	case "get_entry_history":
+		return s.toolGetEntryHistory(ctx, req.ID, params.Arguments)
+	case "restore_entry":
+		return s.toolRestoreEntry(ctx, req.ID, params.Arguments)
+	case "get_related_entries":
+		return s.toolGetRelatedEntries(ctx, req.ID, params.Arguments)
+	case "get_lock_status":
+		return s.toolGetLockStatus(ctx, req.ID)
 	default:
 		return rpcErr(req.ID, -32602, "Unknown tool: "+params.Name)
 	}
 }
 
-func (s *Server) checkLock(ctx context.Context) error {
-	locked, err := s.DB.IsLocked(ctx)
+// checkLock fails if a write lock covers the entry a write tool changes,
+// as it is before or after the change. For restore_entry with a version, the
+// entry after is that version, so a restore cannot move it into a locked scope.
+func (s *Server) checkLock(ctx context.Context, tool string, args map[string]any) error {
+	locks, err := s.DB.Locks(ctx)
+	if err != nil || len(locks) == 0 {
+		return err
+	}
+	for _, l := range locks {
+		if l.IsGlobal() {
+			return fmt.Errorf("database is locked%s. Write operations are disabled", lockDetails(l))
+		}
+	}
+	before, after, err := s.writeTargets(ctx, tool, args)
 	if err != nil {
 		return err
 	}
-	if locked {
-		return fmt.Errorf("database is locked. Write operations are disabled")
+	for _, l := range locks {
+		for _, e := range []*db.Entry{before, after} {
+			if e != nil && l.Matches(e) {
+				return fmt.Errorf("entries with %s are locked%s. Write operations on %s are disabled", l.LockSpec, lockDetails(l), e.Slug)
+			}
+		}
 	}
 	return nil
 }
 
+// lockDetails describes when a lock was taken, why, and until when, for
+// the errors returned to agents.
+func lockDetails(l db.WriteLock) string {
+	details := " since " + l.Since + " UTC"
+	if l.Reason != "" {
+		details += fmt.Sprintf(" (reason: %s)", l.Reason)
+	}
+	if l.ExpiresAt != "" {
+		details += ", until " + l.ExpiresAt + " UTC"
+	}
+	return details
+}
+
 func (s *Server) toolSearchEntries(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
 	query := str(args, "query")
 	if query == "" {
 		return toolError(id, "query is required")
 	}
-	limit := intVal(args, "limit", 10)
+	page := db.Page{Limit: intVal(args, "limit", 10), Cursor: str(args, "cursor")}
 	f := db.Filter{
-		Kind:     str(args, "kind"),
-		Language: str(args, "language"),
-		Domain:   str(args, "domain"),
-		Project:  str(args, "project"),
-		Tag:      str(args, "tag"),
+		Kind:              str(args, "kind"),
+		Language:          str(args, "language"),
+		Domain:            str(args, "domain"),
+		Project:           str(args, "project"),
+		Tag:               str(args, "tag"),
+		IncludeUnapproved: boolVal(args, "include_proposed"),
+	}
+	mode := str(args, "mode")
+	if mode != "" && !slices.Contains(db.SearchModes, mode) {
+		return toolError(id, "mode must be one of: "+strings.Join(db.SearchModes, ", "))
+	}
+
+	if namespaces := strSlice(args, "namespaces"); len(namespaces) > 0 {
+		if page.Cursor != "" {
+			return toolError(id, "cursor cannot be used with namespaces")
+		}
+		if page.Limit <= 0 {
+			page.Limit = 10
+		}
+		result, err := s.federatedSearch(ctx, namespaces, mode, query, f, min(page.Limit, 50))
+		if err != nil {
+			return toolError(id, err.Error())
+		}
+		slog.Info("tool call", "tool", "search_entries", "query", query, "mode", mode, "namespaces", result.Namespaces, "items", len(result.Entries), "total", result.Total)
+		return toolResult(id, result)
 	}
-	entries, err := s.DB.SearchEntries(ctx, query, f, limit)
+
+	result, err := search(ctx, s.DB, mode, query, f, page)
 	if err != nil {
 		return toolError(id, err.Error())
 	}
-	slog.Info("tool call", "tool", "search_entries", "query", query, "items", len(entries))
-	return toolResult(id, entries)
+	slog.Info("tool call", "tool", "search_entries", "query", query, "mode", mode, "items", len(result.Entries), "total", result.Total)
+	return toolResult(id, result)
+}
+
+// search runs a search in the given mode; an empty mode is keyword search.
+func search(ctx context.Context, d *db.DB, mode, query string, f db.Filter, page db.Page) (*db.EntryPage, error) {
+	switch mode {
+	case db.SearchSemantic:
+		return d.SemanticSearch(ctx, query, f, page)
+	case db.SearchHybrid:
+		return d.HybridSearch(ctx, query, f, page)
+	default:
+		return d.SearchEntries(ctx, query, f, page)
+	}
 }
 
 func (s *Server) toolGetEntry(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
@@ -324,49 +434,98 @@ func (s *Server) toolGetEntry(ctx context.Context, id any, args map[string]any)
 	if slug == "" {
 		return toolError(id, "slug is required")
 	}
-	entry, err := s.DB.GetEntry(ctx, slug)
+	entry, err := s.getEntry(ctx, slug, boolVal(args, "include_proposed"))
 	if err != nil {
-		if slug == howToUseSlug && errors.Is(err, db.ErrNotFound) {
-			e := defaultHowToUseEntry()
-			entry = &e
-		} else {
+		return toolError(id, err.Error())
+	}
+	if section := str(args, "section"); section != "" {
+		if entry, err = db.EntrySection(entry, section); err != nil {
 			return toolError(id, err.Error())
 		}
+		slog.Info("tool call", "tool", "get_entry", "slug", slug, "section", section)
+		return toolResult(id, entry)
 	}
 	slog.Info("tool call", "tool", "get_entry", "slug", slug)
 	return toolResult(id, entry)
 }
 
+func (s *Server) toolGetEntrySection(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
+	slug := str(args, "slug")
+	if slug == "" {
+		return toolError(id, "slug is required")
+	}
+	entry, err := s.getEntry(ctx, slug, boolVal(args, "include_proposed"))
+	if err != nil {
+		return toolError(id, err.Error())
+	}
+	heading := str(args, "heading")
+	if heading == "" {
+		outline := db.EntryOutline(entry)
+		slog.Info("tool call", "tool", "get_entry_section", "slug", slug, "items", len(outline.Sections))
+		return toolResult(id, outline)
+	}
+	section, err := db.EntrySection(entry, heading)
+	if err != nil {
+		return toolError(id, err.Error())
+	}
+	slog.Info("tool call", "tool", "get_entry_section", "slug", slug, "heading", heading)
+	return toolResult(id, section)
+}
+
 func (s *Server) toolGetEntriesByContext(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
-	limit := intVal(args, "limit", 20)
+	page := db.Page{Limit: intVal(args, "limit", 20), Cursor: str(args, "cursor")}
 	f := db.Filter{
-		Kind:     str(args, "kind"),
-		Language: str(args, "language"),
-		Domain:   str(args, "domain"),
-		Project:  str(args, "project"),
-		Tags:     strSlice(args, "tags"),
+		Kind:              str(args, "kind"),
+		Language:          str(args, "language"),
+		Domain:            str(args, "domain"),
+		Project:           str(args, "project"),
+		Tags:              strSlice(args, "tags"),
+		ExcludeExpired:    boolVal(args, "exclude_expired"),
+		IncludeUnapproved: boolVal(args, "include_proposed"),
+	}
+	maxTokens, maxBytes := intVal(args, "max_tokens", 0), intVal(args, "max_bytes", 0)
+	// A negative budget is an error from PackEntriesByContext, not a reason to page
+	if maxTokens != 0 || maxBytes != 0 {
+		if maxTokens != 0 && maxBytes != 0 {
+			return toolError(id, "pass max_tokens or max_bytes, not both")
+		}
+		if page.Cursor != "" {
+			return toolError(id, "cursor cannot be combined with max_tokens or max_bytes")
+		}
+		if maxTokens != 0 {
+			maxBytes = maxTokens * bytesPerToken
+		}
+		pack, err := s.DB.PackEntriesByContext(ctx, f, maxBytes)
+		if err != nil {
+			return toolError(id, err.Error())
+		}
+		slog.Info("tool call", "tool", "get_entries_by_context", "budget_bytes", maxBytes, "items", len(pack.Entries),
+			"truncated", len(pack.Truncated), "omitted", len(pack.Omitted)+pack.OmittedUnlisted, "total", pack.Total)
+		return toolResult(id, pack)
 	}
-	entries, err := s.DB.GetEntriesByContext(ctx, f, limit)
+	result, err := s.DB.GetEntriesByContext(ctx, f, page)
 	if err != nil {
 		return toolError(id, err.Error())
 	}
-	slog.Info("tool call", "tool", "get_entries_by_context", "items", len(entries))
-	return toolResult(id, entries)
+	slog.Info("tool call", "tool", "get_entries_by_context", "items", len(result.Entries), "total", result.Total)
+	return toolResult(id, result)
 }
 
 func (s *Server) toolListEntries(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
 	f := db.Filter{
-		Kind:     str(args, "kind"),
-		Language: str(args, "language"),
-		Domain:   str(args, "domain"),
-		Project:  str(args, "project"),
-	}
-	entries, err := s.DB.ListEntries(ctx, f)
+		Kind:              str(args, "kind"),
+		Language:          str(args, "language"),
+		Domain:            str(args, "domain"),
+		Project:           str(args, "project"),
+		IncludeUnapproved: boolVal(args, "include_proposed"),
+	}
+	page := db.Page{Limit: intVal(args, "limit", 50), Cursor: str(args, "cursor")}
+	result, err := s.DB.ListEntries(ctx, f, page)
 	if err != nil {
 		return toolError(id, err.Error())
 	}
-	slog.Info("tool call", "tool", "list_entries", "items", len(entries))
-	return toolResult(id, entries)
+	slog.Info("tool call", "tool", "list_entries", "items", len(result.Entries), "total", result.Total)
+	return toolResult(id, result)
 }
 
 func (s *Server) toolListTags(ctx context.Context, id any) *jsonrpcResponse {
@@ -379,9 +538,6 @@ func (s *Server) toolListTags(ctx context.Context, id any) *jsonrpcResponse {
 }
 
 func (s *Server) toolCreateEntry(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
-	if err := s.checkLock(ctx); err != nil {
-		return toolError(id, err.Error())
-	}
 	slug := str(args, "slug")
 	title := str(args, "title")
 	content := str(args, "content")
@@ -398,24 +554,26 @@ func (s *Server) toolCreateEntry(ctx context.Context, id any, args map[string]an
 		Domain:      str(args, "domain"),
 		Project:     str(args, "project"),
 		Tags:        strSlice(args, "tags"),
+		ReviewAfter: str(args, "review_after"),
+		ExpiresAt:   str(args, "expires_at"),
+	}
+	if s.ProposeWrites {
+		e.Status = db.StatusProposed
 	}
 	if err := s.DB.CreateEntry(ctx, e); err != nil {
 		return toolError(id, err.Error())
 	}
-	slog.Info("tool call", "tool", "create_entry", "slug", slug)
+	slog.Info("tool call", "tool", "create_entry", "slug", slug, "status", e.Status)
 	return toolResult(id, e)
 }
 
 func (s *Server) toolUpdateEntry(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
-	if err := s.checkLock(ctx); err != nil {
-		return toolError(id, err.Error())
-	}
 	slug := str(args, "slug")
 	if slug == "" {
 		return toolError(id, "slug is required")
 	}
 	fields := map[string]any{}
-	for _, key := range []string{"title", "description", "content", "kind", "language", "domain", "project"} {
+	for _, key := range []string{"title", "description", "content", "kind", "language", "domain", "project", "review_after", "expires_at"} {
 		if v, ok := args[key]; ok {
 			fields[key] = v
 		}
@@ -423,8 +581,18 @@ func (s *Server) toolUpdateEntry(ctx context.Context, id any, args map[string]an
 	if v, ok := args["tags"]; ok {
 		fields["tags"] = v
 	}
-	if err := s.DB.UpdateEntry(ctx, slug, fields); err != nil {
+	if review, err := s.needsReview(ctx, slug); err != nil {
 		return toolError(id, err.Error())
+	} else if review {
+		p, err := s.DB.ProposeUpdate(ctx, slug, intVal(args, "expected_version", 0), fields)
+		if err != nil {
+			return toolError(id, writeError(err))
+		}
+		slog.Info("tool call", "tool", "update_entry", "slug", slug, "proposed", true)
+		return proposalResult(id, p)
+	}
+	if err := s.DB.UpdateEntry(ctx, slug, intVal(args, "expected_version", 0), fields); err != nil {
+		return toolError(id, writeError(err))
 	}
 	// Return the updated entry
 	entry, err := s.DB.GetEntry(ctx, slug)
@@ -436,20 +604,155 @@ func (s *Server) toolUpdateEntry(ctx context.Context, id any, args map[string]an
 }
 
 func (s *Server) toolDeleteEntry(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
-	if err := s.checkLock(ctx); err != nil {
-		return toolError(id, err.Error())
-	}
 	slug := str(args, "slug")
 	if slug == "" {
 		return toolError(id, "slug is required")
 	}
-	if err := s.DB.DeleteEntry(ctx, slug); err != nil {
+	if review, err := s.needsReview(ctx, slug); err != nil {
 		return toolError(id, err.Error())
+	} else if review {
+		p, err := s.DB.ProposeDelete(ctx, slug, intVal(args, "expected_version", 0))
+		if err != nil {
+			return toolError(id, writeError(err))
+		}
+		slog.Info("tool call", "tool", "delete_entry", "slug", slug, "proposed", true)
+		return proposalResult(id, p)
+	}
+	if err := s.DB.DeleteEntry(ctx, slug, intVal(args, "expected_version", 0)); err != nil {
+		return toolError(id, writeError(err))
 	}
 	slog.Info("tool call", "tool", "delete_entry", "slug", slug)
 	return toolResult(id, map[string]string{"deleted": slug})
 }
 
+// writeError describes a failed update or delete, telling agents how to
+// recover from a version conflict.
+func writeError(err error) string {
+	if errors.Is(err, db.ErrConflict) {
+		return err.Error() + ". The entry changed since you read it: get it again, reapply your change, and retry with its current version as expected_version"
+	}
+	return err.Error()
+}
+
+// needsReview reports whether a write to slug must be queued for review
+// rather than made: with ProposeWrites, for approved entries. Draft and
+// proposed entries are not live yet, so they are changed directly.
+func (s *Server) needsReview(ctx context.Context, slug string) (bool, error) {
+	if !s.ProposeWrites {
+		return false, nil
+	}
+	e, err := s.DB.GetEntryMeta(ctx, slug)
+	if err != nil {
+		return false, err
+	}
+	return e.Status == db.StatusApproved, nil
+}
+
+// proposalResult is the result of a write queued for review.
+func proposalResult(id any, p *db.Proposal) *jsonrpcResponse {
+	return toolResult(id, map[string]any{
+		"proposal": p,
+		"note":     "This change awaits review by a human. The entry stays as it is until the change is approved.",
+	})
+}
+
+func (s *Server) toolGetEntryHistory(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
+	slug := str(args, "slug")
+	if slug == "" {
+		return toolError(id, "slug is required")
+	}
+	// Past versions of a draft or proposed entry are hidden with the entry
+	if !boolVal(args, "include_proposed") {
+		meta, err := s.DB.GetEntryMeta(ctx, slug)
+		if err == nil && meta.Status != db.StatusApproved {
+			err = fmt.Errorf("entry not found: %s is %s and awaiting review: %w", slug, meta.Status, db.ErrNotFound)
+		}
+		if err != nil {
+			return toolError(id, err.Error())
+		}
+	}
+	if version := intVal(args, "version", 0); version > 0 {
+		rev, err := s.DB.GetRevision(ctx, slug, version)
+		if err != nil {
+			return toolError(id, err.Error())
+		}
+		slog.Info("tool call", "tool", "get_entry_history", "slug", slug, "version", version)
+		return toolResult(id, rev)
+	}
+	revisions, err := s.DB.ListRevisions(ctx, slug)
+	if err != nil {
+		return toolError(id, err.Error())
+	}
+	slog.Info("tool call", "tool", "get_entry_history", "slug", slug, "items", len(revisions))
+	return toolResult(id, revisions)
+}
+
+func (s *Server) toolRestoreEntry(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
+	slug := str(args, "slug")
+	if slug == "" {
+		return toolError(id, "slug is required")
+	}
+	// Without a version, the entry is taken out of the trash
+	version := intVal(args, "version", 0)
+	if version <= 0 && s.ProposeWrites {
+		return toolError(id, "restoring from the trash needs review on this server: ask a human to run `mcpedia trash restore`")
+	}
+	if review, err := s.needsReview(ctx, slug); err != nil {
+		return toolError(id, err.Error())
+	} else if review {
+		rev, err := s.DB.GetRevision(ctx, slug, version)
+		if err != nil {
+			return toolError(id, err.Error())
+		}
+		p, err := s.DB.ProposeUpdate(ctx, slug, 0, rev.Fields())
+		if err != nil {
+			return toolError(id, err.Error())
+		}
+		slog.Info("tool call", "tool", "restore_entry", "slug", slug, "version", version, "proposed", true)
+		return proposalResult(id, p)
+	}
+	if version > 0 {
+		if err := s.DB.RestoreRevision(ctx, slug, version); err != nil {
+			return toolError(id, err.Error())
+		}
+	} else if err := s.DB.RestoreEntry(ctx, slug); err != nil {
+		return toolError(id, err.Error())
+	}
+	entry, err := s.DB.GetEntry(ctx, slug)
+	if err != nil {
+		return toolError(id, err.Error())
+	}
+	slog.Info("tool call", "tool", "restore_entry", "slug", slug, "version", version)
+	return toolResult(id, entry)
+}
+
+func (s *Server) toolGetRelatedEntries(ctx context.Context, id any, args map[string]any) *jsonrpcResponse {
+	slug := str(args, "slug")
+	if slug == "" {
+		return toolError(id, "slug is required")
+	}
+	depth := intVal(args, "depth", 1)
+	related, err := s.DB.GetRelated(ctx, slug, depth, strSlice(args, "types"), boolVal(args, "include_proposed"))
+	if err != nil {
+		return toolError(id, err.Error())
+	}
+	slog.Info("tool call", "tool", "get_related_entries", "slug", slug, "depth", depth, "items", len(related))
+	return toolResult(id, related)
+}
+
+func (s *Server) toolGetLockStatus(ctx context.Context, id any) *jsonrpcResponse {
+	locks, err := s.DB.Locks(ctx)
+	if err != nil {
+		return toolError(id, err.Error())
+	}
+	if locks == nil {
+		locks = []db.WriteLock{}
+	}
+	locked := slices.ContainsFunc(locks, func(l db.WriteLock) bool { return l.IsGlobal() })
+	slog.Info("tool call", "tool", "get_lock_status", "locked", locked, "items", len(locks))
+	return toolResult(id, map[string]any{"locked": locked, "locks": locks})
+}
+
 // --- Resources ---
 
 const howToUseSlug = "how-to-use"
@@ -473,27 +776,42 @@ func defaultHowToUseEntry() db.Entry {
 
 const howToUseURI = "mcpedia://how-to-use"
 
-// ensureHowToUseFirst ensures how-to-use is first: moves it to front if present in DB, injects default if not.
-func ensureHowToUseFirst(entries []db.Entry) []db.Entry {
-	for i, e := range entries {
-		if e.Slug == howToUseSlug {
-			if i == 0 {
-				return entries
-			}
-			out := make([]db.Entry, 0, len(entries))
-			out = append(out, e)
-			out = append(out, entries[:i]...)
-			out = append(out, entries[i+1:]...)
-			return out
+// getEntry is DB.GetEntry, with the built-in how-to-use entry when the user
+// has not written one. Draft and proposed entries, and backlinks from them,
+// are not found unless includeUnapproved is set.
+func (s *Server) getEntry(ctx context.Context, slug string, includeUnapproved bool) (*db.Entry, error) {
+	e, err := s.DB.GetEntry(ctx, slug)
+	switch {
+	case err != nil:
+	case !includeUnapproved && e.Status != db.StatusApproved:
+		e, err = nil, fmt.Errorf("entry not found: %s is %s and awaiting review: %w", slug, e.Status, db.ErrNotFound)
+	case includeUnapproved:
+		if e.Backlinks, err = s.DB.Backlinks(ctx, slug, true); err != nil {
+			return nil, err
 		}
 	}
-	// Not in DB: prepend default (user can replace by creating their own)
-	out := make([]db.Entry, 0, len(entries)+1)
-	out = append(out, defaultHowToUseEntry())
-	out = append(out, entries...)
-	return out
+	if slug == howToUseSlug && errors.Is(err, db.ErrNotFound) {
+		d := defaultHowToUseEntry()
+		return &d, nil
+	}
+	return e, err
 }
 
+// howToUseMeta returns the user's how-to-use entry if there is one, else the built-in default.
+func (s *Server) howToUseMeta(ctx context.Context) (db.Entry, error) {
+	e, err := s.DB.GetEntryMeta(ctx, howToUseSlug)
+	if errors.Is(err, db.ErrNotFound) || err == nil && e.Status != db.StatusApproved {
+		return defaultHowToUseEntry(), nil
+	}
+	if err != nil {
+		return db.Entry{}, err
+	}
+	return *e, nil
+}
+
+// resourcesCursorPrefix marks a resources/list cursor; the rest is the last slug listed.
+const resourcesCursorPrefix = "after:"
+
 func (s *Server) handleResourcesList(ctx context.Context, req jsonrpcRequest) *jsonrpcResponse {
 	var params struct {
 		Cursor string `json:"cursor"`
@@ -502,33 +820,35 @@ func (s *Server) handleResourcesList(ctx context.Context, req jsonrpcRequest) *j
 		json.Unmarshal(req.Params, &params)
 	}
 
-	offset := 0
-	if params.Cursor != "" {
-		decoded, err := base64.StdEncoding.DecodeString(params.Cursor)
-		if err == nil {
-			offset, _ = strconv.Atoi(string(decoded))
+	// how-to-use is always first, so it is listed on the first page and
+	// skipped in the slug order that the remaining pages follow.
+	var page []db.Entry
+	after := ""
+	if params.Cursor == "" {
+		e, err := s.howToUseMeta(ctx)
+		if err != nil {
+			return rpcErr(req.ID, -32603, err.Error())
 		}
+		page = append(page, e)
+	} else {
+		decoded, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+		if err != nil || !strings.HasPrefix(string(decoded), resourcesCursorPrefix) {
+			return rpcErr(req.ID, -32602, "Invalid params: invalid cursor")
+		}
+		after = strings.TrimPrefix(string(decoded), resourcesCursorPrefix)
 	}
 
-	entries, err := s.DB.ListEntries(ctx, db.Filter{})
+	// One extra row tells whether another page follows, and one more covers
+	// skipping how-to-use.
+	want := resourcesPerPage - len(page)
+	entries, err := s.DB.ListEntriesAfter(ctx, after, want+2)
 	if err != nil {
 		return rpcErr(req.ID, -32603, err.Error())
 	}
-
-	// Ensure how-to-use is first: from DB if user added one, else built-in default
-	entries = ensureHowToUseFirst(entries)
-
-	// Apply pagination
-	end := offset + resourcesPerPage
-	if end > len(entries) {
-		end = len(entries)
-	}
-	page := entries
-	if offset < len(entries) {
-		page = entries[offset:end]
-	} else {
-		page = nil
-	}
+	entries = slices.DeleteFunc(entries, func(e db.Entry) bool { return e.Slug == howToUseSlug })
+	more := len(entries) > want
+	entries = entries[:min(want, len(entries))]
+	page = append(page, entries...)
 
 	resources := make([]map[string]any, 0, len(page))
 	for _, e := range page {
@@ -542,10 +862,11 @@ func (s *Server) handleResourcesList(ctx context.Context, req jsonrpcRequest) *j
 	}
 
 	result := map[string]any{"resources": resources}
-	if end < len(entries) {
-		result["nextCursor"] = base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	if more {
+		last := entries[len(entries)-1].Slug
+		result["nextCursor"] = base64.RawURLEncoding.EncodeToString([]byte(resourcesCursorPrefix + last))
 	}
-	slog.Info("resource call", "resource", "list", "items", len(resources), "total", len(entries))
+	slog.Info("resource call", "resource", "list", "items", len(resources))
 	return rpcResult(req.ID, result)
 }
 
@@ -559,17 +880,11 @@ func (s *Server) handleResourcesRead(ctx context.Context, req jsonrpcRequest) *j
 
 	// Dedicated how-to-use URI (no slug param)
 	if params.URI == howToUseURI {
-		var content string
-		entry, err := s.DB.GetEntry(ctx, howToUseSlug)
+		entry, err := s.getEntry(ctx, howToUseSlug, false)
 		if err != nil {
-			if errors.Is(err, db.ErrNotFound) {
-				content = strings.TrimSpace(defaultHowToUseContent)
-			} else {
-				return rpcErr(req.ID, -32002, err.Error())
-			}
-		} else {
-			content = entry.Content
+			return rpcErr(req.ID, -32002, err.Error())
 		}
+		content := entry.Content
 		slog.Info("resource call", "resource", "read", "uri", howToUseURI)
 		return rpcResult(req.ID, map[string]any{
 			"contents": []map[string]any{
@@ -582,24 +897,38 @@ func (s *Server) handleResourcesRead(ctx context.Context, req jsonrpcRequest) *j
 		})
 	}
 
-	slug := strings.TrimPrefix(params.URI, "mcpedia://entries/")
+	if slug, name, ok := strings.Cut(strings.TrimPrefix(params.URI, "mcpedia://entries/"), "/attachments/"); ok && slug != params.URI {
+		return s.readAttachment(ctx, req.ID, params.URI, slug, name)
+	}
+
+	// mcpedia://entries/{slug}#{heading} reads one section, and an empty
+	// heading the table of contents
+	slug, heading, hasFragment := strings.Cut(strings.TrimPrefix(params.URI, "mcpedia://entries/"), "#")
 	if slug == "" || slug == params.URI {
 		return rpcErr(req.ID, -32002, "Invalid resource URI: "+params.URI)
 	}
+	heading, err := url.PathUnescape(heading)
+	if err != nil {
+		return rpcErr(req.ID, -32002, "Invalid resource URI: "+params.URI)
+	}
 
-	var content string
-	entry, err := s.DB.GetEntry(ctx, slug)
+	entry, err := s.getEntry(ctx, slug, false)
 	if err != nil {
-		if slug == howToUseSlug && errors.Is(err, db.ErrNotFound) {
-			content = strings.TrimSpace(defaultHowToUseContent)
-		} else {
+		return rpcErr(req.ID, -32002, err.Error())
+	}
+	content := entry.Content
+	switch {
+	case hasFragment && heading == "":
+		content = outlineMarkdown(db.EntryOutline(entry))
+	case hasFragment:
+		section, err := db.EntrySection(entry, heading)
+		if err != nil {
 			return rpcErr(req.ID, -32002, err.Error())
 		}
-	} else {
-		content = entry.Content
+		content = section.Content
 	}
 
-	slog.Info("resource call", "resource", "read", "slug", slug)
+	slog.Info("resource call", "resource", "read", "slug", slug, "heading", heading)
 	return rpcResult(req.ID, map[string]any{
 		"contents": []map[string]any{
 			{
@@ -611,8 +940,33 @@ func (s *Server) handleResourcesRead(ctx context.Context, req jsonrpcRequest) *j
 	})
 }
 
+// readAttachment serves mcpedia://entries/{slug}/attachments/{name} as a blob resource.
+func (s *Server) readAttachment(ctx context.Context, id any, uri, slug, name string) *jsonrpcResponse {
+	meta, err := s.DB.GetEntryMeta(ctx, slug)
+	if err == nil && meta.Status != db.StatusApproved {
+		err = fmt.Errorf("entry not found: %s is %s and awaiting review: %w", slug, meta.Status, db.ErrNotFound)
+	}
+	if err != nil {
+		return rpcErr(id, -32002, err.Error())
+	}
+	a, err := s.DB.GetAttachment(ctx, slug, name)
+	if err != nil {
+		return rpcErr(id, -32002, err.Error())
+	}
+	slog.Info("resource call", "resource", "read", "slug", slug, "attachment", name, "size", a.Size)
+	return rpcResult(id, map[string]any{
+		"contents": []map[string]any{
+			{
+				"uri":      uri,
+				"mimeType": a.MIMEType,
+				"blob":     base64.StdEncoding.EncodeToString(a.Data),
+			},
+		},
+	})
+}
+
 func (s *Server) handleResourcesTemplatesList(req jsonrpcRequest) *jsonrpcResponse {
-	slog.Info("resource call", "resource", "templates_list", "items", 2)
+	slog.Info("resource call", "resource", "templates_list", "items", 4)
 	return rpcResult(req.ID, map[string]any{
 		"resourceTemplates": []map[string]any{
 			{
@@ -627,10 +981,36 @@ func (s *Server) handleResourcesTemplatesList(req jsonrpcRequest) *jsonrpcRespon
 				"description": "Access a knowledge entry by its slug",
 				"mimeType":    "text/markdown",
 			},
+			{
+				"uriTemplate": "mcpedia://entries/{slug}#{heading}",
+				"name":        "MCPedia Entry Section",
+				"description": "One section of an entry, by heading (with its subsections); an empty heading returns the table of contents",
+				"mimeType":    "text/markdown",
+			},
+			{
+				"uriTemplate": "mcpedia://entries/{slug}/attachments/{name}",
+				"name":        "MCPedia Entry Attachment",
+				"description": "A file attached to an entry (diagram, sample config, fixture), as a blob; get_entry lists an entry's attachments",
+			},
 		},
 	})
 }
 
+// outlineMarkdown renders a table of contents as a nested list of links to
+// the sections.
+func outlineMarkdown(o *db.Outline) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s: contents\n\n", o.Title)
+	for _, h := range o.Sections {
+		fmt.Fprintf(&b, "%s- [%s](mcpedia://entries/%s#%s) (%d bytes)\n",
+			strings.Repeat("  ", h.Level-1), h.Heading, o.Slug, url.PathEscape(h.Heading), h.Bytes)
+	}
+	if len(o.Sections) == 0 {
+		b.WriteString("This entry has no headings.\n")
+	}
+	return b.String()
+}
+
 // --- Prompts ---
 
 func (s *Server) handlePromptsList(req jsonrpcRequest) *jsonrpcResponse {
@@ -678,7 +1058,7 @@ func (s *Server) handlePromptsGet(ctx context.Context, req jsonrpcRequest) *json
 		if slug == "" {
 			return rpcErr(req.ID, -32602, "slug argument is required")
 		}
-		entry, err := s.DB.GetEntry(ctx, slug)
+		entry, err := s.getEntry(ctx, slug, false)
 		if err != nil {
 			return rpcErr(req.ID, -32602, err.Error())
 		}
@@ -701,7 +1081,7 @@ func (s *Server) handlePromptsGet(ctx context.Context, req jsonrpcRequest) *json
 		if slug == "" {
 			return rpcErr(req.ID, -32602, "slug argument is required")
 		}
-		entry, err := s.DB.GetEntry(ctx, slug)
+		entry, err := s.getEntry(ctx, slug, false)
 		if err != nil {
 			return rpcErr(req.ID, -32602, err.Error())
 		}
@@ -732,7 +1112,7 @@ func (s *Server) handlePromptsGet(ctx context.Context, req jsonrpcRequest) *json
 
 1. Determine if it's a skill, rule, context, pattern, reference, or guide
 2. Choose a descriptive slug (e.g. "rust-error-handling", "project-foo-auth-flow")
-3. Write concise, actionable content (under 32KB)
+3. Write concise, actionable content (under 32KB; split larger guides with headings)
 4. Assign appropriate language, domain, project, and tags
 
 Use the create_entry tool to save each piece. Keep entries granular -- one concept per entry.`,
@@ -752,57 +1132,88 @@ func toolDefinitions() []map[string]any {
 	return []map[string]any{
 		{
 			"name":        "search_entries",
-			"description": "Search knowledge entries using full-text search. Returns matching entries with snippets (no full content).",
+			"description": "Search knowledge entries. Returns a page of matching entries with snippets (no full content), the total number of matches, and next_cursor when more remain. For entries over 32 KB, section names the heading the snippet comes from (see get_entry). The default keyword mode matches exact terms with full-text search; semantic mode matches related words and synonyms (e.g. \"handle failures\" finds error handling); hybrid combines both rankings. Query syntax: words (all must match), \"exact phrase\", title:word, prefix*, a OR b, -exclude, and filters tag:, lang:, kind:, domain:, project:. Entries past their review date are marked stale: review_due, and entries past their expiry date stale: expired; treat those with caution.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"query":    map[string]any{"type": "string", "description": "Search query"},
-					"language": map[string]any{"type": "string", "description": "Filter by programming language"},
-					"domain":   map[string]any{"type": "string", "description": "Filter by domain (e.g. fintech, ml, cli)"},
-					"kind":     map[string]any{"type": "string", "description": "Filter by kind (skill, rule, context, pattern, reference, guide)"},
-					"tag":      map[string]any{"type": "string", "description": "Filter by tag"},
-					"project":  map[string]any{"type": "string", "description": "Filter by project"},
-					"limit":    map[string]any{"type": "integer", "description": "Max results (default 10, max 50)"},
+					"query":            map[string]any{"type": "string", "description": "Search query, e.g. 'title:\"error handling\" lang:rust -unsafe'"},
+					"language":         map[string]any{"type": "string", "description": "Filter by programming language"},
+					"domain":           map[string]any{"type": "string", "description": "Filter by domain (e.g. fintech, ml, cli)"},
+					"kind":             map[string]any{"type": "string", "description": "Filter by kind (skill, rule, context, pattern, reference, guide)"},
+					"tag":              map[string]any{"type": "string", "description": "Filter by tag"},
+					"project":          map[string]any{"type": "string", "description": "Filter by project"},
+					"limit":            map[string]any{"type": "integer", "description": "Page size (default 10, max 50)"},
+					"cursor":           map[string]any{"type": "string", "description": "next_cursor from the previous page"},
+					"mode":             map[string]any{"type": "string", "enum": db.SearchModes, "description": "keyword (default), semantic, or hybrid"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also return draft and proposed entries awaiting review (hidden by default)"},
+					"namespaces": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Search these knowledge bases instead of this one, when the server mounts several (\"*\" for all); results are labeled with their namespace and interleaved by rank, without paging",
+					},
 				},
 				"required": []string{"query"},
 			},
 		},
 		{
 			"name":        "get_entry",
-			"description": "Get a single knowledge entry by its slug, including full content.",
+			"description": "Get a single knowledge entry by its slug, including full content, the slugs it references as [[slug]] (links), the entries that reference it (backlinks), and its attachments (read them as resources at mcpedia://entries/{slug}/attachments/{name}). Pass section to get only the part of the content under one Markdown heading, e.g. the section named in a search result of a large entry.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"slug":             map[string]any{"type": "string", "description": "The unique slug of the entry"},
+					"section":          map[string]any{"type": "string", "description": "Heading text of the section to return, with its subsections (case-insensitive)"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also read a draft or proposed entry awaiting review"},
+				},
+				"required": []string{"slug"},
+			},
+		},
+		{
+			"name":        "get_entry_section",
+			"description": "Read a long entry one part at a time. Without heading, returns the entry's table of contents: every Markdown heading with its level and size in bytes. With heading, returns the entry with only that section's content (including its subsections).",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"slug": map[string]any{"type": "string", "description": "The unique slug of the entry"},
+					"slug":             map[string]any{"type": "string", "description": "The unique slug of the entry"},
+					"heading":          map[string]any{"type": "string", "description": "Heading text of the section to return (case-insensitive); omit for the table of contents"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also read a draft or proposed entry awaiting review"},
 				},
 				"required": []string{"slug"},
 			},
 		},
 		{
 			"name":        "get_entries_by_context",
-			"description": "Get all entries matching the given context (language, domain, kind, tags, project). Returns full content. Use this at the start of a task to load relevant knowledge.",
+			"description": "Get all entries matching the given context (language, domain, kind, tags, project). Returns a page of entries with full content, the total number of matches, and next_cursor when more remain. Use this at the start of a task to load relevant knowledge. With max_tokens or max_bytes, instead returns the best-ranked entries (rules and context first, then most used and most recent) that fit the budget, in rank order: each entry whole if it fits, else its description only (listed in truncated), with entries that did not fit at all listed in omitted (and, past the best 200 matches, only counted in omitted_unlisted). Entries past their review or expiry date are marked with stale; pass exclude_expired to leave expired entries out.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"language": map[string]any{"type": "string", "description": "Programming language"},
-					"domain":   map[string]any{"type": "string", "description": "Domain"},
-					"kind":     map[string]any{"type": "string", "description": "Entry kind"},
-					"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Tags to match (all must be present)"},
-					"project":  map[string]any{"type": "string", "description": "Project slug"},
-					"limit":    map[string]any{"type": "integer", "description": "Max results (default 20, max 50)"},
+					"language":         map[string]any{"type": "string", "description": "Programming language"},
+					"domain":           map[string]any{"type": "string", "description": "Domain"},
+					"kind":             map[string]any{"type": "string", "description": "Entry kind"},
+					"tags":             map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Tags to match (all must be present)"},
+					"project":          map[string]any{"type": "string", "description": "Project slug"},
+					"limit":            map[string]any{"type": "integer", "description": "Page size (default 20, max 50)"},
+					"cursor":           map[string]any{"type": "string", "description": "next_cursor from the previous page"},
+					"max_tokens":       map[string]any{"type": "integer", "description": "Budget in tokens (estimated at 4 bytes each); replaces paging"},
+					"max_bytes":        map[string]any{"type": "integer", "description": "Budget in bytes of title, description and content; replaces paging"},
+					"exclude_expired":  map[string]any{"type": "boolean", "description": "Leave out entries past their expiry date"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also return draft and proposed entries awaiting review (hidden by default)"},
 				},
 			},
 		},
 		{
 			"name":        "list_entries",
-			"description": "List all knowledge entries (slug, title, kind, language, domain -- no content). Supports optional filters.",
+			"description": "List knowledge entries (slug, title, kind, language, domain -- no content), ordered by title. Supports optional filters. Returns a page of entries, the total number of matches, and next_cursor when more remain.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"kind":     map[string]any{"type": "string", "description": "Filter by kind"},
-					"language": map[string]any{"type": "string", "description": "Filter by language"},
-					"domain":   map[string]any{"type": "string", "description": "Filter by domain"},
-					"project":  map[string]any{"type": "string", "description": "Filter by project"},
+					"kind":             map[string]any{"type": "string", "description": "Filter by kind"},
+					"language":         map[string]any{"type": "string", "description": "Filter by language"},
+					"domain":           map[string]any{"type": "string", "description": "Filter by domain"},
+					"project":          map[string]any{"type": "string", "description": "Filter by project"},
+					"limit":            map[string]any{"type": "integer", "description": "Page size (default 50, max 200)"},
+					"cursor":           map[string]any{"type": "string", "description": "next_cursor from the previous page"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also return draft and proposed entries awaiting review (hidden by default)"},
 				},
 			},
 		},
@@ -816,58 +1227,115 @@ func toolDefinitions() []map[string]any {
 		},
 		{
 			"name":        "create_entry",
-			"description": "Create a new knowledge entry. Requires slug, title, and content. Blocked if the database is locked.",
+			"description": "Create a new knowledge entry. Requires slug, title, and content. On servers that review agent writes, the entry is created with status proposed and stays hidden from retrieval until a human approves it. Blocked if the database is locked.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"slug":        map[string]any{"type": "string", "description": "Unique slug (e.g. rust-error-handling)"},
-					"title":       map[string]any{"type": "string", "description": "Entry title"},
-					"content":     map[string]any{"type": "string", "description": "Main content (markdown, max 32KB)"},
-					"description": map[string]any{"type": "string", "description": "Short summary for discovery"},
-					"kind":        map[string]any{"type": "string", "description": "Entry kind: skill, rule, context, pattern, reference, guide"},
-					"language":    map[string]any{"type": "string", "description": "Programming language"},
-					"domain":      map[string]any{"type": "string", "description": "Domain"},
-					"project":     map[string]any{"type": "string", "description": "Project slug"},
-					"tags":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Tags"},
+					"slug":         map[string]any{"type": "string", "description": "Unique slug (e.g. rust-error-handling)"},
+					"title":        map[string]any{"type": "string", "description": "Entry title"},
+					"content":      map[string]any{"type": "string", "description": "Main content (markdown, max 1 MB; content over 32 KB is stored in sections split on its headings, each at most 32 KB)"},
+					"description":  map[string]any{"type": "string", "description": "Short summary for discovery"},
+					"kind":         map[string]any{"type": "string", "description": "Entry kind: skill, rule, context, pattern, reference, guide"},
+					"language":     map[string]any{"type": "string", "description": "Programming language"},
+					"domain":       map[string]any{"type": "string", "description": "Domain"},
+					"project":      map[string]any{"type": "string", "description": "Project slug"},
+					"tags":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Tags"},
+					"review_after": map[string]any{"type": "string", "description": "Date (YYYY-MM-DD) from which the entry is due for review, e.g. when it covers a library version"},
+					"expires_at":   map[string]any{"type": "string", "description": "Date (YYYY-MM-DD) from which the entry no longer applies"},
 				},
 				"required": []string{"slug", "title", "content"},
 			},
 		},
 		{
 			"name":        "update_entry",
-			"description": "Update an existing knowledge entry by slug. Only provided fields are updated. Blocked if the database is locked.",
+			"description": "Update an existing knowledge entry by slug. Only provided fields are updated. Pass the version you read as expected_version to fail instead of overwriting someone else's change. On servers that review agent writes, changes to approved entries are returned as a proposal awaiting human review, and the entry is unchanged until it is approved. Blocked if the database is locked.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"slug":        map[string]any{"type": "string", "description": "Slug of the entry to update"},
-					"title":       map[string]any{"type": "string", "description": "New title"},
-					"content":     map[string]any{"type": "string", "description": "New content"},
-					"description": map[string]any{"type": "string", "description": "New description"},
-					"kind":        map[string]any{"type": "string", "description": "New kind"},
-					"language":    map[string]any{"type": "string", "description": "New language"},
-					"domain":      map[string]any{"type": "string", "description": "New domain"},
-					"project":     map[string]any{"type": "string", "description": "New project"},
-					"tags":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "New tags (replaces all existing tags)"},
+					"slug":             map[string]any{"type": "string", "description": "Slug of the entry to update"},
+					"title":            map[string]any{"type": "string", "description": "New title"},
+					"content":          map[string]any{"type": "string", "description": "New content"},
+					"description":      map[string]any{"type": "string", "description": "New description"},
+					"kind":             map[string]any{"type": "string", "description": "New kind"},
+					"language":         map[string]any{"type": "string", "description": "New language"},
+					"domain":           map[string]any{"type": "string", "description": "New domain"},
+					"project":          map[string]any{"type": "string", "description": "New project"},
+					"tags":             map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "New tags (replaces all existing tags)"},
+					"review_after":     map[string]any{"type": "string", "description": "New review date (YYYY-MM-DD, empty to clear)"},
+					"expires_at":       map[string]any{"type": "string", "description": "New expiry date (YYYY-MM-DD, empty to clear)"},
+					"expected_version": map[string]any{"type": "integer", "description": "Only update if the entry is still at this version"},
 				},
 				"required": []string{"slug"},
 			},
 		},
 		{
 			"name":        "delete_entry",
-			"description": "Delete a knowledge entry by slug. Blocked if the database is locked.",
+			"description": "Delete a knowledge entry by slug. The entry is moved to the trash and can be brought back with restore_entry until it is purged. On servers that review agent writes, deleting an approved entry is proposed for human review instead. Blocked if the database is locked.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"slug":             map[string]any{"type": "string", "description": "Slug of the entry to delete"},
+					"expected_version": map[string]any{"type": "integer", "description": "Only delete if the entry is still at this version"},
+				},
+				"required": []string{"slug"},
+			},
+		},
+		{
+			"name":        "get_entry_history",
+			"description": "List the prior versions of an entry (newest first, no content). Pass a version to get that revision with its full content.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"slug":             map[string]any{"type": "string", "description": "Slug of the entry"},
+					"version":          map[string]any{"type": "integer", "description": "Return this revision with full content"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also read the history of a draft or proposed entry awaiting review"},
+				},
+				"required": []string{"slug"},
+			},
+		},
+		{
+			"name":        "restore_entry",
+			"description": "Restore a deleted entry from the trash, or, with a version, restore an entry to a prior version from its history (the current content is kept as a new revision). On servers that review agent writes, restoring a version of an approved entry is proposed for human review, and restoring from the trash is left to humans. Blocked if the database is locked.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"slug":    map[string]any{"type": "string", "description": "Slug of the entry to restore"},
+					"version": map[string]any{"type": "integer", "description": "Version to restore (see get_entry_history); omit to undelete"},
+				},
+				"required": []string{"slug"},
+			},
+		},
+		{
+			"name":        "get_related_entries",
+			"description": "Walk the links between entries (related, supersedes, depends-on) starting from a slug. Returns each reachable entry once (no content) with its depth and the link it was reached through. Links are followed in both directions.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"slug": map[string]any{"type": "string", "description": "Slug of the entry to delete"},
+					"slug":             map[string]any{"type": "string", "description": "Slug of the entry to start from"},
+					"depth":            map[string]any{"type": "integer", "description": "How many links to follow (default 1, max 5)"},
+					"types":            map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": db.LinkTypes}, "description": "Only follow these link types (default all)"},
+					"include_proposed": map[string]any{"type": "boolean", "description": "Also start from and return draft and proposed entries awaiting review (hidden by default)"},
 				},
 				"required": []string{"slug"},
 			},
 		},
+		{
+			"name":        "get_lock_status",
+			"description": "Check whether writes are locked before planning changes. Returns locked (true when the whole database is locked) and the active locks, each with its scope (project, kind, tag; none for the whole database), reason, since, and expires_at (UTC; absent when the lock lasts until a human unlocks it).",
+			"inputSchema": map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+			},
+		},
 	}
 }
 
 // --- helpers ---
 
+// bytesPerToken is the rough size of a token in English text and code, used
+// to turn a max_tokens budget into bytes.
+const bytesPerToken = 4
+
 func toolResult(id any, data any) *jsonrpcResponse {
 	j, _ := json.Marshal(data)
 	return rpcResult(id, map[string]any{
@@ -923,6 +1391,11 @@ func intVal(m map[string]any, key string, def int) int {
 	return def
 }
 
+func boolVal(m map[string]any, key string) bool {
+	v, _ := m[key].(bool)
+	return v
+}
+
 func strSlice(m map[string]any, key string) []string {
 	v, ok := m[key]
 	if !ok {
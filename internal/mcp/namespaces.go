@@ -0,0 +1,120 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pouriya/mcpedia/internal/db"
+)
+
+// namespaceRe matches namespace names: safe as a URL path segment.
+var namespaceRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Federation is a set of knowledge bases served by one process, each by its
+// own Server under /mcp/<name>. Servers added to a federation can search
+// each other (see search_entries with namespaces).
+type Federation struct {
+	names   []string
+	servers map[string]*Server
+}
+
+// NewFederation returns an empty federation.
+func NewFederation() *Federation {
+	return &Federation{servers: map[string]*Server{}}
+}
+
+// Add mounts s under /mcp/<name>. Names are lowercase letters, digits, '_'
+// and '-', and must be unique.
+func (f *Federation) Add(name string, s *Server) error {
+	if !namespaceRe.MatchString(name) {
+		return fmt.Errorf("invalid namespace name %q: use lowercase letters, digits, '_' and '-'", name)
+	}
+	if _, ok := f.servers[name]; ok {
+		return fmt.Errorf("duplicate namespace %q", name)
+	}
+	s.Namespace = name
+	s.federation = f
+	f.names = append(f.names, name)
+	f.servers[name] = s
+	return nil
+}
+
+// Names returns the namespaces in the order they were added.
+func (f *Federation) Names() []string {
+	return slices.Clone(f.names)
+}
+
+// Handler returns a handler that routes /mcp/<name> to the server of each namespace.
+func (f *Federation) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, name := range f.names {
+		mux.Handle("/mcp/"+name, f.servers[name])
+	}
+	return mux
+}
+
+// FederatedEntry is a search result labeled with the namespace it comes from.
+type FederatedEntry struct {
+	Namespace string `json:"namespace"`
+	db.Entry
+}
+
+// FederatedPage is the result of a search across namespaces.
+type FederatedPage struct {
+	Entries []FederatedEntry `json:"entries"`
+	// Total counts the matches in all namespaces searched.
+	Total      int      `json:"total"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// federatedSearch runs a search in each of the given namespaces ("*" for
+// all) and interleaves the results by rank: the best match of each
+// namespace, then the second best, and so on, up to the page limit.
+// Namespaces that do not accept the caller's token are refused.
+func (s *Server) federatedSearch(ctx context.Context, names []string, mode, query string, f db.Filter, limit int) (*FederatedPage, error) {
+	if s.federation == nil {
+		return nil, fmt.Errorf("namespaces: this server does not mount several namespaces")
+	}
+	if slices.Contains(names, "*") {
+		names = s.federation.Names()
+	}
+	token, _ := ctx.Value(tokenKey{}).(string)
+	out := &FederatedPage{Entries: []FederatedEntry{}}
+	var pages [][]db.Entry
+	for _, name := range names {
+		if slices.Contains(out.Namespaces, name) {
+			continue
+		}
+		target, ok := s.federation.servers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown namespace %q; available: %s", name, strings.Join(s.federation.names, ", "))
+		}
+		if _, err := target.authenticate(ctx, token); err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", name, err)
+		}
+		page, err := search(ctx, target.DB, mode, query, f, db.Page{Limit: limit})
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", name, err)
+		}
+		out.Namespaces = append(out.Namespaces, name)
+		out.Total += page.Total
+		pages = append(pages, page.Entries)
+	}
+	for rank := 0; len(out.Entries) < limit; rank++ {
+		added := false
+		for i, entries := range pages {
+			if rank < len(entries) && len(out.Entries) < limit {
+				out.Entries = append(out.Entries, FederatedEntry{Namespace: out.Namespaces[i], Entry: entries[rank]})
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,140 @@
+// Package sections splits Markdown into the sections delimited by its ATX
+// headings ("# Title", "## Usage", ...). Splitting is lossless: joining the
+// sections of a document gives back the document byte for byte, so entries
+// can be stored as sections and reassembled on read.
+package sections
+
+import (
+	"strings"
+)
+
+// Section is a heading and the text under it, up to the next heading of any
+// level. Content starts with the heading line itself. Text before the first
+// heading forms a section with Level 0 and no Heading.
+type Section struct {
+	Heading string `json:"heading"`
+	Level   int    `json:"level"`
+	Content string `json:"content"`
+}
+
+// Split returns the sections of markdown in order. Lines inside fenced code
+// blocks are never headings.
+func Split(markdown string) []Section {
+	var out []Section
+	cur := Section{}
+	var b strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(markdown, "\n") {
+		if line == "" {
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		default:
+			if level, heading, ok := parseHeading(line); ok {
+				if b.Len() > 0 {
+					cur.Content = b.String()
+					out = append(out, cur)
+					b.Reset()
+				}
+				cur = Section{Heading: heading, Level: level}
+			}
+		}
+		b.WriteString(line)
+	}
+	if b.Len() > 0 {
+		cur.Content = b.String()
+		out = append(out, cur)
+	}
+	return out
+}
+
+// Join concatenates the content of secs; Join(Split(s)) == s.
+func Join(secs []Section) string {
+	var b strings.Builder
+	for _, s := range secs {
+		b.WriteString(s.Content)
+	}
+	return b.String()
+}
+
+// Heading is one line of a table of contents.
+type Heading struct {
+	Heading string `json:"heading"`
+	Level   int    `json:"level"`
+	// Bytes is the size of the section, including its subsections.
+	Bytes int `json:"bytes"`
+}
+
+// Outline returns the table of contents of secs: every heading, in order.
+// Text before the first heading is not listed.
+func Outline(secs []Section) []Heading {
+	out := []Heading{}
+	for i, s := range secs {
+		if s.Level == 0 {
+			continue
+		}
+		h := Heading{Heading: s.Heading, Level: s.Level}
+		for _, sub := range secs[i:subtreeEnd(secs, i)] {
+			h.Bytes += len(sub.Content)
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// Find returns the range [start, end) of secs covered by the first section
+// whose heading matches heading, case-insensitively: the section itself and
+// the subsections under it, up to the next heading of the same or a higher
+// level.
+func Find(secs []Section, heading string) (start, end int, ok bool) {
+	heading = strings.TrimSpace(heading)
+	for i, s := range secs {
+		if s.Level != 0 && strings.EqualFold(s.Heading, heading) {
+			return i, subtreeEnd(secs, i), true
+		}
+	}
+	return 0, 0, false
+}
+
+// subtreeEnd returns the index just past the last subsection of secs[i].
+func subtreeEnd(secs []Section, i int) int {
+	end := i + 1
+	for end < len(secs) && secs[end].Level > secs[i].Level {
+		end++
+	}
+	return end
+}
+
+// parseHeading reports whether line is an ATX heading and returns its level
+// and text, without the markers and any closing #s.
+func parseHeading(line string) (level int, heading string, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent > 3 {
+		return 0, "", false
+	}
+	line = line[indent:]
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+	rest := line[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, "", false
+	}
+	rest = strings.TrimSpace(rest)
+	// A closing sequence of #s must be preceded by a space
+	if trimmed := strings.TrimRight(rest, "#"); trimmed != rest && (trimmed == "" || strings.HasSuffix(trimmed, " ")) {
+		rest = strings.TrimSpace(trimmed)
+	}
+	return level, rest, true
+}
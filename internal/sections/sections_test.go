@@ -0,0 +1,85 @@
+package sections
+
+import (
+	"slices"
+	"testing"
+)
+
+const doc = `Intro line.
+
+# Guide
+
+Overview.
+
+## Install ##
+
+` + "```sh\n# not a heading\n```" + `
+
+### From source
+
+Build it.
+
+## Usage
+Run it.
+#hashtag is not a heading
+`
+
+func TestSplit(t *testing.T) {
+	secs := Split(doc)
+	want := []struct {
+		heading string
+		level   int
+	}{{"", 0}, {"Guide", 1}, {"Install", 2}, {"From source", 3}, {"Usage", 2}}
+	if len(secs) != len(want) {
+		t.Fatalf("got %d sections, want %d: %+v", len(secs), len(want), secs)
+	}
+	for i, w := range want {
+		if secs[i].Heading != w.heading || secs[i].Level != w.level {
+			t.Errorf("section %d: got %q level %d, want %q level %d", i, secs[i].Heading, secs[i].Level, w.heading, w.level)
+		}
+	}
+	if got := Join(secs); got != doc {
+		t.Errorf("Join(Split(doc)) changed the document:\n%s", got)
+	}
+	if len(Split("")) != 0 {
+		t.Error("empty document should have no sections")
+	}
+}
+
+func TestFind(t *testing.T) {
+	secs := Split(doc)
+	start, end, ok := Find(secs, " install ")
+	if !ok || start != 2 || end != 4 {
+		t.Errorf("Find(install): got %d, %d, %v; want 2, 4, true", start, end, ok)
+	}
+	if start, end, ok := Find(secs, "Guide"); !ok || start != 1 || end != 5 {
+		t.Errorf("Find(Guide): got %d, %d, %v; want 1, 5, true", start, end, ok)
+	}
+	if _, _, ok := Find(secs, "missing"); ok {
+		t.Error("Find(missing) should fail")
+	}
+	if _, _, ok := Find(secs, ""); ok {
+		t.Error("the untitled intro should not be found")
+	}
+}
+
+func TestOutline(t *testing.T) {
+	secs := Split(doc)
+	got := Outline(secs)
+	var names []string
+	for _, h := range got {
+		names = append(names, h.Heading)
+	}
+	if !slices.Equal(names, []string{"Guide", "Install", "From source", "Usage"}) {
+		t.Fatalf("Outline: got %v", names)
+	}
+	if want := len(secs[2].Content) + len(secs[3].Content); got[1].Bytes != want {
+		t.Errorf("Install bytes: got %d, want %d", got[1].Bytes, want)
+	}
+	if want := len(doc) - len(secs[0].Content); got[0].Bytes != want {
+		t.Errorf("Guide bytes: got %d, want %d", got[0].Bytes, want)
+	}
+	if got := Outline(Split("no headings")); len(got) != 0 {
+		t.Errorf("no headings: got %v", got)
+	}
+}
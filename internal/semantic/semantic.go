@@ -0,0 +1,239 @@
+// Package semantic builds small, local vector representations of entries for
+// similarity search. It needs no model files or network access: text is
+// tokenized, stemmed, mapped through a synonym table, and hashed into a
+// sparse term-frequency vector. IDF weighting is applied at query time
+// over the vectors being ranked, so stored vectors never go stale as the
+// knowledge base grows.
+package semantic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Dims is the number of hash buckets terms are spread over. Vectors are
+// sparse, so a large space costs nothing and keeps unrelated terms from
+// colliding.
+const Dims = 1 << 20
+
+// Field weights: a term in the title says more about an entry than one in the body.
+const (
+	titleWeight       = 3
+	tagWeight         = 2
+	descriptionWeight = 2
+	contentWeight     = 1
+)
+
+// Vector is a sparse, hashed, sublinear term-frequency vector: bucket -> weight.
+type Vector map[uint32]float32
+
+// EmbedEntry builds the vector for an entry.
+func EmbedEntry(title, description, content string, tags []string) Vector {
+	counts := map[uint32]float64{}
+	add := func(text string, weight float64) {
+		for _, t := range Terms(text) {
+			counts[bucket(t)] += weight
+		}
+	}
+	add(title, titleWeight)
+	add(strings.Join(tags, " "), tagWeight)
+	add(description, descriptionWeight)
+	add(content, contentWeight)
+	return sublinear(counts)
+}
+
+// EmbedQuery builds the vector for a search query.
+func EmbedQuery(query string) Vector {
+	counts := map[uint32]float64{}
+	for _, t := range Terms(query) {
+		counts[bucket(t)]++
+	}
+	return sublinear(counts)
+}
+
+// IsZero reports whether v has no terms, e.g. a query made only of stopwords.
+func (v Vector) IsZero() bool {
+	return len(v) == 0
+}
+
+// Rank scores each document against the query by cosine similarity of
+// TF-IDF weighted vectors, with document frequencies taken from docs.
+// Scores are in [0, 1]; documents sharing no terms with the query score 0.
+func Rank(query Vector, docs []Vector) []float64 {
+	df := map[uint32]int{}
+	for _, d := range docs {
+		for i := range d {
+			df[i]++
+		}
+	}
+	n := float64(len(docs))
+	idf := func(i uint32) float64 {
+		return math.Log((n+1)/(float64(df[i])+1)) + 1
+	}
+
+	var qNorm float64
+	for i, x := range query {
+		w := float64(x) * idf(i)
+		qNorm += w * w
+	}
+	scores := make([]float64, len(docs))
+	if qNorm == 0 {
+		return scores
+	}
+	for j, d := range docs {
+		var dot, dNorm float64
+		for i, x := range d {
+			w := float64(x) * idf(i)
+			dNorm += w * w
+			if qx, ok := query[i]; ok {
+				dot += w * float64(qx) * idf(i)
+			}
+		}
+		if dNorm > 0 {
+			scores[j] = dot / (math.Sqrt(qNorm) * math.Sqrt(dNorm))
+		}
+	}
+	return scores
+}
+
+// Encode serializes v as (bucket uint32, weight float32) little-endian pairs,
+// ordered by bucket.
+func Encode(v Vector) []byte {
+	keys := make([]uint32, 0, len(v))
+	for i := range v {
+		keys = append(keys, i)
+	}
+	slices.Sort(keys)
+	b := make([]byte, 8*len(v))
+	for n, i := range keys {
+		binary.LittleEndian.PutUint32(b[8*n:], i)
+		binary.LittleEndian.PutUint32(b[8*n+4:], math.Float32bits(v[i]))
+	}
+	return b
+}
+
+// Decode parses a vector written by Encode.
+func Decode(b []byte) (Vector, error) {
+	if len(b)%8 != 0 {
+		return nil, fmt.Errorf("vector has %d bytes, want a multiple of 8", len(b))
+	}
+	v := make(Vector, len(b)/8)
+	for n := 0; n < len(b); n += 8 {
+		i := binary.LittleEndian.Uint32(b[n:])
+		if i >= Dims {
+			return nil, fmt.Errorf("vector bucket %d out of range", i)
+		}
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[n+4:]))
+	}
+	return v, nil
+}
+
+// Terms splits text into normalized terms: lowercased, stopwords dropped,
+// stemmed, and mapped to a canonical synonym.
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if len(w) < 2 || stopwords[w] {
+			continue
+		}
+		t := stem(w)
+		if s, ok := synonyms[t]; ok {
+			t = s
+		}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+func bucket(term string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(term))
+	return h.Sum32() % Dims
+}
+
+func sublinear(counts map[uint32]float64) Vector {
+	v := make(Vector, len(counts))
+	for i, c := range counts {
+		v[i] = float32(1 + math.Log(c))
+	}
+	return v
+}
+
+// suffixes are stripped longest-first, at most one per word, keeping a stem of
+// at least three letters. This is deliberately cruder than a Porter stemmer:
+// it only has to map related forms to the same term, not produce real words.
+var suffixes = []string{
+	"ations", "ation", "ments", "ment", "ness", "fully", "ously", "ings", "ing",
+	"ities", "ity", "ers", "ful", "ous", "ies", "ied", "er", "ed", "ly", "es", "s", "e",
+}
+
+func stem(w string) string {
+	for _, s := range suffixes {
+		if !strings.HasSuffix(w, s) || len(w)-len(s) < 3 {
+			continue
+		}
+		if s == "s" && strings.HasSuffix(w, "ss") {
+			return w
+		}
+		return w[:len(w)-len(s)]
+	}
+	return w
+}
+
+// synonymGroups lists words that should match each other. Every word in a
+// group is mapped to the (stemmed) first word.
+var synonymGroups = [][]string{
+	{"error", "errors", "failure", "fail", "failed", "fault", "exception", "crash", "panic"},
+	{"handle", "handling", "manage", "deal", "cope", "recover", "recovery"},
+	{"test", "testing", "spec", "verify", "verification", "assert", "assertion"},
+	{"function", "method", "func", "procedure", "routine"},
+	{"database", "db", "storage", "persistence", "sql", "sqlite"},
+	{"config", "configuration", "setting", "settings", "option", "options", "preference"},
+	{"performance", "perf", "fast", "quick", "speed", "latency", "slow", "optimize", "optimization"},
+	{"security", "secure", "auth", "authentication", "authorization", "permission", "credential"},
+	{"delete", "remove", "drop", "erase"},
+	{"create", "add", "insert"},
+	{"start", "begin", "launch", "init", "initialize", "boot", "startup"},
+	{"log", "logging", "logger", "trace", "tracing"},
+	{"documentation", "doc", "docs", "docstring", "comment"},
+	{"concurrency", "concurrent", "parallel", "async", "thread", "goroutine"},
+	{"retry", "retries", "backoff"},
+	{"deploy", "deployment", "release", "ship", "rollout"},
+	{"dependency", "dependencies", "package", "library", "module", "crate"},
+	{"style", "format", "formatting", "lint", "linting", "convention"},
+}
+
+var synonyms = buildSynonyms(synonymGroups)
+
+func buildSynonyms(groups [][]string) map[string]string {
+	m := map[string]string{}
+	for _, g := range groups {
+		canonical := stem(g[0])
+		for _, w := range g {
+			m[stem(w)] = canonical
+		}
+	}
+	return m
+}
+
+var stopwords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(`a about above after again against all am an and any are as at be
+		because been before being below between both but by can could did do does doing down during each
+		few for from further had has have having he her here hers him his how i if in into is it its itself
+		just me more most my no nor not now of off on once only or other our ours out over own same she
+		should so some such than that the their theirs them then there these they this those through to
+		too under until up very was we were what when where which while who whom why will with would you
+		your yours use using used way ways`) {
+		m[w] = true
+	}
+	return m
+}()
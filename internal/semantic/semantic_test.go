@@ -0,0 +1,53 @@
+package semantic
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	got := Terms("Handling failures gracefully, the errors were handled")
+	want := []string{"handl", "error", "grace", "error", "handl"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Terms: got %v, want %v", got, want)
+	}
+	if got := Terms("the and of"); len(got) != 0 {
+		t.Errorf("stopwords only: got %v", got)
+	}
+	if got := Terms("class classes"); !slices.Equal(got, []string{"class", "class"}) {
+		t.Errorf("double s: got %v", got)
+	}
+}
+
+func TestRank(t *testing.T) {
+	docs := []Vector{
+		EmbedEntry("Rust Error Handling", "Idiomatic error handling patterns in Rust", "Use Result<T, E> for recoverable errors.", []string{"rust", "errors"}),
+		EmbedEntry("Go Testing Patterns", "Table-driven tests", "Use t.Run for subtests.", []string{"go", "testing"}),
+		EmbedEntry("Python Logging", "Structured logs", "Configure the root logger once.", nil),
+	}
+	scores := Rank(EmbedQuery("handle failures gracefully"), docs)
+	if scores[0] <= scores[1] || scores[0] <= scores[2] {
+		t.Errorf("expected error handling entry to rank first, got %v", scores)
+	}
+	if scores[1] != 0 {
+		t.Errorf("unrelated entry should score 0, got %v", scores[1])
+	}
+	if !EmbedQuery("the of and").IsZero() {
+		t.Error("stopword query should embed to zero")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	v := EmbedEntry("title", "description", "some content here", []string{"tag"})
+	got, err := Decode(Encode(v))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !maps.Equal(got, v) {
+		t.Error("round trip changed the vector")
+	}
+	if _, err := Decode([]byte{1, 2, 3}); err == nil {
+		t.Error("expected error for truncated vector")
+	}
+}
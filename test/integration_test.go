@@ -3,18 +3,30 @@ package test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pouriya/mcpedia/internal/db"
 	"github.com/pouriya/mcpedia/internal/importfm"
 	"github.com/pouriya/mcpedia/internal/mcp"
+	_ "modernc.org/sqlite"
 )
 
 // jsonrpcResponse mirrors the unexported type for test decoding.
@@ -103,6 +115,16 @@ func toolCall(t *testing.T, url string, name string, args map[string]any) (jsonr
 	return resp, text, isErr
 }
 
+// pageEntries decodes the entries of a paged tool result.
+func pageEntries(t *testing.T, text string) []db.Entry {
+	t.Helper()
+	var page db.EntryPage
+	if err := json.Unmarshal([]byte(text), &page); err != nil {
+		t.Fatalf("decode page %q: %v", text, err)
+	}
+	return page.Entries
+}
+
 // createEntry is a shortcut to create an entry via the tool.
 func createEntry(t *testing.T, url string, slug, title, content, kind, language, domain, project string, tags []string) {
 	t.Helper()
@@ -168,8 +190,8 @@ func TestToolsList(t *testing.T) {
 		t.Fatalf("error: %+v", resp.Error)
 	}
 	tools := resp.Result.(map[string]any)["tools"].([]any)
-	if len(tools) != 8 {
-		t.Fatalf("expected 8 tools, got %d", len(tools))
+	if len(tools) != 13 {
+		t.Fatalf("expected 13 tools, got %d", len(tools))
 	}
 	names := map[string]bool{}
 	for _, tool := range tools {
@@ -179,7 +201,7 @@ func TestToolsList(t *testing.T) {
 			t.Errorf("tool %s missing inputSchema", tm["name"])
 		}
 	}
-	for _, want := range []string{"search_entries", "get_entry", "get_entries_by_context", "list_entries", "list_tags", "create_entry", "update_entry", "delete_entry"} {
+	for _, want := range []string{"search_entries", "get_entry", "get_entry_section", "get_entries_by_context", "list_entries", "list_tags", "create_entry", "update_entry", "delete_entry", "get_entry_history", "restore_entry", "get_related_entries", "get_lock_status"} {
 		if !names[want] {
 			t.Errorf("missing tool: %s", want)
 		}
@@ -360,8 +382,7 @@ func TestListEntries(t *testing.T) {
 	createEntry(t, ts.URL, "general", "Git Basics", "git content", "reference", "", "", "", nil)
 
 	_, text, _ := toolCall(t, ts.URL, "list_entries", map[string]any{})
-	var all []db.Entry
-	json.Unmarshal([]byte(text), &all)
+	all := pageEntries(t, text)
 	if len(all) != 5 {
 		t.Errorf("all: got %d, want 5", len(all))
 	}
@@ -372,22 +393,19 @@ func TestListEntries(t *testing.T) {
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "list_entries", map[string]any{"language": "go"})
-	var goEntries []db.Entry
-	json.Unmarshal([]byte(text), &goEntries)
+	goEntries := pageEntries(t, text)
 	if len(goEntries) != 2 {
 		t.Errorf("go entries: %d", len(goEntries))
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "list_entries", map[string]any{"kind": "guide"})
-	var guides []db.Entry
-	json.Unmarshal([]byte(text), &guides)
+	guides := pageEntries(t, text)
 	if len(guides) != 1 {
 		t.Errorf("guides: %d", len(guides))
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "list_entries", map[string]any{"domain": "ml"})
-	var ml []db.Entry
-	json.Unmarshal([]byte(text), &ml)
+	ml := pageEntries(t, text)
 	if len(ml) != 1 {
 		t.Errorf("ml: %d", len(ml))
 	}
@@ -400,8 +418,7 @@ func TestSearchEntries(t *testing.T) {
 	createEntry(t, ts.URL, "s3", "Python Error Handling", "Python uses try/except for error handling and recovery.", "skill", "python", "", "", []string{"python", "errors"})
 
 	_, text, _ := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "error"})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) < 2 {
 		t.Errorf("expected >=2 results for 'error', got %d", len(results))
 	}
@@ -412,13 +429,13 @@ func TestSearchEntries(t *testing.T) {
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "error", "language": "go"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "s1" {
 		t.Errorf("expected 1 Go result, got %d", len(results))
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "ownership borrowing"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "s2" {
 		t.Errorf("expected s2 for 'ownership', got %v", results)
 	}
@@ -431,8 +448,7 @@ func TestGetEntriesByContext(t *testing.T) {
 	createEntry(t, ts.URL, "ctx3", "Rust CLI", "CLI in Rust", "", "rust", "cli", "", []string{"cli"})
 
 	_, text, _ := toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"language": "go", "domain": "backend"})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 2 {
 		t.Errorf("expected 2 go/backend, got %d", len(results))
 	}
@@ -443,7 +459,7 @@ func TestGetEntriesByContext(t *testing.T) {
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"tags": []string{"http"}})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "ctx1" {
 		t.Errorf("expected ctx1 for tag 'http', got %v", results)
 	}
@@ -471,8 +487,7 @@ func TestFTS5Sync(t *testing.T) {
 	createEntry(t, ts.URL, "fts", "Animal Guide", "The monotreme is a unique mammal.", "", "", "", "", nil)
 
 	_, text, _ := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "monotreme"})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 1 {
 		t.Errorf("after create: expected 1, got %d", len(results))
 	}
@@ -480,19 +495,19 @@ func TestFTS5Sync(t *testing.T) {
 	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "fts", "content": "The echidna is a spiny anteater."})
 
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "monotreme"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 0 {
 		t.Errorf("after update: expected 0 for old word, got %d", len(results))
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "echidna"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 {
 		t.Errorf("after update: expected 1 for new word, got %d", len(results))
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "animal guide"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 {
 		t.Errorf("title search: expected 1, got %d", len(results))
 	}
@@ -500,7 +515,7 @@ func TestFTS5Sync(t *testing.T) {
 	toolCall(t, ts.URL, "delete_entry", map[string]any{"slug": "fts"})
 
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "echidna"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 0 {
 		t.Errorf("after delete: expected 0, got %d", len(results))
 	}
@@ -514,6 +529,9 @@ func TestStats(t *testing.T) {
 		toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "st"})
 	}
 
+	if err := s.DB.FlushStats(context.Background()); err != nil {
+		t.Fatalf("flush stats: %v", err)
+	}
 	stats, err := s.DB.GetStats(context.Background(), "st")
 	if err != nil {
 		t.Fatalf("get stats: %v", err)
@@ -526,6 +544,7 @@ func TestStats(t *testing.T) {
 	}
 
 	toolCall(t, ts.URL, "search_entries", map[string]any{"query": "unique stats content"})
+	s.DB.FlushStats(context.Background())
 	stats, _ = s.DB.GetStats(context.Background(), "st")
 	if stats.Searches < 1 {
 		t.Errorf("searches: got %d, want >= 1", stats.Searches)
@@ -538,6 +557,60 @@ func TestStats(t *testing.T) {
 	}
 }
 
+func TestStatsBuffered(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	d, err := db.OpenWithOptions(path, db.Options{StatsFlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := d.CreateEntry(ctx, &db.Entry{Slug: "buf", Title: "Buffered", Content: "buffered stats"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	d.GetEntry(ctx, "buf")
+	d.GetEntriesByContext(ctx, db.Filter{}, db.Page{})
+	d.SearchEntries(ctx, "buffered", db.Filter{}, db.Page{})
+
+	// Counts are buffered until a flush
+	stats, _ := d.GetStats(ctx, "buf")
+	if stats.Reads != 0 || stats.Searches != 0 {
+		t.Errorf("before flush: %+v", stats)
+	}
+	if err := d.FlushStats(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	stats, _ = d.GetStats(ctx, "buf")
+	if stats.Reads != 2 || stats.Searches != 1 || stats.LastReadAt == nil || stats.LastSearchAt == nil {
+		t.Errorf("after flush: %+v", stats)
+	}
+
+	// Close writes what is still buffered
+	d.GetEntry(ctx, "buf")
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	d, err = db.OpenWithOptions(path, db.Options{StatsFlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer d.Close()
+	stats, _ = d.GetStats(ctx, "buf")
+	if stats.Reads != 3 {
+		t.Errorf("after close: reads %d, want 3", stats.Reads)
+	}
+
+	// And the interval flushes in the background
+	d.GetEntry(ctx, "buf")
+	deadline := time.Now().Add(5 * time.Second)
+	for stats.Reads != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		stats, _ = d.GetStats(ctx, "buf")
+	}
+	if stats.Reads != 4 {
+		t.Errorf("after interval: reads %d, want 4", stats.Reads)
+	}
+}
+
 func TestWriteWhenLocked(t *testing.T) {
 	s, ts := setup(t)
 	createEntry(t, ts.URL, "exists", "Exists", "content", "", "", "", "", nil)
@@ -751,8 +824,8 @@ func TestResourcesTemplatesList(t *testing.T) {
 		t.Fatalf("error: %+v", resp.Error)
 	}
 	templates := resp.Result.(map[string]any)["resourceTemplates"].([]any)
-	if len(templates) != 2 {
-		t.Errorf("expected 2 templates, got %d", len(templates))
+	if len(templates) != 4 {
+		t.Errorf("expected 4 templates, got %d", len(templates))
 	}
 	if templates[0].(map[string]any)["uriTemplate"] != "mcpedia://how-to-use" {
 		t.Errorf("first template should be how-to-use; got %v", templates[0].(map[string]any)["uriTemplate"])
@@ -760,6 +833,12 @@ func TestResourcesTemplatesList(t *testing.T) {
 	if templates[1].(map[string]any)["uriTemplate"] != "mcpedia://entries/{slug}" {
 		t.Errorf("second template should be entries; got %v", templates[1].(map[string]any)["uriTemplate"])
 	}
+	if templates[2].(map[string]any)["uriTemplate"] != "mcpedia://entries/{slug}#{heading}" {
+		t.Errorf("third template should be entry sections; got %v", templates[2].(map[string]any)["uriTemplate"])
+	}
+	if templates[3].(map[string]any)["uriTemplate"] != "mcpedia://entries/{slug}/attachments/{name}" {
+		t.Errorf("fourth template should be attachments; got %v", templates[3].(map[string]any)["uriTemplate"])
+	}
 }
 
 func TestPromptsList(t *testing.T) {
@@ -953,8 +1032,7 @@ func TestSearchWithLimit(t *testing.T) {
 	}
 
 	_, text, _ := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "searchable", "limit": 2})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 2 {
 		t.Errorf("expected 2 with limit, got %d", len(results))
 	}
@@ -968,8 +1046,7 @@ func TestGetEntriesByContextWithLimit(t *testing.T) {
 	}
 
 	_, text, _ := toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"language": "go", "limit": 3})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 3 {
 		t.Errorf("expected 3 with limit, got %d", len(results))
 	}
@@ -1003,6 +1080,62 @@ func TestResourcesPagination(t *testing.T) {
 	if _, has := result["nextCursor"]; has {
 		t.Error("should not have nextCursor on last page")
 	}
+
+	_, resp = call(t, ts.URL, "resources/list", 3, map[string]any{"cursor": "bogus"}, nil)
+	if resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("invalid cursor: expected -32602, got %+v", resp.Error)
+	}
+}
+
+func TestResourcesPaginationStableCursor(t *testing.T) {
+	_, ts := setup(t)
+	for i := 0; i < 60; i++ {
+		createEntry(t, ts.URL, fmt.Sprintf("st-%03d", i), "Stable", "content", "", "", "", "", nil)
+	}
+	// A user's how-to-use sorts in the middle but is still listed once, first
+	toolCall(t, ts.URL, "create_entry", map[string]any{"slug": "how-to-use", "title": "Custom", "content": "Custom guide."})
+
+	seen := map[string]int{}
+	list := func(cursor string) string {
+		t.Helper()
+		var params any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		_, resp := call(t, ts.URL, "resources/list", 1, params, nil)
+		if resp.Error != nil {
+			t.Fatalf("resources/list: %+v", resp.Error)
+		}
+		result := resp.Result.(map[string]any)
+		for _, r := range result["resources"].([]any) {
+			seen[r.(map[string]any)["name"].(string)]++
+		}
+		next, _ := result["nextCursor"].(string)
+		return next
+	}
+
+	next := list("")
+	if next == "" {
+		t.Fatal("expected a second page")
+	}
+	// Entries created or deleted before the cursor do not shift the next page
+	createEntry(t, ts.URL, "aaa-late", "Late", "content", "", "", "", "", nil)
+	toolCall(t, ts.URL, "delete_entry", map[string]any{"slug": "st-000"})
+	if next = list(next); next != "" {
+		t.Errorf("expected last page, got cursor %q", next)
+	}
+
+	if len(seen) != 61 {
+		t.Errorf("expected 61 distinct resources, got %d", len(seen))
+	}
+	for name, n := range seen {
+		if n != 1 {
+			t.Errorf("%s listed %d times", name, n)
+		}
+	}
+	if seen["aaa-late"] != 0 {
+		t.Error("entry created before the cursor should not appear on later pages")
+	}
 }
 
 func TestAllEntries(t *testing.T) {
@@ -1044,6 +1177,22 @@ func exportFormat(e *db.Entry) string {
 	if e.Description != "" {
 		sb.WriteString(fmt.Sprintf("description: %q\n", e.Description))
 	}
+	if e.ReviewAfter != "" {
+		sb.WriteString(fmt.Sprintf("review_after: %s\n", e.ReviewAfter))
+	}
+	if e.ExpiresAt != "" {
+		sb.WriteString(fmt.Sprintf("expires_at: %s\n", e.ExpiresAt))
+	}
+	if e.Status != "" && e.Status != db.StatusApproved {
+		sb.WriteString(fmt.Sprintf("status: %s\n", e.Status))
+	}
+	if len(e.Attachments) > 0 {
+		items := make([]string, len(e.Attachments))
+		for i, a := range e.Attachments {
+			items[i] = a.Name + ":" + a.MIMEType
+		}
+		sb.WriteString(fmt.Sprintf("attachments: [%s]\n", strings.Join(items, ", ")))
+	}
 	sb.WriteString("---\n\n")
 	sb.WriteString(e.Content)
 	sb.WriteString("\n")
@@ -1065,9 +1214,12 @@ func TestImportExportRoundTrip(t *testing.T) {
 		t.Fatalf("write export file: %v", err)
 	}
 
-	if err := s.DB.DeleteEntry(context.Background(), "imp1"); err != nil {
+	if err := s.DB.DeleteEntry(context.Background(), "imp1", 0); err != nil {
 		t.Fatalf("delete: %v", err)
 	}
+	if err := s.DB.PurgeEntry(context.Background(), "imp1"); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
 
 	content, err := os.ReadFile(filename)
 	if err != nil {
@@ -1121,29 +1273,28 @@ func TestSearchWithFilters(t *testing.T) {
 
 	// By tag
 	_, text, _ := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "searchable content", "tag": "tagged"})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "stf1" {
 		t.Errorf("tag filter: expected stf1, got %v", results)
 	}
 
 	// By domain
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "searchable domain", "domain": "backend"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "df1" {
 		t.Errorf("domain filter: expected df1, got %v", results)
 	}
 
 	// By kind
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "searchable kind", "kind": "rule"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "kf1" {
 		t.Errorf("kind filter: expected kf1, got %v", results)
 	}
 
 	// By project
 	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "findable", "project": "proj-a"})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "sp1" {
 		t.Errorf("project filter: expected sp1, got %v", results)
 	}
@@ -1158,14 +1309,13 @@ func TestGetEntriesByContextVariations(t *testing.T) {
 	createEntry(t, ts.URL, "ct2", "CT Two", "c2", "", "", "", "", []string{"other"})
 
 	_, text, _ := toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"kind": "rule", "project": "proj-x"})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "ckp1" {
 		t.Errorf("kind+project: expected ckp1, got %v", results)
 	}
 
 	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"tags": []string{"special"}})
-	json.Unmarshal([]byte(text), &results)
+	results = pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "ct1" {
 		t.Errorf("tags: expected ct1, got %v", results)
 	}
@@ -1177,8 +1327,7 @@ func TestListEntriesWithProjectFilter(t *testing.T) {
 	createEntry(t, ts.URL, "lp2", "LP Two", "c", "", "", "", "beta", nil)
 
 	_, text, _ := toolCall(t, ts.URL, "list_entries", map[string]any{"project": "alpha"})
-	var results []db.Entry
-	json.Unmarshal([]byte(text), &results)
+	results := pageEntries(t, text)
 	if len(results) != 1 || results[0].Slug != "lp1" {
 		t.Errorf("expected lp1, got %v", results)
 	}
@@ -1253,3 +1402,2341 @@ func TestReopenDB(t *testing.T) {
 		t.Errorf("title: %q", got.Title)
 	}
 }
+
+func TestEntryHistory(t *testing.T) {
+	_, ts := setup(t)
+	createEntry(t, ts.URL, "hist", "First Title", "first content", "rule", "go", "", "", []string{"a"})
+	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "hist", "content": "second content", "tags": []string{"b"}})
+	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "hist", "title": "Third Title"})
+
+	_, text, isErr := toolCall(t, ts.URL, "get_entry_history", map[string]any{"slug": "hist"})
+	if isErr {
+		t.Fatalf("history error: %s", text)
+	}
+	var revisions []db.Revision
+	json.Unmarshal([]byte(text), &revisions)
+	if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Version != 2 || revisions[1].Version != 1 {
+		t.Errorf("expected newest first, got versions %d, %d", revisions[0].Version, revisions[1].Version)
+	}
+	if revisions[0].Content != "" {
+		t.Error("history list should not include content")
+	}
+
+	_, text, isErr = toolCall(t, ts.URL, "get_entry_history", map[string]any{"slug": "hist", "version": 1})
+	if isErr {
+		t.Fatalf("get revision error: %s", text)
+	}
+	var rev db.Revision
+	json.Unmarshal([]byte(text), &rev)
+	if rev.Title != "First Title" || rev.Content != "first content" || rev.Kind != "rule" {
+		t.Errorf("revision 1: %+v", rev)
+	}
+	if len(rev.Tags) != 1 || rev.Tags[0] != "a" {
+		t.Errorf("revision 1 tags: %v", rev.Tags)
+	}
+
+	_, _, isErr = toolCall(t, ts.URL, "get_entry_history", map[string]any{"slug": "hist", "version": 9})
+	if !isErr {
+		t.Error("expected error for unknown revision")
+	}
+	_, _, isErr = toolCall(t, ts.URL, "get_entry_history", map[string]any{"slug": "nope"})
+	if !isErr {
+		t.Error("expected error for unknown entry")
+	}
+}
+
+func TestRestoreEntry(t *testing.T) {
+	s, ts := setup(t)
+	createEntry(t, ts.URL, "rst", "Careful Rule", "carefully written", "rule", "", "", "", []string{"keep"})
+	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "rst", "title": "Clobbered", "content": "oops", "tags": []string{}})
+
+	_, text, isErr := toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "rst", "version": 1})
+	if isErr {
+		t.Fatalf("restore error: %s", text)
+	}
+	var got db.Entry
+	json.Unmarshal([]byte(text), &got)
+	if got.Title != "Careful Rule" || got.Content != "carefully written" {
+		t.Errorf("restored entry: title=%q content=%q", got.Title, got.Content)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != "keep" {
+		t.Errorf("restored tags: %v", got.Tags)
+	}
+	if got.Version != 3 {
+		t.Errorf("restore should bump version: got %d", got.Version)
+	}
+
+	// The clobbered version is kept too
+	rev, err := s.DB.GetRevision(context.Background(), "rst", 2)
+	if err != nil {
+		t.Fatalf("get revision 2: %v", err)
+	}
+	if rev.Content != "oops" {
+		t.Errorf("revision 2 content: %q", rev.Content)
+	}
+
+	_, _, isErr = toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "rst"})
+	if !isErr {
+		t.Error("expected error for missing version")
+	}
+
+	if err := s.DB.Lock(context.Background(), "tok"); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	_, _, isErr = toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "rst", "version": 2})
+	if !isErr {
+		t.Error("expected error for restore when locked")
+	}
+}
+
+// Restoring a version brings back its review and expiry dates with the rest
+// of the entry.
+func TestRestoreReviewDates(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	_, text, isErr := toolCall(t, ts.URL, "create_entry", map[string]any{
+		"slug": "dated", "title": "Dated", "content": "grpc-go v1 notes",
+		"review_after": "2030-01-01", "expires_at": "2031-01-01",
+	})
+	if isErr {
+		t.Fatalf("create: %s", text)
+	}
+	if err := s.DB.UpdateEntry(ctx, "dated", 0, map[string]any{"review_after": "", "expires_at": "2020-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, text, isErr = toolCall(t, ts.URL, "get_entry_history", map[string]any{"slug": "dated"})
+	if isErr {
+		t.Fatalf("history: %s", text)
+	}
+	var revisions []db.Revision
+	json.Unmarshal([]byte(text), &revisions)
+	if len(revisions) != 1 || revisions[0].ReviewAfter != "2030-01-01" || revisions[0].ExpiresAt != "2031-01-01" {
+		t.Errorf("history: %+v", revisions)
+	}
+
+	_, text, isErr = toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "dated", "version": 1})
+	if isErr {
+		t.Fatalf("restore: %s", text)
+	}
+	var got db.Entry
+	json.Unmarshal([]byte(text), &got)
+	if got.ReviewAfter != "2030-01-01" || got.ExpiresAt != "2031-01-01" || got.Stale != "" {
+		t.Errorf("restored entry: review_after=%q expires_at=%q stale=%q", got.ReviewAfter, got.ExpiresAt, got.Stale)
+	}
+	rev, err := s.DB.GetRevision(ctx, "dated", 2)
+	if err != nil {
+		t.Fatalf("get revision 2: %v", err)
+	}
+	if rev.ReviewAfter != "" || rev.ExpiresAt != "2020-01-01" {
+		t.Errorf("revision 2: review_after=%q expires_at=%q", rev.ReviewAfter, rev.ExpiresAt)
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	s, ts := setup(t)
+	createEntry(t, ts.URL, "soft", "Soft Delete", "recoverable platypus content", "rule", "go", "", "", []string{"trash-tag"})
+	createEntry(t, ts.URL, "keep", "Keep Me", "other content", "rule", "go", "", "", nil)
+
+	_, _, isErr := toolCall(t, ts.URL, "delete_entry", map[string]any{"slug": "soft"})
+	if isErr {
+		t.Fatal("delete failed")
+	}
+
+	// Hidden from every read path
+	_, _, isErr = toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "soft"})
+	if !isErr {
+		t.Error("get_entry should not return trashed entry")
+	}
+	_, text, _ := toolCall(t, ts.URL, "list_entries", map[string]any{})
+	results := pageEntries(t, text)
+	if len(results) != 1 || results[0].Slug != "keep" {
+		t.Errorf("list_entries: expected only keep, got %v", results)
+	}
+	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "platypus"})
+	results = pageEntries(t, text)
+	if len(results) != 0 {
+		t.Errorf("search_entries: expected 0, got %d", len(results))
+	}
+	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"language": "go"})
+	results = pageEntries(t, text)
+	if len(results) != 1 {
+		t.Errorf("get_entries_by_context: expected 1, got %d", len(results))
+	}
+	_, resp := call(t, ts.URL, "resources/list", 1, nil, nil)
+	for _, r := range resp.Result.(map[string]any)["resources"].([]any) {
+		if r.(map[string]any)["name"] == "soft" {
+			t.Error("resources/list should not include trashed entry")
+		}
+	}
+	_, text, _ = toolCall(t, ts.URL, "list_tags", map[string]any{})
+	if strings.Contains(text, "trash-tag") {
+		t.Errorf("list_tags should not count trashed entries: %s", text)
+	}
+
+	trash, err := s.DB.ListTrash(context.Background())
+	if err != nil {
+		t.Fatalf("list trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Slug != "soft" || trash[0].DeletedAt == "" {
+		t.Fatalf("trash: %+v", trash)
+	}
+
+	// Undelete via restore_entry without a version
+	_, text, isErr = toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "soft"})
+	if isErr {
+		t.Fatalf("restore from trash: %s", text)
+	}
+	var got db.Entry
+	json.Unmarshal([]byte(text), &got)
+	if got.Content != "recoverable platypus content" || len(got.Tags) != 1 {
+		t.Errorf("restored entry: %+v", got)
+	}
+	_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "platypus"})
+	results = pageEntries(t, text)
+	if len(results) != 1 {
+		t.Errorf("search after restore: expected 1, got %d", len(results))
+	}
+
+	_, _, isErr = toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "soft"})
+	if !isErr {
+		t.Error("expected error restoring an entry that is not in the trash")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "p1", "Purge One", "content", "", "", "", "", nil)
+	createEntry(t, ts.URL, "p2", "Purge Two", "content", "", "", "", "", nil)
+	s.DB.DeleteEntry(ctx, "p1", 0)
+	s.DB.DeleteEntry(ctx, "p2", 0)
+
+	// Nothing is older than the retention period yet
+	n, err := s.DB.PurgeTrash(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("purge trash: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected 0 purged, got %d", n)
+	}
+
+	if err := s.DB.PurgeEntry(ctx, "p1"); err != nil {
+		t.Fatalf("purge entry: %v", err)
+	}
+	if err := s.DB.RestoreEntry(ctx, "p1"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("restore after purge: expected ErrNotFound, got %v", err)
+	}
+
+	n, err = s.DB.PurgeTrash(ctx, 0)
+	if err != nil {
+		t.Fatalf("purge trash: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 purged, got %d", n)
+	}
+	trash, _ := s.DB.ListTrash(ctx)
+	if len(trash) != 0 {
+		t.Errorf("trash should be empty, got %d", len(trash))
+	}
+
+	// Creating an entry whose slug is in the trash fails and keeps the trashed one
+	createEntry(t, ts.URL, "p3", "Old", "old content", "", "", "", "", nil)
+	s.DB.UpdateEntry(ctx, "p3", 0, map[string]any{"content": "older content"})
+	s.DB.DeleteEntry(ctx, "p3", 0)
+	_, text, isErr := toolCall(t, ts.URL, "create_entry", map[string]any{"slug": "p3", "title": "New", "content": "new content"})
+	if !isErr || !strings.Contains(text, "in the trash") {
+		t.Errorf("create over trashed slug: %s", text)
+	}
+	if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: "p3", Title: "New", Content: "new"}); !errors.Is(err, db.ErrInTrash) {
+		t.Errorf("expected ErrInTrash, got %v", err)
+	}
+	if err := s.DB.RestoreEntry(ctx, "p3"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	got, err := s.DB.GetEntry(ctx, "p3")
+	if err != nil || got.Title != "Old" || got.Content != "older content" {
+		t.Errorf("restored entry: %+v, %v", got, err)
+	}
+	revs, err := s.DB.ListRevisions(ctx, "p3")
+	if err != nil || len(revs) == 0 {
+		t.Errorf("revisions of restored entry: %+v, %v", revs, err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Fresh database is created at the latest version
+	fresh, err := db.Open(filepath.Join(dir, "fresh.db"))
+	if err != nil {
+		t.Fatalf("open fresh: %v", err)
+	}
+	v, err := fresh.SchemaVersion(ctx)
+	fresh.Close()
+	if err != nil || v != db.LatestVersion() {
+		t.Errorf("fresh schema version: %d, %v (want %d)", v, err, db.LatestVersion())
+	}
+
+	// A database created before migrations (user_version 0, original schema) is upgraded in place
+	legacyPath := filepath.Join(dir, "legacy.db")
+	raw, err := sql.Open("sqlite", legacyPath)
+	if err != nil {
+		t.Fatalf("open raw: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, slug TEXT UNIQUE NOT NULL, title TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '', content TEXT NOT NULL CHECK(length(content) <= 32768),
+			kind TEXT NOT NULL DEFAULT 'skill', language TEXT NOT NULL DEFAULT '', domain TEXT NOT NULL DEFAULT '',
+			project TEXT NOT NULL DEFAULT '', version INTEGER NOT NULL DEFAULT 1,
+			created_at TEXT NOT NULL DEFAULT (datetime('now')), updated_at TEXT NOT NULL DEFAULT (datetime('now')))`,
+		`CREATE TABLE entry_stats (entry_id INTEGER PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+			reads INTEGER NOT NULL DEFAULT 0, searches INTEGER NOT NULL DEFAULT 0, updates INTEGER NOT NULL DEFAULT 0,
+			last_read_at TEXT, last_search_at TEXT, last_update_at TEXT)`,
+		`CREATE VIRTUAL TABLE entries_fts USING fts5(title, description, content)`,
+		`INSERT INTO entries (slug, title, content) VALUES ('old', 'Old Entry', 'legacy wombat content')`,
+		`INSERT INTO entry_stats (entry_id) VALUES (1)`,
+		`INSERT INTO entries_fts (rowid, title, description, content) VALUES (1, 'Old Entry', '', 'legacy wombat content')`,
+	} {
+		if _, err := raw.Exec(stmt); err != nil {
+			t.Fatalf("legacy schema: %v", err)
+		}
+	}
+	raw.Close()
+
+	legacy, err := db.Open(legacyPath)
+	if err != nil {
+		t.Fatalf("open legacy: %v", err)
+	}
+	if v, _ := legacy.SchemaVersion(ctx); v != db.LatestVersion() {
+		t.Errorf("legacy schema version after open: %d", v)
+	}
+	got, err := legacy.GetEntry(ctx, "old")
+	if err != nil || got.Content != "legacy wombat content" {
+		t.Fatalf("legacy entry: %+v, %v", got, err)
+	}
+	page, err := legacy.SearchEntries(ctx, "wombat", db.Filter{}, db.Page{})
+	if err != nil || page.Total != 1 {
+		t.Errorf("legacy search: %v, %v", page, err)
+	}
+	if err := legacy.UpdateEntry(ctx, "old", 0, map[string]any{"title": "Upgraded"}); err != nil {
+		t.Errorf("update after upgrade: %v", err)
+	}
+	if err := legacy.DeleteEntry(ctx, "old", 0); err != nil {
+		t.Errorf("delete after upgrade: %v", err)
+	}
+	legacy.Close()
+
+	// A version 0 database whose schema is not the original one is refused
+	// rather than guessed at
+	for name, stmt := range map[string]string{
+		"extra column": `CREATE TABLE entries (id INTEGER PRIMARY KEY, slug TEXT, title TEXT, description TEXT,
+			content TEXT, kind TEXT, language TEXT, domain TEXT, project TEXT, version INTEGER,
+			created_at TEXT, updated_at TEXT, deleted_at TEXT)`,
+		"extra table": `CREATE TABLE entry_revisions (id INTEGER PRIMARY KEY)`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".db")
+		raw, _ := sql.Open("sqlite", path)
+		if _, err := raw.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		raw.Close()
+		if _, err := db.Open(path); err == nil || !strings.Contains(err.Error(), "unrecognized schema") {
+			t.Errorf("%s: expected an unrecognized schema error, got %v", name, err)
+		}
+	}
+
+	// A database from a newer binary is refused
+	raw, _ = sql.Open("sqlite", legacyPath)
+	raw.Exec(fmt.Sprintf("PRAGMA user_version = %d", db.LatestVersion()+1))
+	raw.Close()
+	if _, err := db.Open(legacyPath); !errors.Is(err, db.ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestMigrateStepByStep(t *testing.T) {
+	ctx := context.Background()
+	d, err := db.OpenNoMigrate(filepath.Join(t.TempDir(), "steps.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+
+	if v, _ := d.SchemaVersion(ctx); v != 0 {
+		t.Fatalf("initial version: %d", v)
+	}
+	if err := d.Migrate(ctx, 1); err != nil {
+		t.Fatalf("migrate to 1: %v", err)
+	}
+	if v, _ := d.SchemaVersion(ctx); v != 1 {
+		t.Errorf("version after step: %d", v)
+	}
+	if err := d.Migrate(ctx, db.LatestVersion()); err != nil {
+		t.Fatalf("migrate to latest: %v", err)
+	}
+	if err := d.Migrate(ctx, 1); err == nil {
+		t.Error("expected error migrating down")
+	}
+	if err := d.Migrate(ctx, db.LatestVersion()+1); err == nil {
+		t.Error("expected error for unknown version")
+	}
+}
+
+func TestEntryLinks(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "l-new", "New Way", "content", "", "", "", "", nil)
+	createEntry(t, ts.URL, "l-old", "Old Way", "content", "", "", "", "", nil)
+	createEntry(t, ts.URL, "l-base", "Base", "content", "", "", "", "", nil)
+	createEntry(t, ts.URL, "l-far", "Far", "content", "", "", "", "", nil)
+
+	for _, l := range []db.Link{
+		{From: "l-new", To: "l-old", Type: db.LinkSupersedes},
+		{From: "l-new", To: "l-base", Type: db.LinkDependsOn},
+		{From: "l-base", To: "l-far", Type: db.LinkRelated},
+	} {
+		if err := s.DB.AddLink(ctx, l.From, l.To, l.Type); err != nil {
+			t.Fatalf("add link %+v: %v", l, err)
+		}
+	}
+	// Adding the same link twice is a no-op
+	if err := s.DB.AddLink(ctx, "l-new", "l-old", db.LinkSupersedes); err != nil {
+		t.Errorf("duplicate link: %v", err)
+	}
+	if err := s.DB.AddLink(ctx, "l-new", "l-old", "blocks"); err == nil {
+		t.Error("expected error for invalid link type")
+	}
+	if err := s.DB.AddLink(ctx, "l-new", "l-new", db.LinkRelated); err == nil {
+		t.Error("expected error for self link")
+	}
+	if err := s.DB.AddLink(ctx, "l-new", "missing", db.LinkRelated); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("link to missing entry: expected ErrNotFound, got %v", err)
+	}
+
+	links, err := s.DB.ListLinks(ctx, "l-base")
+	if err != nil || len(links) != 2 {
+		t.Fatalf("list links: %+v, %v", links, err)
+	}
+
+	_, text, isErr := toolCall(t, ts.URL, "get_related_entries", map[string]any{"slug": "l-new"})
+	if isErr {
+		t.Fatalf("get_related_entries: %s", text)
+	}
+	var related []db.RelatedEntry
+	json.Unmarshal([]byte(text), &related)
+	if len(related) != 2 || related[0].Slug != "l-base" || related[1].Slug != "l-old" {
+		t.Fatalf("depth 1: %+v", related)
+	}
+	if related[1].Via.Type != db.LinkSupersedes || related[1].Content != "" {
+		t.Errorf("unexpected related entry: %+v", related[1])
+	}
+
+	_, text, _ = toolCall(t, ts.URL, "get_related_entries", map[string]any{"slug": "l-new", "depth": 2})
+	related = nil
+	json.Unmarshal([]byte(text), &related)
+	if len(related) != 3 || related[2].Slug != "l-far" || related[2].Depth != 2 {
+		t.Fatalf("depth 2: %+v", related)
+	}
+
+	// Links are followed in both directions; types narrows them
+	_, text, _ = toolCall(t, ts.URL, "get_related_entries", map[string]any{"slug": "l-far", "depth": 3, "types": []string{"related", "depends-on"}})
+	related = nil
+	json.Unmarshal([]byte(text), &related)
+	if len(related) != 2 || related[0].Slug != "l-base" || related[1].Slug != "l-new" {
+		t.Fatalf("reverse walk: %+v", related)
+	}
+
+	// Trashed entries drop out of the graph; purging removes their links
+	s.DB.DeleteEntry(ctx, "l-base", 0)
+	_, text, _ = toolCall(t, ts.URL, "get_related_entries", map[string]any{"slug": "l-new", "depth": 2})
+	related = nil
+	json.Unmarshal([]byte(text), &related)
+	if len(related) != 1 || related[0].Slug != "l-old" {
+		t.Fatalf("after delete: %+v", related)
+	}
+	s.DB.RestoreEntry(ctx, "l-base")
+	if links, _ := s.DB.ListLinks(ctx, "l-base"); len(links) != 2 {
+		t.Errorf("links after restore: %+v", links)
+	}
+	s.DB.DeleteEntry(ctx, "l-base", 0)
+	if err := s.DB.PurgeEntry(ctx, "l-base"); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	createEntry(t, ts.URL, "l-base", "Base Again", "content", "", "", "", "", nil)
+	if links, _ := s.DB.ListLinks(ctx, "l-base"); len(links) != 0 {
+		t.Errorf("links should be gone after purge: %+v", links)
+	}
+
+	if err := s.DB.RemoveLink(ctx, "l-new", "l-old", db.LinkSupersedes); err != nil {
+		t.Errorf("remove link: %v", err)
+	}
+	if err := s.DB.RemoveLink(ctx, "l-new", "l-old", db.LinkSupersedes); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("remove missing link: expected ErrNotFound, got %v", err)
+	}
+}
+
+// buildCLI builds the mcpedia command into a temporary directory and
+// returns the path of the binary.
+func buildCLI(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "mcpedia")
+	if out, err := exec.Command("go", "build", "-o", bin, "../cmd/mcpedia").CombinedOutput(); err != nil {
+		t.Fatalf("build mcpedia: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// A link to a missing entry fails `mcpedia add` before the entry is created.
+func TestAddWithMissingLinkTarget(t *testing.T) {
+	bin := buildCLI(t)
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+	file := filepath.Join(dir, "content.md")
+	if err := os.WriteFile(file, []byte("Prefer table-driven tests."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	add := func(slug, link string) (string, error) {
+		out, err := exec.Command(bin, "add", "--db", dbPath, "--slug", slug, "--title", slug, "--file", file, "--link", link).CombinedOutput()
+		return string(out), err
+	}
+
+	if out, err := add("go-testing", "related:missing-slug"); err == nil || !strings.Contains(out, "missing-slug") {
+		t.Errorf("add with a missing link target: %v\n%s", err, out)
+	}
+	d, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer d.Close()
+	if _, err := d.GetEntryMeta(context.Background(), "go-testing"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("entry was created: %v", err)
+	}
+
+	if out, err := add("go-errors", "related:go-errors"); err == nil || !strings.Contains(out, "itself") {
+		t.Errorf("add linking to itself: %v\n%s", err, out)
+	}
+	if _, err := d.GetEntryMeta(context.Background(), "go-errors"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("self-linked entry was created: %v", err)
+	}
+
+	// Once the target exists, the same add succeeds with its link
+	if err := d.CreateEntry(context.Background(), &db.Entry{Slug: "missing-slug", Title: "Now Here", Content: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := add("go-testing", "related:missing-slug"); err != nil {
+		t.Fatalf("add with an existing link target: %v\n%s", err, out)
+	}
+	if links, err := d.ListLinks(context.Background(), "go-testing"); err != nil || len(links) != 1 || links[0].To != "missing-slug" {
+		t.Errorf("links: %+v, %v", links, err)
+	}
+}
+
+func TestWikiLinks(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "w-target", "Target", "plain content", "", "", "", "", nil)
+	createEntry(t, ts.URL, "w-source", "Source",
+		"See [[w-target]] and [[w-missing|the missing one]], also mcpedia://entries/w-target.\n"+
+			"Self [[w-source]] is ignored, as is `[[w-code]]` and\n```\n[[w-fenced]]\n```\n",
+		"", "", "", "", nil)
+
+	_, text, isErr := toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "w-source"})
+	if isErr {
+		t.Fatalf("get_entry: %s", text)
+	}
+	var e db.Entry
+	json.Unmarshal([]byte(text), &e)
+	if strings.Join(e.Links, ",") != "w-missing,w-target" {
+		t.Errorf("links: %v", e.Links)
+	}
+
+	_, text, _ = toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "w-target"})
+	e = db.Entry{}
+	json.Unmarshal([]byte(text), &e)
+	if strings.Join(e.Backlinks, ",") != "w-source" {
+		t.Errorf("backlinks: %v", e.Backlinks)
+	}
+
+	dangling, err := s.DB.DanglingRefs(ctx)
+	if err != nil || len(dangling) != 1 || dangling[0] != (db.DanglingRef{Slug: "w-source", Target: "w-missing"}) {
+		t.Fatalf("dangling: %+v, %v", dangling, err)
+	}
+	// Creating the missing entry resolves the reference
+	createEntry(t, ts.URL, "w-missing", "Missing", "now here", "", "", "", "", nil)
+	if dangling, _ := s.DB.DanglingRefs(ctx); len(dangling) != 0 {
+		t.Errorf("dangling after create: %+v", dangling)
+	}
+	// Trashing a target makes references to it dangle again
+	s.DB.DeleteEntry(ctx, "w-target", 0)
+	if dangling, _ := s.DB.DanglingRefs(ctx); len(dangling) != 1 || dangling[0].Target != "w-target" {
+		t.Errorf("dangling after delete: %+v", dangling)
+	}
+	s.DB.RestoreEntry(ctx, "w-target")
+
+	// Updating content re-indexes references
+	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "w-source", "content": "only [[w-missing]] now"})
+	got, _ := s.DB.GetEntry(ctx, "w-target")
+	if len(got.Backlinks) != 0 {
+		t.Errorf("backlinks after update: %v", got.Backlinks)
+	}
+	// Updating other fields keeps them
+	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "w-source", "title": "Renamed"})
+	got, _ = s.DB.GetEntry(ctx, "w-missing")
+	if strings.Join(got.Backlinks, ",") != "w-source" {
+		t.Errorf("backlinks after title update: %v", got.Backlinks)
+	}
+}
+
+func TestMigrationBackfills(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "backfill.db")
+	d, err := db.OpenNoMigrate(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// Entries written before the refs index existed are indexed by the migration
+	if err := d.Migrate(ctx, 4); err != nil {
+		t.Fatalf("migrate to 4: %v", err)
+	}
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open raw: %v", err)
+	}
+	if _, err := raw.Exec(`INSERT INTO entries (slug, title, content) VALUES ('a', 'A', 'see [[b]]'), ('b', 'B', 'nothing')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	raw.Close()
+	if err := d.Migrate(ctx, db.LatestVersion()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	defer d.Close()
+	got, err := d.GetEntry(ctx, "b")
+	if err != nil || strings.Join(got.Backlinks, ",") != "a" {
+		t.Errorf("backfilled backlinks: %+v, %v", got, err)
+	}
+	found, err := d.SemanticSearch(ctx, "nothing", db.Filter{}, db.Page{})
+	if err != nil || len(found.Entries) != 1 || found.Entries[0].Slug != "b" {
+		t.Errorf("backfilled vectors: %+v, %v", found, err)
+	}
+}
+
+func TestMigrationHooksUseTheirSchema(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "v5.db")
+	d, err := db.OpenNoMigrate(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer d.Close()
+	// An entry with empty content must not send the vectors backfill (migration 6)
+	// looking for entry_sections, which only migration 7 creates
+	if err := d.Migrate(ctx, 5); err != nil {
+		t.Fatalf("migrate to 5: %v", err)
+	}
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open raw: %v", err)
+	}
+	if _, err := raw.Exec(`INSERT INTO entries (slug, title, content) VALUES ('empty', 'Empty Wombat', '')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	raw.Close()
+	if err := d.Migrate(ctx, db.LatestVersion()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	got, err := d.GetEntry(ctx, "empty")
+	if err != nil || got.Content != "" {
+		t.Errorf("entry after migration: %+v, %v", got, err)
+	}
+	found, err := d.SemanticSearch(ctx, "wombat", db.Filter{}, db.Page{})
+	if err != nil || len(found.Entries) != 1 {
+		t.Errorf("backfilled vector: %+v, %v", found, err)
+	}
+}
+
+func TestSemanticSearch(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "rust-error-handling", "Rust Error Handling",
+		"# Rust Error Handling\n\nUse Result<T, E> for recoverable errors.\nReserve panic! for bugs.", "skill", "rust", "", "", []string{"rust", "errors"})
+	createEntry(t, ts.URL, "go-testing", "Go Testing Patterns",
+		"Use table-driven tests with t.Run.", "pattern", "go", "", "", []string{"go", "testing"})
+	createEntry(t, ts.URL, "python-logging", "Python Logging",
+		"Configure the root logger once at startup.", "guide", "python", "", "", nil)
+
+	search := func(args map[string]any) []db.Entry {
+		t.Helper()
+		_, text, isErr := toolCall(t, ts.URL, "search_entries", args)
+		if isErr {
+			t.Fatalf("search_entries %v: %s", args, text)
+		}
+		return pageEntries(t, text)
+	}
+
+	// Keyword search needs the exact terms
+	if got := search(map[string]any{"query": "handle failures gracefully"}); len(got) != 0 {
+		t.Errorf("keyword: expected no results, got %d", len(got))
+	}
+	got := search(map[string]any{"query": "handle failures gracefully", "mode": "semantic"})
+	if len(got) != 1 || got[0].Slug != "rust-error-handling" {
+		t.Fatalf("semantic: %+v", got)
+	}
+	if got[0].Score <= 0 || got[0].Content != "" || got[0].Snippet != "Use Result<T, E> for recoverable errors." {
+		t.Errorf("semantic result: %+v", got[0])
+	}
+	if got := search(map[string]any{"query": "handle failures gracefully", "mode": "semantic", "language": "go"}); len(got) != 0 {
+		t.Errorf("semantic with filter: %+v", got)
+	}
+	if got := search(map[string]any{"query": "the of and", "mode": "semantic"}); len(got) != 0 {
+		t.Errorf("stopword query: %+v", got)
+	}
+
+	// Hybrid keeps keyword hits and adds semantic ones
+	got = search(map[string]any{"query": "logger", "mode": "hybrid"})
+	if len(got) != 1 || got[0].Slug != "python-logging" {
+		t.Errorf("hybrid: %+v", got)
+	}
+	got = search(map[string]any{"query": "what's the way to log?", "mode": "hybrid"})
+	if len(got) != 1 || got[0].Slug != "python-logging" || got[0].Content != "" || got[0].Snippet != "Configure the root logger once at startup." {
+		t.Errorf("hybrid fallback: %+v", got)
+	}
+
+	// Vectors follow updates
+	toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-testing", "content": "Tests should check how code recovers from failures."})
+	got = search(map[string]any{"query": "handle failures gracefully", "mode": "semantic"})
+	if len(got) != 2 {
+		t.Errorf("semantic after update: %+v", got)
+	}
+
+	if _, text, isErr := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "x", "mode": "fuzzy"}); !isErr {
+		t.Errorf("expected error for invalid mode, got %s", text)
+	}
+
+	s.DB.FlushStats(ctx)
+	stats, _ := s.DB.GetStats(ctx, "rust-error-handling")
+	if stats.Searches != 2 {
+		t.Errorf("searches: expected 2, got %d", stats.Searches)
+	}
+}
+
+func TestSearchQuerySyntax(t *testing.T) {
+	_, ts := setup(t)
+	createEntry(t, ts.URL, "rust-errors", "Rust Error Handling", "Use Result for recoverable errors. Avoid unwrap in libraries.", "skill", "rust", "", "", []string{"rust", "errors"})
+	createEntry(t, ts.URL, "rust-unsafe", "Unsafe Rust", "Document every unsafe block and the errors it can cause.", "rule", "rust", "", "", []string{"rust"})
+	createEntry(t, ts.URL, "go-errors", "Go Errors", "Wrap errors with fmt.Errorf and %w; handle them once.", "skill", "go", "", "", []string{"go", "errors"})
+
+	search := func(query string) []string {
+		t.Helper()
+		_, text, isErr := toolCall(t, ts.URL, "search_entries", map[string]any{"query": query})
+		if isErr {
+			t.Fatalf("search %q: %s", query, text)
+		}
+		entries := pageEntries(t, text)
+		var slugs []string
+		for _, e := range entries {
+			slugs = append(slugs, e.Slug)
+		}
+		sort.Strings(slugs)
+		return slugs
+	}
+
+	for query, want := range map[string]string{
+		"errors":                       "go-errors,rust-errors,rust-unsafe",
+		"title:error":                  "rust-errors",
+		`"recoverable errors"`:         "rust-errors",
+		"recover*":                     "rust-errors",
+		"unwrap OR fmt.Errorf":         "go-errors,rust-errors",
+		"errors -unsafe":               "go-errors,rust-errors",
+		"errors lang:rust":             "rust-errors,rust-unsafe",
+		"tag:rust tag:errors":          "rust-errors",
+		"kind:rule":                    "rust-unsafe",
+		"errors -tag:go":               "rust-errors,rust-unsafe",
+		"-title:rust":                  "go-errors",
+		`don't "unsafe" block's - AND`: "",
+	} {
+		if got := strings.Join(search(query), ","); got != want {
+			t.Errorf("search %q: got %q, want %q", query, got, want)
+		}
+	}
+
+	_, text, isErr := toolCall(t, ts.URL, "search_entries", map[string]any{"query": `title:"error handling`})
+	if !isErr || text != "invalid query: unterminated quote at position 7" {
+		t.Errorf("expected parse error, got %v %q", isErr, text)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	for i := 0; i < 7; i++ {
+		slug := fmt.Sprintf("page-%d", i)
+		createEntry(t, ts.URL, slug, fmt.Sprintf("Page %d", i), "paginated content", "skill", "go", "", "", nil)
+	}
+	createEntry(t, ts.URL, "other", "Other", "unrelated", "rule", "rust", "", "", nil)
+
+	for _, tc := range []struct {
+		tool string
+		args map[string]any
+	}{
+		{"list_entries", map[string]any{"language": "go"}},
+		{"search_entries", map[string]any{"query": "paginated"}},
+		{"search_entries", map[string]any{"query": "paginated", "mode": "semantic"}},
+		{"search_entries", map[string]any{"query": "paginated", "mode": "hybrid"}},
+		{"get_entries_by_context", map[string]any{"language": "go"}},
+	} {
+		seen := map[string]bool{}
+		args := map[string]any{"limit": 3}
+		for k, v := range tc.args {
+			args[k] = v
+		}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("%s %v: too many pages", tc.tool, tc.args)
+			}
+			_, text, isErr := toolCall(t, ts.URL, tc.tool, args)
+			if isErr {
+				t.Fatalf("%s %v: %s", tc.tool, tc.args, text)
+			}
+			var page db.EntryPage
+			json.Unmarshal([]byte(text), &page)
+			if page.Total != 7 {
+				t.Errorf("%s %v: total %d, want 7", tc.tool, tc.args, page.Total)
+			}
+			for _, e := range page.Entries {
+				if seen[e.Slug] {
+					t.Errorf("%s %v: %s repeated across pages", tc.tool, tc.args, e.Slug)
+				}
+				seen[e.Slug] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			args["cursor"] = page.NextCursor
+		}
+		if len(seen) != 7 {
+			t.Errorf("%s %v: paged through %d entries, want 7", tc.tool, tc.args, len(seen))
+		}
+	}
+
+	// A list page is ordered by title
+	page, err := s.DB.ListEntries(ctx, db.Filter{}, db.Page{Limit: 2})
+	if err != nil || len(page.Entries) != 2 || page.Entries[0].Slug != "other" || page.Entries[1].Slug != "page-0" || page.Total != 8 {
+		t.Errorf("first list page: %+v, %v", page, err)
+	}
+
+	if _, err := s.DB.ListEntries(ctx, db.Filter{}, db.Page{Cursor: "bogus"}); !errors.Is(err, db.ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "paginated", "cursor": "bogus"}); !isErr {
+		t.Errorf("expected error for invalid cursor, got %s", text)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	s, ts := setup(t)
+	const sessions, perSession = 16, 20
+
+	// rpc is safe to use from any goroutine: it reports failures as errors
+	// instead of calling t.Fatal.
+	rpc := func(sessionID, method string, params any) (*http.Response, jsonrpcResponse, error) {
+		b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		req, _ := http.NewRequest("POST", ts.URL, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if sessionID != "" {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, jsonrpcResponse{}, err
+		}
+		defer resp.Body.Close()
+		var out jsonrpcResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return nil, out, err
+		}
+		return resp, out, nil
+	}
+	tool := func(sessionID, name string, args map[string]any) error {
+		_, resp, err := rpc(sessionID, "tools/call", map[string]any{"name": name, "arguments": args})
+		if err != nil {
+			return err
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %s", name, resp.Error.Message)
+		}
+		result := resp.Result.(map[string]any)
+		if isErr, _ := result["isError"].(bool); isErr {
+			return fmt.Errorf("%s: %v", name, result["content"])
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, sessions*perSession)
+	for n := 0; n < sessions; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			httpResp, _, err := rpc("", "initialize", map[string]any{
+				"protocolVersion": "2025-11-25",
+				"capabilities":    map[string]any{},
+				"clientInfo":      map[string]any{"name": fmt.Sprintf("agent-%d", n), "version": "1.0"},
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			sid := httpResp.Header.Get("Mcp-Session-Id")
+			for i := 0; i < perSession; i++ {
+				slug := fmt.Sprintf("c-%02d-%02d", n, i)
+				for _, step := range []struct {
+					tool string
+					args map[string]any
+				}{
+					{"create_entry", map[string]any{"slug": slug, "title": "Concurrent " + slug, "content": "written concurrently", "tags": []string{"stress", fmt.Sprintf("agent-%d", n)}}},
+					{"update_entry", map[string]any{"slug": slug, "content": "rewritten concurrently"}},
+					{"search_entries", map[string]any{"query": "concurrently"}},
+					{"get_entry", map[string]any{"slug": slug}},
+				} {
+					if err := tool(sid, step.tool, step.args); err != nil {
+						errs <- fmt.Errorf("session %d, %s: %w", n, slug, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	ctx := context.Background()
+	seen := 0
+	for cursor := ""; ; {
+		page, err := s.DB.ListEntries(ctx, db.Filter{}, db.Page{Limit: 200, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if page.Total != sessions*perSession {
+			t.Fatalf("entries: got %d, want %d", page.Total, sessions*perSession)
+		}
+		for _, e := range page.Entries {
+			if e.Version != 2 || len(e.Tags) != 2 {
+				t.Errorf("%s: version %d, tags %v", e.Slug, e.Version, e.Tags)
+			}
+		}
+		seen += len(page.Entries)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if seen != sessions*perSession {
+		t.Errorf("paged through %d entries, want %d", seen, sessions*perSession)
+	}
+}
+
+func TestEntryCache(t *testing.T) {
+	ctx := context.Background()
+	d, err := db.OpenWithOptions(filepath.Join(t.TempDir(), "test.db"), db.Options{CacheSize: 16})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer d.Close()
+	if err := d.CreateEntry(ctx, &db.Entry{Slug: "hot", Title: "Hot", Content: "v1", Language: "go"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if e, err := d.GetEntry(ctx, "hot"); err != nil || e.Content != "v1" {
+			t.Fatalf("get: %+v, %v", e, err)
+		}
+	}
+	if cs := d.CacheStats(); cs.Hits != 2 || cs.Misses != 1 {
+		t.Errorf("after 3 gets: %+v", cs)
+	}
+	// Cache hits still count as reads
+	d.FlushStats(ctx)
+	if stats, _ := d.GetStats(ctx, "hot"); stats.Reads != 3 {
+		t.Errorf("reads: got %d, want 3", stats.Reads)
+	}
+
+	// Writes invalidate
+	if err := d.UpdateEntry(ctx, "hot", 0, map[string]any{"content": "v2"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if e, _ := d.GetEntry(ctx, "hot"); e.Content != "v2" || e.Version != 2 {
+		t.Errorf("after update: %+v", e)
+	}
+	page, _ := d.GetEntriesByContext(ctx, db.Filter{Language: "go"}, db.Page{})
+	d.CreateEntry(ctx, &db.Entry{Slug: "warm", Title: "Warm", Content: "new", Language: "go"})
+	if page, _ = d.GetEntriesByContext(ctx, db.Filter{Language: "go"}, db.Page{}); page.Total != 2 {
+		t.Errorf("context after create: total %d, want 2", page.Total)
+	}
+
+	// Misses are cached until the entry is created
+	for i := 0; i < 2; i++ {
+		if _, err := d.GetEntry(ctx, "cold"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	}
+	d.CreateEntry(ctx, &db.Entry{Slug: "cold", Title: "Cold", Content: "now here"})
+	if e, err := d.GetEntry(ctx, "cold"); err != nil || e.Content != "now here" {
+		t.Errorf("after create: %+v, %v", e, err)
+	}
+
+	if err := d.DeleteEntry(ctx, "hot", 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := d.GetEntry(ctx, "hot"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("after delete: expected ErrNotFound, got %v", err)
+	}
+	if err := d.RestoreEntry(ctx, "hot"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := d.GetEntry(ctx, "hot"); err != nil {
+		t.Errorf("after restore: %v", err)
+	}
+}
+
+func TestEntryCacheSeesOtherProcesses(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	server, err := db.OpenWithOptions(path, db.Options{CacheSize: 16})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer server.Close()
+	if err := server.CreateEntry(ctx, &db.Entry{Slug: "draft", Title: "Draft", Content: "x", Language: "go", Status: db.StatusProposed}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Cache the proposed entry, a context page without it, and a miss
+	if e, err := server.GetEntry(ctx, "draft"); err != nil || e.Status != db.StatusProposed {
+		t.Fatalf("get: %+v, %v", e, err)
+	}
+	if page, err := server.GetEntriesByContext(ctx, db.Filter{Language: "go"}, db.Page{}); err != nil || page.Total != 0 {
+		t.Fatalf("context: %+v, %v", page, err)
+	}
+	if _, err := server.GetEntry(ctx, "later"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// mcpedia review approve and mcpedia add run as separate processes
+	cli, err := db.Open(path)
+	if err != nil {
+		t.Fatalf("open second db: %v", err)
+	}
+	if err := cli.Approve(ctx, "draft", false); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if err := cli.CreateEntry(ctx, &db.Entry{Slug: "later", Title: "Later", Content: "y"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	cli.Close()
+
+	if e, err := server.GetEntry(ctx, "draft"); err != nil || e.Status != db.StatusApproved {
+		t.Errorf("after approval elsewhere: %+v, %v", e, err)
+	}
+	if page, err := server.GetEntriesByContext(ctx, db.Filter{Language: "go"}, db.Page{}); err != nil || page.Total != 1 {
+		t.Errorf("context after approval elsewhere: %+v, %v", page, err)
+	}
+	if _, err := server.GetEntry(ctx, "later"); err != nil {
+		t.Errorf("cached miss after create elsewhere: %v", err)
+	}
+}
+
+// largeGuide builds a Markdown document of about 60 KB with three sections.
+func largeGuide() string {
+	para := strings.Repeat("Steady prose about building and shipping services. ", 20) + "\n\n"
+	return "# Ops Guide\n\nThe whole runbook.\n\n" +
+		"## Setup\n\n" + strings.Repeat(para, 20) +
+		"## Deployment\n\n" + strings.Repeat(para, 19) + "Roll out with the zebracorn strategy.\n\n" +
+		"### Rollback\n\n" + strings.Repeat(para, 5) +
+		"## Monitoring\n\n" + strings.Repeat(para, 10) + "Watch the dashboards."
+}
+
+func TestLargeEntrySections(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	guide := largeGuide()
+	if len(guide) <= 32768 {
+		t.Fatalf("guide is only %d bytes", len(guide))
+	}
+	createEntry(t, ts.URL, "ops-guide", "Ops Guide", guide, "guide", "", "ops", "", []string{"ops"})
+
+	_, text, isErr := toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "ops-guide"})
+	if isErr {
+		t.Fatalf("get_entry: %s", text)
+	}
+	var got db.Entry
+	json.Unmarshal([]byte(text), &got)
+	if got.Content != guide {
+		t.Errorf("content not reassembled: got %d bytes, want %d", len(got.Content), len(guide))
+	}
+
+	// A single section comes with its subsections, and stops at the next sibling
+	_, text, isErr = toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "ops-guide", "section": "deployment"})
+	if isErr {
+		t.Fatalf("get_entry section: %s", text)
+	}
+	got = db.Entry{}
+	json.Unmarshal([]byte(text), &got)
+	if got.Section != "Deployment" || !strings.HasPrefix(got.Content, "## Deployment\n") ||
+		!strings.Contains(got.Content, "### Rollback") || strings.Contains(got.Content, "## Monitoring") {
+		t.Errorf("section: %q, content %d bytes", got.Section, len(got.Content))
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "ops-guide", "section": "Nope"}); !isErr {
+		t.Errorf("expected error for unknown section, got %s", text)
+	}
+
+	// Search snippets point to the section they come from
+	for _, mode := range []string{"keyword", "semantic"} {
+		_, text, _ = toolCall(t, ts.URL, "search_entries", map[string]any{"query": "zebracorn", "mode": mode})
+		results := pageEntries(t, text)
+		if len(results) != 1 || results[0].Section != "Deployment" {
+			t.Errorf("%s search: expected a hit in Deployment, got %+v", mode, results)
+		}
+	}
+
+	// Updates replace the sections, and revisions keep the whole content
+	smaller := strings.Replace(guide, "## Monitoring", "## Observability", 1)
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "ops-guide", "content": smaller}); isErr {
+		t.Fatalf("update: %s", text)
+	}
+	if e, err := s.DB.GetEntrySection(ctx, "ops-guide", "Observability"); err != nil || !strings.HasSuffix(e.Content, "Watch the dashboards.") {
+		t.Errorf("section after update: %v", err)
+	}
+	if rev, err := s.DB.GetRevision(ctx, "ops-guide", 1); err != nil || rev.Content != guide {
+		t.Errorf("revision content not kept whole: %v", err)
+	}
+
+	// Export and import round-trip the whole document
+	entries, err := s.DB.AllEntries(ctx)
+	if err != nil || len(entries) != 1 || entries[0].Content != smaller {
+		t.Fatalf("all entries: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "ops-guide.md")
+	if err := os.WriteFile(filename, []byte(exportFormat(&entries[0])), 0o644); err != nil {
+		t.Fatalf("write export: %v", err)
+	}
+	if err := s.DB.DeleteEntry(ctx, "ops-guide", 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := s.DB.PurgeEntry(ctx, "ops-guide"); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	imported, err := importfm.ParseImportFile(raw, filename)
+	if err != nil {
+		t.Fatalf("parse import: %v", err)
+	}
+	if err := s.DB.CreateEntry(ctx, imported); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if e, err := s.DB.GetEntry(ctx, "ops-guide"); err != nil || e.Content != smaller {
+		t.Errorf("content changed by export/import: %v", err)
+	}
+
+	// Limits: one section over 32 KB, or more than MaxContentLen in total
+	_, text, isErr = toolCall(t, ts.URL, "create_entry", map[string]any{
+		"slug": "flat", "title": "Flat", "content": "# Flat\n\n" + strings.Repeat("x", 40000),
+	})
+	if !isErr || !strings.Contains(text, "subheadings") {
+		t.Errorf("expected section size error, got %s", text)
+	}
+	huge := strings.Repeat("## Part\n\n"+strings.Repeat("y", 30000)+"\n\n", 40)
+	if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: "huge", Title: "Huge", Content: huge}); !errors.Is(err, db.ErrContentTooLarge) {
+		t.Errorf("expected ErrContentTooLarge, got %v", err)
+	}
+}
+
+func TestGetEntrySection(t *testing.T) {
+	_, ts := setup(t)
+	content := "# Go Testing\n\nIntro.\n\n## Table Tests\n\nUse t.Run.\n\n### Naming\n\nName cases.\n\n## Usage Notes\n\nRun go test."
+	createEntry(t, ts.URL, "go-testing", "Go Testing", content, "guide", "go", "", "", nil)
+
+	// No heading: table of contents
+	_, text, isErr := toolCall(t, ts.URL, "get_entry_section", map[string]any{"slug": "go-testing"})
+	if isErr {
+		t.Fatalf("outline: %s", text)
+	}
+	var outline db.Outline
+	json.Unmarshal([]byte(text), &outline)
+	var headings []string
+	for _, h := range outline.Sections {
+		headings = append(headings, fmt.Sprintf("%d:%s", h.Level, h.Heading))
+	}
+	if want := []string{"1:Go Testing", "2:Table Tests", "3:Naming", "2:Usage Notes"}; !slices.Equal(headings, want) {
+		t.Errorf("outline: got %v, want %v", headings, want)
+	}
+	if outline.Sections[0].Bytes != len(content) {
+		t.Errorf("top section bytes: got %d, want %d", outline.Sections[0].Bytes, len(content))
+	}
+
+	// One heading
+	_, text, isErr = toolCall(t, ts.URL, "get_entry_section", map[string]any{"slug": "go-testing", "heading": "table tests"})
+	if isErr {
+		t.Fatalf("section: %s", text)
+	}
+	var e db.Entry
+	json.Unmarshal([]byte(text), &e)
+	if e.Section != "Table Tests" || e.Content != "## Table Tests\n\nUse t.Run.\n\n### Naming\n\nName cases.\n\n" {
+		t.Errorf("section: %q %q", e.Section, e.Content)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "get_entry_section", map[string]any{"slug": "go-testing", "heading": "Missing"}); !isErr {
+		t.Errorf("expected error for unknown heading, got %s", text)
+	}
+
+	// Resource form
+	read := func(uri string) (string, *rpcError) {
+		_, resp := call(t, ts.URL, "resources/read", 1, map[string]any{"uri": uri}, nil)
+		if resp.Error != nil {
+			return "", resp.Error
+		}
+		contents := resp.Result.(map[string]any)["contents"].([]any)
+		return contents[0].(map[string]any)["text"].(string), nil
+	}
+	if text, err := read("mcpedia://entries/go-testing#Usage%20Notes"); err != nil || text != "## Usage Notes\n\nRun go test." {
+		t.Errorf("resource section: %q %v", text, err)
+	}
+	if text, err := read("mcpedia://entries/go-testing#"); err != nil || !strings.Contains(text, "  - [Table Tests](mcpedia://entries/go-testing#Table%20Tests)") {
+		t.Errorf("resource outline: %q %v", text, err)
+	}
+	if _, err := read("mcpedia://entries/go-testing#Nope"); err == nil {
+		t.Error("expected error for unknown section resource")
+	}
+
+	// The built-in how-to-use entry has sections too
+	_, text, isErr = toolCall(t, ts.URL, "get_entry_section", map[string]any{"slug": "how-to-use", "heading": "Prompts"})
+	if isErr || !strings.Contains(text, "apply-entry") {
+		t.Errorf("how-to-use section: %s", text)
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "b-ref", "Budget Reference", strings.Repeat("r", 400), "reference", "go", "", "", nil)
+	createEntry(t, ts.URL, "b-skill", "Budget Skill", strings.Repeat("s", 5000), "skill", "go", "", "", nil)
+	createEntry(t, ts.URL, "b-guide", "Budget Guide", strings.Repeat("g", 1000), "guide", "go", "", "", nil)
+	createEntry(t, ts.URL, "b-rule", "Budget Rule", strings.Repeat("u", 500), "rule", "go", "", "", nil)
+	createEntry(t, ts.URL, "b-guide-2", "Budget Guide Two", strings.Repeat("h", 1000), "guide", "go", "", "", nil)
+	createEntry(t, ts.URL, "b-other", "Other Language", "x", "rule", "rust", "", "", nil)
+
+	// Usage breaks the tie between the two guides
+	if _, err := s.DB.GetEntry(ctx, "b-guide-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.FlushStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2400 bytes: rule (511) and the used guide (1016) whole; the skill and
+	// the other guide do not fit; the reference (416) does.
+	_, text, isErr := toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"language": "go", "max_tokens": 600})
+	if isErr {
+		t.Fatalf("budget: %s", text)
+	}
+	var pack db.ContextPack
+	if err := json.Unmarshal([]byte(text), &pack); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var order, withContent []string
+	for _, e := range pack.Entries {
+		order = append(order, e.Slug)
+		if e.Content != "" {
+			withContent = append(withContent, e.Slug)
+		}
+	}
+	if want := []string{"b-rule", "b-skill", "b-guide-2", "b-guide", "b-ref"}; !slices.Equal(order, want) {
+		t.Errorf("rank order: got %v, want %v", order, want)
+	}
+	if want := []string{"b-rule", "b-guide-2", "b-ref"}; !slices.Equal(withContent, want) {
+		t.Errorf("whole entries: got %v, want %v", withContent, want)
+	}
+	if !slices.Equal(pack.Truncated, []string{"b-skill", "b-guide"}) || len(pack.Omitted) != 0 {
+		t.Errorf("truncated %v, omitted %v", pack.Truncated, pack.Omitted)
+	}
+	if pack.Total != 5 || pack.BudgetBytes != 2400 || pack.UsedBytes > 2400 {
+		t.Errorf("total %d, budget %d, used %d", pack.Total, pack.BudgetBytes, pack.UsedBytes)
+	}
+
+	// A budget too small for anything omits everything
+	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"language": "go", "max_bytes": 5})
+	pack = db.ContextPack{}
+	json.Unmarshal([]byte(text), &pack)
+	if len(pack.Entries) != 0 || len(pack.Omitted) != 5 {
+		t.Errorf("tiny budget: %+v", pack)
+	}
+
+	// Only entries returned whole count as reads
+	if err := s.DB.FlushStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for slug, want := range map[string]int{"b-rule": 1, "b-skill": 0, "b-guide-2": 2} {
+		if st, err := s.DB.GetStats(ctx, slug); err != nil || st.Reads != want {
+			t.Errorf("%s reads: got %+v, want %d (%v)", slug, st, want, err)
+		}
+	}
+
+	for _, args := range []map[string]any{
+		{"max_tokens": 10, "max_bytes": 10},
+		{"max_bytes": 10, "cursor": "abc"},
+	} {
+		if _, text, isErr := toolCall(t, ts.URL, "get_entries_by_context", args); !isErr {
+			t.Errorf("expected error for %v, got %s", args, text)
+		}
+	}
+}
+
+func TestContextBudgetRankOrder(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	// A top-ranked rule too large to fit whole, and many small references
+	if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: "big-rule", Title: "Big Rule", Description: "Read this first.", Content: strings.Repeat("r", 10500), Kind: "rule", Project: "rank"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 50 {
+		if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: fmt.Sprintf("ref-%02d", i), Title: "Ref", Content: strings.Repeat("f", 197), Kind: "reference", Project: "rank"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pack, err := s.DB.PackEntriesByContext(ctx, db.Filter{Project: "rank"}, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rule gets its description before any reference is packed whole
+	if len(pack.Entries) == 0 || pack.Entries[0].Slug != "big-rule" || pack.Entries[0].Content != "" || len(pack.Truncated) == 0 || pack.Truncated[0] != "big-rule" {
+		t.Errorf("rule should come first as a description: truncated %v, omitted %v", pack.Truncated, pack.Omitted)
+	}
+	if pack.UsedBytes > 10000 {
+		t.Errorf("used %d bytes of 10000", pack.UsedBytes)
+	}
+
+	for _, args := range []map[string]any{{"project": "rank", "max_tokens": -1}, {"project": "rank", "max_bytes": -100}} {
+		if _, text, isErr := toolCall(t, ts.URL, "get_entries_by_context", args); !isErr || !strings.Contains(text, "budget must be positive") {
+			t.Errorf("negative budget %v: %s", args, text)
+		}
+	}
+}
+
+func TestContextBudgetCandidates(t *testing.T) {
+	s, _ := setup(t)
+	ctx := context.Background()
+	for i := range 205 {
+		if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: fmt.Sprintf("many-%03d", i), Title: "Many", Content: "x", Project: "many"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Matches past the ranked candidates are counted, not silently dropped
+	pack, err := s.DB.PackEntriesByContext(ctx, db.Filter{Project: "many"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pack.Total != 205 || len(pack.Omitted) != 200 || pack.OmittedUnlisted != 5 {
+		t.Errorf("total %d, omitted %d, unlisted %d", pack.Total, len(pack.Omitted), pack.OmittedUnlisted)
+	}
+	if pack, err = s.DB.PackEntriesByContext(ctx, db.Filter{Project: "many"}, 1<<20); err != nil || len(pack.Entries) != 200 || pack.OmittedUnlisted != 5 {
+		t.Errorf("large budget: %d entries, %d unlisted, %v", len(pack.Entries), pack.OmittedUnlisted, err)
+	}
+}
+func TestAttachments(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "diagram", "Architecture Diagram", "See the attached diagram.", "reference", "", "", "", nil)
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if err := s.DB.PutAttachment(ctx, "diagram", &db.Attachment{Name: "arch.png", Data: png}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	notes := &db.Attachment{Name: "notes", Data: []byte("plain notes")}
+	if err := s.DB.PutAttachment(ctx, "diagram", notes); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	// No known extension: sniffed from the content
+	if notes.MIMEType != "text/plain; charset=utf-8" {
+		t.Errorf("sniffed MIME type: %q", notes.MIMEType)
+	}
+
+	// Listed in get_entry, without data
+	_, text, isErr := toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "diagram"})
+	if isErr {
+		t.Fatalf("get_entry: %s", text)
+	}
+	var e db.Entry
+	json.Unmarshal([]byte(text), &e)
+	if len(e.Attachments) != 2 || e.Attachments[0].Name != "arch.png" || e.Attachments[0].MIMEType != "image/png" || e.Attachments[0].Size != len(png) {
+		t.Errorf("attachments: %+v", e.Attachments)
+	}
+
+	// Read as a blob resource
+	_, resp := call(t, ts.URL, "resources/read", 1, map[string]any{"uri": "mcpedia://entries/diagram/attachments/arch.png"}, nil)
+	if resp.Error != nil {
+		t.Fatalf("read attachment: %+v", resp.Error)
+	}
+	c0 := resp.Result.(map[string]any)["contents"].([]any)[0].(map[string]any)
+	if c0["mimeType"] != "image/png" || c0["blob"] != base64.StdEncoding.EncodeToString(png) {
+		t.Errorf("blob resource: %v", c0)
+	}
+	_, resp = call(t, ts.URL, "resources/read", 2, map[string]any{"uri": "mcpedia://entries/diagram/attachments/nope.png"}, nil)
+	if resp.Error == nil {
+		t.Error("expected error for unknown attachment")
+	}
+
+	// Limits and names
+	if err := s.DB.PutAttachment(ctx, "diagram", &db.Attachment{Name: "big.bin", Data: make([]byte, db.MaxAttachmentSize+1)}); !errors.Is(err, db.ErrAttachmentTooLarge) {
+		t.Errorf("expected ErrAttachmentTooLarge, got %v", err)
+	}
+	for _, name := range []string{"", "../etc", ".hidden", "a b.txt"} {
+		if err := s.DB.PutAttachment(ctx, "diagram", &db.Attachment{Name: name, Data: []byte("x")}); err == nil {
+			t.Errorf("expected error for name %q", name)
+		}
+	}
+	if err := s.DB.PutAttachment(ctx, "missing", &db.Attachment{Name: "a.txt", Data: []byte("x")}); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing entry, got %v", err)
+	}
+
+	// Export and import round trip
+	entry, err := s.DB.GetEntry(ctx, "diagram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "diagram.md")
+	md := exportFormat(entry)
+	if !strings.Contains(md, "attachments: [arch.png:image/png, notes:text/plain; charset=utf-8]") {
+		t.Errorf("export frontmatter: %s", md)
+	}
+	if err := os.WriteFile(filename, []byte(md), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	attDir := importfm.AttachmentsDir(filename)
+	os.MkdirAll(attDir, 0o755)
+	os.WriteFile(filepath.Join(attDir, "arch.png"), png, 0o644)
+	os.WriteFile(filepath.Join(attDir, "notes"), []byte("plain notes"), 0o644)
+
+	if err := s.DB.DeleteEntry(ctx, "diagram", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.PurgeTrash(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := importfm.ParseImportFile([]byte(md), filename)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := importfm.ReadAttachments(imported, filename); err != nil {
+		t.Fatalf("read attachments: %v", err)
+	}
+	if err := s.DB.CreateEntry(ctx, imported); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	a, err := s.DB.GetAttachment(ctx, "diagram", "arch.png")
+	if err != nil || !bytes.Equal(a.Data, png) || a.MIMEType != "image/png" {
+		t.Errorf("imported attachment: %+v %v", a, err)
+	}
+
+	// Detach
+	if err := s.DB.DeleteAttachment(ctx, "diagram", "arch.png"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := s.DB.DeleteAttachment(ctx, "diagram", "arch.png"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+	if list, _ := s.DB.ListAttachments(ctx, "diagram"); len(list) != 1 || list[0].Name != "notes" {
+		t.Errorf("after detach: %+v", list)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	fed := mcp.NewFederation()
+	servers := map[string]*mcp.Server{}
+	for name, token := range map[string]string{"team": "", "personal": "p-secret", "client": "c-secret"} {
+		d, err := db.Open(filepath.Join(t.TempDir(), name+".db"))
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		t.Cleanup(func() { d.Close() })
+		servers[name] = &mcp.Server{DB: d, Token: token}
+	}
+	for _, name := range []string{"team", "personal", "client"} {
+		if err := fed.Add(name, servers[name]); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if err := fed.Add("team", &mcp.Server{}); err == nil {
+		t.Error("expected error for duplicate namespace")
+	}
+	if err := fed.Add("Bad/Name", &mcp.Server{}); err == nil {
+		t.Error("expected error for invalid namespace name")
+	}
+	ts := httptest.NewServer(fed.Handler())
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	for name, s := range servers {
+		for i := 1; i <= 2; i++ {
+			e := &db.Entry{Slug: fmt.Sprintf("%s-retry-%d", name, i), Title: fmt.Sprintf("Retry policy %d (%s)", i, name), Content: "Retry with backoff."}
+			if err := s.DB.CreateEntry(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	searchArgs := func(namespaces ...string) map[string]any {
+		return map[string]any{"name": "search_entries", "arguments": map[string]any{"query": "retry", "namespaces": namespaces}}
+	}
+	decode := func(resp jsonrpcResponse) (mcp.FederatedPage, string, bool) {
+		t.Helper()
+		if resp.Error != nil {
+			t.Fatalf("rpc error: %+v", resp.Error)
+		}
+		result := resp.Result.(map[string]any)
+		text := result["content"].([]any)[0].(map[string]any)["text"].(string)
+		var page mcp.FederatedPage
+		if isErr, _ := result["isError"].(bool); isErr {
+			return page, text, true
+		}
+		if err := json.Unmarshal([]byte(text), &page); err != nil {
+			t.Fatalf("decode %q: %v", text, err)
+		}
+		return page, text, false
+	}
+
+	// Each namespace has its own database and token
+	if status, _ := call(t, ts.URL+"/mcp/personal", "ping", 1, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("personal without token: status %d", status)
+	}
+	_, resp := call(t, ts.URL+"/mcp/team", "tools/call", 1, map[string]any{"name": "get_entry", "arguments": map[string]any{"slug": "personal-retry-1"}}, nil)
+	if _, text, isErr := decode(resp); !isErr {
+		t.Errorf("team should not see personal entries: %s", text)
+	}
+	if status, _ := call(t, ts.URL+"/mcp/other", "ping", 1, nil, nil); status != http.StatusNotFound {
+		t.Errorf("unknown namespace: status %d", status)
+	}
+
+	// Federated search, labeled and interleaved by rank
+	auth := map[string]string{"Authorization": "Bearer p-secret"}
+	_, resp = call(t, ts.URL+"/mcp/personal", "tools/call", 1, searchArgs("team", "personal"), auth)
+	page, text, isErr := decode(resp)
+	if isErr {
+		t.Fatalf("federated search: %s", text)
+	}
+	var got []string
+	for _, e := range page.Entries {
+		if !strings.HasPrefix(e.Slug, e.Namespace+"-") {
+			t.Errorf("%s labeled %s", e.Slug, e.Namespace)
+		}
+		got = append(got, e.Namespace)
+	}
+	if want := []string{"team", "personal", "team", "personal"}; !slices.Equal(got, want) {
+		t.Errorf("namespaces of results: got %v, want %v", got, want)
+	}
+	if page.Total != 4 || !slices.Equal(page.Namespaces, []string{"team", "personal"}) {
+		t.Errorf("total %d, namespaces %v", page.Total, page.Namespaces)
+	}
+
+	// A namespace with another token is refused; "*" covers all of them
+	_, resp = call(t, ts.URL+"/mcp/personal", "tools/call", 1, searchArgs("*"), auth)
+	if _, text, isErr := decode(resp); !isErr || !strings.Contains(text, "client") {
+		t.Errorf("expected client to be refused, got %s", text)
+	}
+	_, resp = call(t, ts.URL+"/mcp/team", "tools/call", 1, searchArgs("team", "nope"), nil)
+	if _, text, isErr := decode(resp); !isErr || !strings.Contains(text, "available: team, personal, client") {
+		t.Errorf("expected unknown namespace error, got %s", text)
+	}
+
+	// Without a federation, namespaces are an error
+	_, single := setup(t)
+	if _, text, isErr := toolCall(t, single.URL, "search_entries", map[string]any{"query": "retry", "namespaces": []string{"team"}}); !isErr {
+		t.Errorf("expected error outside a federation, got %s", text)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "api-notes", "API Notes", "Notes.", "context", "", "", "api", nil)
+	createEntry(t, ts.URL, "company-rule", "Company Rule", "Rule.", "rule", "", "", "", nil)
+
+	reader, _, err := s.DB.CreateToken(ctx, "reader", db.RoleRead, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, _, err := s.DB.CreateToken(ctx, "api-bot", db.RoleWrite, "api", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.DB.CreateToken(ctx, "bad", "owner", "", ""); err == nil {
+		t.Error("expected error for invalid role")
+	}
+	if _, _, err := s.DB.CreateToken(ctx, "bad", db.RoleRead, "api", ""); err == nil {
+		t.Error("expected error for a scoped read token")
+	}
+	if _, _, err := s.DB.CreateToken(ctx, "reader", db.RoleRead, "", ""); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+
+	as := func(token string) map[string]string { return map[string]string{"Authorization": "Bearer " + token} }
+	tool := func(token, name string, args map[string]any) (string, bool) {
+		t.Helper()
+		_, resp := call(t, ts.URL, "tools/call", 1, map[string]any{"name": name, "arguments": args}, as(token))
+		if resp.Error != nil {
+			t.Fatalf("rpc error: %+v", resp.Error)
+		}
+		result := resp.Result.(map[string]any)
+		isErr, _ := result["isError"].(bool)
+		return result["content"].([]any)[0].(map[string]any)["text"].(string), isErr
+	}
+
+	// Once tokens exist, requests need one
+	if status, _ := call(t, ts.URL, "ping", 1, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("no token: status %d", status)
+	}
+	if status, _ := call(t, ts.URL, "ping", 1, nil, as("mcpedia_wrong")); status != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d", status)
+	}
+
+	// Read role: reads only, and write tools are not listed
+	if text, isErr := tool(reader, "get_entry", map[string]any{"slug": "api-notes"}); isErr {
+		t.Errorf("reader get_entry: %s", text)
+	}
+	if text, isErr := tool(reader, "delete_entry", map[string]any{"slug": "api-notes"}); !isErr || !strings.Contains(text, "needs write") {
+		t.Errorf("reader delete_entry: %s", text)
+	}
+	_, resp := call(t, ts.URL, "tools/list", 1, nil, as(reader))
+	for _, tl := range resp.Result.(map[string]any)["tools"].([]any) {
+		if name := tl.(map[string]any)["name"]; name == "create_entry" || name == "update_entry" {
+			t.Errorf("reader should not see %s", name)
+		}
+	}
+
+	// Write role scoped to a project
+	if text, isErr := tool(writer, "update_entry", map[string]any{"slug": "api-notes", "content": "Updated."}); isErr {
+		t.Errorf("scoped update in project: %s", text)
+	}
+	if text, isErr := tool(writer, "update_entry", map[string]any{"slug": "company-rule", "content": "Changed."}); !isErr || !strings.Contains(text, "project=api") {
+		t.Errorf("scoped update outside project: %s", text)
+	}
+	if text, isErr := tool(writer, "update_entry", map[string]any{"slug": "api-notes", "project": "web"}); !isErr {
+		t.Errorf("moving an entry out of scope should fail: %s", text)
+	}
+	if text, isErr := tool(writer, "create_entry", map[string]any{"slug": "api-new", "title": "New", "content": "x", "project": "api"}); isErr {
+		t.Errorf("scoped create: %s", text)
+	}
+	if text, isErr := tool(writer, "create_entry", map[string]any{"slug": "web-new", "title": "New", "content": "x"}); !isErr {
+		t.Errorf("create outside scope should fail: %s", text)
+	}
+	if text, isErr := tool(writer, "delete_entry", map[string]any{"slug": "api-new"}); isErr {
+		t.Errorf("scoped delete: %s", text)
+	}
+	if text, isErr := tool(writer, "restore_entry", map[string]any{"slug": "api-new"}); isErr {
+		t.Errorf("scoped restore from trash: %s", text)
+	}
+
+	// Restoring a version checks the project of that version, not the current one
+	if err := s.DB.UpdateEntry(ctx, "company-rule", 0, map[string]any{"project": "api"}); err != nil {
+		t.Fatal(err)
+	}
+	if text, isErr := tool(writer, "restore_entry", map[string]any{"slug": "company-rule", "version": 1}); !isErr || !strings.Contains(text, "project=api") {
+		t.Errorf("restoring a version from another project should fail: %s", text)
+	}
+	if rev, err := s.DB.GetEntryMeta(ctx, "company-rule"); err != nil || rev.Project != "api" {
+		t.Errorf("entry after refused restore: %+v, %v", rev, err)
+	}
+
+	// An empty kind is stored as given, so it must be in scope too
+	ruleBot, _, err := s.DB.CreateToken(ctx, "rule-bot", db.RoleWrite, "", "rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, isErr := tool(ruleBot, "update_entry", map[string]any{"slug": "company-rule", "kind": ""}); !isErr || !strings.Contains(text, "kind=rule") {
+		t.Errorf("clearing the kind should fail: %s", text)
+	}
+	if text, isErr := tool(ruleBot, "update_entry", map[string]any{"slug": "company-rule", "kind": "rule", "content": "Same kind."}); isErr {
+		t.Errorf("update keeping the kind: %s", text)
+	}
+
+	// Revoked tokens stop working
+	if err := s.DB.RevokeToken(ctx, "reader"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := call(t, ts.URL, "ping", 1, nil, as(reader)); status != http.StatusUnauthorized {
+		t.Errorf("revoked token: status %d", status)
+	}
+	if err := s.DB.RevokeToken(ctx, "reader"); err == nil {
+		t.Error("expected error revoking twice")
+	}
+	tokens, _ := s.DB.ListTokens(ctx)
+	if len(tokens) != 3 || tokens[0].Name != "api-bot" || tokens[1].RevokedAt == "" {
+		t.Errorf("tokens: %+v", tokens)
+	}
+	raw, _ := json.Marshal(tokens)
+	if strings.Contains(string(raw), writer) {
+		t.Error("token list must not contain the token")
+	}
+
+	// The shared server token keeps full access alongside API tokens
+	shared, sharedTS := setupWithToken(t, "shared-secret")
+	if _, _, err := shared.DB.CreateToken(ctx, "reader", db.RoleRead, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, resp = call(t, sharedTS.URL, "tools/call", 1, map[string]any{"name": "create_entry", "arguments": map[string]any{"slug": "s", "title": "S", "content": "x"}}, as("shared-secret"))
+	if isErr, _ := resp.Result.(map[string]any)["isError"].(bool); isErr {
+		t.Errorf("shared token: %+v", resp.Result)
+	}
+}
+
+func TestScopedLocks(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "company-rule", "Company Rule", "Rule.", "rule", "", "", "", nil)
+	createEntry(t, ts.URL, "api-notes", "API Notes", "Notes.", "context", "", "", "api", []string{"frozen"})
+	createEntry(t, ts.URL, "web-notes", "Web Notes", "Notes.", "context", "", "", "web", nil)
+	// web-notes was a rule at version 2 and tagged frozen at version 3
+	for _, fields := range []map[string]any{
+		{"kind": "rule"}, {"kind": "context", "tags": []string{"frozen"}}, {"tags": []string{}},
+	} {
+		if err := s.DB.UpdateEntry(ctx, "web-notes", 0, fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.DB.LockScope(ctx, db.LockSpec{Kind: "rule"}, "tok", db.LockOptions{}); err != nil {
+		t.Fatalf("lock kind: %v", err)
+	}
+	if err := s.DB.LockScope(ctx, db.LockSpec{Kind: "rule"}, "tok2", db.LockOptions{}); !errors.Is(err, db.ErrLocked) {
+		t.Errorf("expected ErrLocked for the same scope, got %v", err)
+	}
+	if err := s.DB.LockScope(ctx, db.LockSpec{Tag: "frozen"}, "tok", db.LockOptions{}); err != nil {
+		t.Fatalf("lock tag: %v", err)
+	}
+	if locked, _ := s.DB.IsLocked(ctx); locked {
+		t.Error("scoped locks should not lock the whole database")
+	}
+
+	for _, c := range []struct {
+		tool    string
+		args    map[string]any
+		blocked bool
+	}{
+		{"update_entry", map[string]any{"slug": "company-rule", "content": "x"}, true},
+		{"delete_entry", map[string]any{"slug": "company-rule"}, true},
+		{"create_entry", map[string]any{"slug": "new-rule", "title": "New", "content": "x", "kind": "rule"}, true},
+		{"update_entry", map[string]any{"slug": "web-notes", "kind": "rule"}, true},
+		{"update_entry", map[string]any{"slug": "api-notes", "content": "x"}, true},
+		{"restore_entry", map[string]any{"slug": "web-notes", "version": 2}, true},
+		{"restore_entry", map[string]any{"slug": "web-notes", "version": 3}, true},
+		{"update_entry", map[string]any{"slug": "web-notes", "content": "x"}, false},
+		{"create_entry", map[string]any{"slug": "new-note", "title": "New", "content": "x", "kind": "context"}, false},
+		{"restore_entry", map[string]any{"slug": "web-notes", "version": 1}, false},
+	} {
+		_, text, isErr := toolCall(t, ts.URL, c.tool, c.args)
+		if isErr != c.blocked {
+			t.Errorf("%s %v: blocked=%v, want %v (%s)", c.tool, c.args, isErr, c.blocked, text)
+		}
+		if c.blocked && !strings.Contains(text, "locked") {
+			t.Errorf("%s %v: expected a lock error, got %s", c.tool, c.args, text)
+		}
+	}
+
+	locks, _ := s.DB.Locks(ctx)
+	if len(locks) != 2 || locks[0].String() != "kind=rule" || locks[1].String() != "tag=frozen" {
+		t.Errorf("locks: %v", locks)
+	}
+	if err := s.DB.UnlockScope(ctx, db.LockSpec{Kind: "rule"}, "wrong"); err == nil {
+		t.Error("expected error for wrong token")
+	}
+	if err := s.DB.UnlockScope(ctx, db.LockSpec{Project: "api"}, "tok"); err == nil {
+		t.Error("expected error unlocking a scope that is not locked")
+	}
+	if err := s.DB.UnlockScope(ctx, db.LockSpec{Kind: "rule"}, "tok"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "company-rule", "content": "x"}); isErr {
+		t.Errorf("update after unlock: %s", text)
+	}
+}
+
+func TestLockStatus(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "notes", "Notes", "Notes.", "context", "", "", "", nil)
+
+	_, text, isErr := toolCall(t, ts.URL, "get_lock_status", nil)
+	if isErr || text != `{"locked":false,"locks":[]}` {
+		t.Errorf("unlocked status: %s", text)
+	}
+
+	if err := s.DB.LockScope(ctx, db.LockSpec{}, "tok", db.LockOptions{Reason: "release freeze", For: time.Second}); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := s.DB.LockScope(ctx, db.LockSpec{Kind: "rule"}, "tok", db.LockOptions{Reason: "policy"}); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := s.DB.LockScope(ctx, db.LockSpec{Kind: "guide"}, "tok", db.LockOptions{For: -time.Second}); err == nil {
+		t.Error("expected error for a negative duration")
+	}
+
+	// The reason and expiry reach agents in errors and in get_lock_status
+	_, text, _ = toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "notes", "content": "x"})
+	if !strings.Contains(text, "database is locked since ") || !strings.Contains(text, "(reason: release freeze), until ") {
+		t.Errorf("lock error: %s", text)
+	}
+	_, text, _ = toolCall(t, ts.URL, "get_lock_status", nil)
+	var status struct {
+		Locked bool           `json:"locked"`
+		Locks  []db.WriteLock `json:"locks"`
+	}
+	json.Unmarshal([]byte(text), &status)
+	if !status.Locked || len(status.Locks) != 2 || status.Locks[0].Reason != "release freeze" || status.Locks[0].ExpiresAt == "" || status.Locks[1].Kind != "rule" || status.Locks[1].Since == "" {
+		t.Errorf("status: %s", text)
+	}
+
+	// The global lock expires on its own; the scoped one stays
+	time.Sleep(2 * time.Second)
+	if locked, err := s.DB.IsLocked(ctx); err != nil || locked {
+		t.Errorf("expected the lock to expire: %v, %v", locked, err)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "notes", "content": "x"}); isErr {
+		t.Errorf("update after expiry: %s", text)
+	}
+	_, text, isErr = toolCall(t, ts.URL, "create_entry", map[string]any{"slug": "r", "title": "R", "content": "x", "kind": "rule"})
+	if !isErr || !strings.Contains(text, "entries with kind=rule are locked since ") || !strings.Contains(text, "(reason: policy)") {
+		t.Errorf("scoped lock error: %s", text)
+	}
+	if err := s.DB.Unlock(ctx, "tok"); err == nil {
+		t.Error("unlocking an expired lock should fail")
+	}
+	if err := s.DB.Lock(ctx, "tok2"); err != nil {
+		t.Errorf("lock after expiry: %v", err)
+	}
+	if err := s.DB.Unlock(ctx, "tok2"); err != nil {
+		t.Errorf("unlock: %v", err)
+	}
+
+	events, err := s.DB.LockHistory(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Event+" "+e.LockSpec.String())
+	}
+	want := []string{"unlock database", "lock database", "expire database", "lock kind=rule", "lock database"}
+	if !slices.Equal(got, want) {
+		t.Errorf("history: got %v, want %v", got, want)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	secret, _, err := s.DB.CreateToken(ctx, "ci-bot", db.RoleWrite, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open a session as a named client
+	b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]any{
+		"protocolVersion": "2025-11-25",
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "cursor", "version": "1.0"},
+	}})
+	req, _ := http.NewRequest("POST", ts.URL, bytes.NewReader(b))
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Mcp-Session-Id")
+	if session == "" {
+		t.Fatal("no session id")
+	}
+	headers := map[string]string{"Authorization": "Bearer " + secret, "Mcp-Session-Id": session}
+	tool := func(name string, args map[string]any) {
+		t.Helper()
+		_, resp := call(t, ts.URL, "tools/call", 1, map[string]any{"name": name, "arguments": args}, headers)
+		if resp.Error != nil || resp.Result.(map[string]any)["isError"] == true {
+			t.Fatalf("%s: %+v %+v", name, resp.Error, resp.Result)
+		}
+	}
+	tool("create_entry", map[string]any{"slug": "go-testing", "title": "Go Testing", "content": "v1"})
+	tool("update_entry", map[string]any{"slug": "go-testing", "content": "v2"})
+	tool("update_entry", map[string]any{"slug": "go-testing", "title": "Testing in Go"})
+	tool("delete_entry", map[string]any{"slug": "go-testing"})
+
+	// Changes made outside MCP are logged without an actor
+	if err := s.DB.RestoreEntry(ctx, "go-testing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.PutAttachment(ctx, "go-testing", &db.Attachment{Name: "notes.txt", Data: []byte("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.RestoreRevision(ctx, "go-testing", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: "other", Title: "Other", Content: "Other."}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.DB.AuditLog(ctx, db.AuditFilter{Slug: "go-testing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range slices.Backward(events) {
+		ops = append(ops, e.Operation)
+	}
+	want := []string{"create", "update", "update", "delete", "restore", "attach", "restore_revision"}
+	if !slices.Equal(ops, want) {
+		t.Fatalf("operations: %v (want %v)", ops, want)
+	}
+	hash := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	create, update, retitle, del := events[6], events[5], events[4], events[3]
+	if create.BeforeHash != "" || create.AfterHash != hash("v1") {
+		t.Errorf("create hashes: %+v", create)
+	}
+	if update.BeforeHash != hash("v1") || update.AfterHash != hash("v2") {
+		t.Errorf("update hashes: %+v", update)
+	}
+	if retitle.BeforeHash != retitle.AfterHash {
+		t.Errorf("title change should keep the content hash: %+v", retitle)
+	}
+	if del.BeforeHash != hash("v2") || del.AfterHash != "" {
+		t.Errorf("delete hashes: %+v", del)
+	}
+	if del.Session != session || del.Client != "cursor" || del.Token != "ci-bot" || del.At == "" {
+		t.Errorf("delete actor: %+v", del)
+	}
+	if restore := events[2]; restore.Token != "" || restore.Session != "" || restore.AfterHash != hash("v2") {
+		t.Errorf("restore: %+v", restore)
+	}
+	if attach := events[1]; attach.Detail != "notes.txt" || attach.AfterHash != hash("hi") {
+		t.Errorf("attach: %+v", attach)
+	}
+	if rev := events[0]; rev.Detail != "version 1" || rev.AfterHash != hash("v1") {
+		t.Errorf("restore_revision: %+v", rev)
+	}
+
+	all, err := s.DB.AuditLog(ctx, db.AuditFilter{Since: "2000-01-01 00:00:00", Limit: 3})
+	if err != nil || len(all) != 3 || all[0].Slug != "other" {
+		t.Errorf("since/limit: %+v, %v", all, err)
+	}
+	if later, err := s.DB.AuditLog(ctx, db.AuditFilter{Since: "2999-01-01 00:00:00"}); err != nil || len(later) != 0 {
+		t.Errorf("future since: %+v, %v", later, err)
+	}
+
+	// Links are logged against the entry they start from; re-adding one changes nothing
+	for range 2 {
+		if err := s.DB.AddLink(ctx, "other", "go-testing", db.LinkDependsOn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.DB.RemoveLink(ctx, "other", "go-testing", db.LinkDependsOn); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.RemoveLink(ctx, "other", "go-testing", db.LinkDependsOn); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("remove missing link: %v", err)
+	}
+	links, err := s.DB.AuditLog(ctx, db.AuditFilter{Slug: "other"})
+	if err != nil || len(links) != 3 || links[0].Operation != db.OpUnlink || links[1].Operation != db.OpLink ||
+		links[0].Detail != "depends-on:go-testing" || links[1].Detail != "depends-on:go-testing" {
+		t.Errorf("link events: %+v, %v", links, err)
+	}
+
+	// Purging the entry keeps its history, and the log cannot be rewritten
+	s.DB.DeleteEntry(ctx, "go-testing", 0)
+	if err := s.DB.PurgeEntry(ctx, "go-testing"); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := s.DB.AuditLog(ctx, db.AuditFilter{Slug: "go-testing"}); len(events) != 9 || events[0].Operation != "purge" {
+		t.Errorf("after purge: %d events", len(events))
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.db")
+	d, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.CreateEntry(ctx, &db.Entry{Slug: "x", Title: "X", Content: "x"})
+	d.Close()
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(`UPDATE audit_log SET token = 'someone-else'`); err == nil {
+		t.Error("expected audit_log update to fail")
+	}
+	if _, err := raw.Exec(`DELETE FROM audit_log`); err == nil {
+		t.Error("expected audit_log delete to fail")
+	}
+}
+
+func TestExpectedVersion(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	createEntry(t, ts.URL, "go-testing", "Go Testing", "v1", "", "", "", "", nil)
+
+	// Two agents read version 1; the first update wins
+	_, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-testing", "content": "agent A", "expected_version": 1})
+	if isErr {
+		t.Fatalf("first update: %s", text)
+	}
+	_, text, isErr = toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-testing", "content": "agent B", "expected_version": 1})
+	if !isErr || !strings.Contains(text, "version conflict") || !strings.Contains(text, "at version 2, not 1") {
+		t.Errorf("second update: %v %s", isErr, text)
+	}
+	e, _ := s.DB.GetEntry(ctx, "go-testing")
+	if e.Content != "agent A" || e.Version != 2 {
+		t.Errorf("entry after conflict: version %d %q", e.Version, e.Content)
+	}
+
+	// Without expected_version the write goes through as before
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-testing", "title": "Testing"}); isErr {
+		t.Fatalf("unconditional update: %s", text)
+	}
+
+	_, text, isErr = toolCall(t, ts.URL, "delete_entry", map[string]any{"slug": "go-testing", "expected_version": 2})
+	if !isErr || !strings.Contains(text, "version conflict") {
+		t.Errorf("stale delete: %v %s", isErr, text)
+	}
+	if _, err := s.DB.GetEntryMeta(ctx, "go-testing"); err != nil {
+		t.Errorf("entry deleted despite conflict: %v", err)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "delete_entry", map[string]any{"slug": "go-testing", "expected_version": 3}); isErr {
+		t.Fatalf("delete: %s", text)
+	}
+
+	createEntry(t, ts.URL, "other", "Other", "x", "", "", "", "", nil)
+	if err := s.DB.UpdateEntry(ctx, "other", 5, map[string]any{"title": "Y"}); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("db update: %v", err)
+	}
+	if err := s.DB.DeleteEntry(ctx, "other", 2); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("db delete: %v", err)
+	}
+	if err := s.DB.UpdateEntry(ctx, "missing", 1, map[string]any{"title": "Y"}); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("missing entry: %v", err)
+	}
+}
+
+func TestReviewDates(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	day := func(offset int) string { return time.Now().UTC().AddDate(0, 0, offset).Format(time.DateOnly) }
+
+	create := func(slug, reviewAfter, expiresAt string) {
+		t.Helper()
+		_, text, isErr := toolCall(t, ts.URL, "create_entry", map[string]any{
+			"slug": slug, "title": slug, "content": "grpc-go v1 notes", "project": "api",
+			"review_after": reviewAfter, "expires_at": expiresAt,
+		})
+		if isErr {
+			t.Fatalf("create %s: %s", slug, text)
+		}
+	}
+	create("fresh", day(30), day(60))
+	create("review-due", day(-3), "")
+	create("expired", day(-10), day(0))
+	create("undated", "", "")
+
+	if _, text, isErr := toolCall(t, ts.URL, "create_entry", map[string]any{"slug": "bad", "title": "Bad", "content": "x", "expires_at": "next week"}); !isErr || !strings.Contains(text, "YYYY-MM-DD") {
+		t.Errorf("invalid date: %v %s", isErr, text)
+	}
+
+	stale := func(entries []db.Entry) map[string]string {
+		out := map[string]string{}
+		for _, e := range entries {
+			out[e.Slug] = e.Stale
+		}
+		return out
+	}
+	want := map[string]string{"fresh": "", "review-due": db.StaleReviewDue, "expired": db.StaleExpired, "undated": ""}
+
+	_, text, _ := toolCall(t, ts.URL, "search_entries", map[string]any{"query": "grpc"})
+	if got := stale(pageEntries(t, text)); !maps.Equal(got, want) {
+		t.Errorf("search stale: %v", got)
+	}
+	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"project": "api"})
+	if got := stale(pageEntries(t, text)); !maps.Equal(got, want) {
+		t.Errorf("context stale: %v", got)
+	}
+	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"project": "api", "exclude_expired": true})
+	if entries := pageEntries(t, text); len(entries) != 3 || slices.ContainsFunc(entries, func(e db.Entry) bool { return e.Slug == "expired" }) {
+		t.Errorf("exclude_expired: %v", stale(entries))
+	}
+	_, text, _ = toolCall(t, ts.URL, "get_entries_by_context", map[string]any{"project": "api", "exclude_expired": true, "max_bytes": 10000})
+	var pack db.ContextPack
+	json.Unmarshal([]byte(text), &pack)
+	if pack.Total != 3 || stale(pack.Entries)["review-due"] != db.StaleReviewDue {
+		t.Errorf("budgeted exclude_expired: %+v", pack)
+	}
+	_, text, _ = toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "review-due"})
+	var e db.Entry
+	json.Unmarshal([]byte(text), &e)
+	if e.Stale != db.StaleReviewDue || e.ReviewAfter != day(-3) {
+		t.Errorf("get_entry: %+v", e)
+	}
+
+	// Reviewing an entry means moving its date forward
+	_, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "review-due", "review_after": day(90)})
+	if isErr {
+		t.Fatalf("update: %s", text)
+	}
+	got, err := s.DB.StaleEntries(ctx)
+	if err != nil || len(got) != 1 || got[0].Slug != "expired" || got[0].Stale != db.StaleExpired {
+		t.Errorf("stale entries: %+v, %v", got, err)
+	}
+	if err := s.DB.UpdateEntry(ctx, "expired", 0, map[string]any{"expires_at": ""}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.UpdateEntry(ctx, "expired", 0, map[string]any{"review_after": "2026-13-01"}); err == nil {
+		t.Error("expected error for invalid review date")
+	}
+	got, _ = s.DB.StaleEntries(ctx)
+	if len(got) != 1 || got[0].Stale != db.StaleReviewDue {
+		t.Errorf("after clearing expiry: %+v", got)
+	}
+}
+
+func TestReviewWorkflow(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: "go-errors", Title: "Go Errors", Content: "Wrap errors with %w."}); err != nil {
+		t.Fatal(err)
+	}
+	s.ProposeWrites = true
+
+	// A new entry lands as proposed and stays out of retrieval
+	_, text, isErr := toolCall(t, ts.URL, "create_entry", map[string]any{"slug": "go-testing", "title": "Go Testing", "content": "Use table tests."})
+	if isErr || !strings.Contains(text, `"status":"proposed"`) {
+		t.Fatalf("create: %v %s", isErr, text)
+	}
+	slugs := func(tool string, args map[string]any) []string {
+		t.Helper()
+		_, text, isErr := toolCall(t, ts.URL, tool, args)
+		if isErr {
+			t.Fatalf("%s: %s", tool, text)
+		}
+		var out []string
+		for _, e := range pageEntries(t, text) {
+			out = append(out, e.Slug)
+		}
+		return out
+	}
+	if got := slugs("search_entries", map[string]any{"query": "go"}); !slices.Equal(got, []string{"go-errors"}) {
+		t.Errorf("search: %v", got)
+	}
+	if got := slugs("list_entries", map[string]any{}); !slices.Equal(got, []string{"go-errors"}) {
+		t.Errorf("list: %v", got)
+	}
+	if got := slugs("get_entries_by_context", map[string]any{"include_proposed": true}); !slices.Equal(got, []string{"go-errors", "go-testing"}) {
+		t.Errorf("context with proposed: %v", got)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "go-testing"}); !isErr || !strings.Contains(text, "awaiting review") {
+		t.Errorf("get proposed entry: %v %s", isErr, text)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "get_entry", map[string]any{"slug": "go-testing", "include_proposed": true}); isErr {
+		t.Errorf("get with include_proposed: %s", text)
+	}
+
+	// Changes to a proposed entry are made directly; changes to approved
+	// entries are queued and merged
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-testing", "content": "Use table tests and t.Run."}); isErr {
+		t.Fatalf("update proposed entry: %s", text)
+	}
+	_, text, isErr = toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-errors", "content": "Wrap errors with %w; check them with errors.Is."})
+	if isErr || !strings.Contains(text, `"proposal"`) {
+		t.Fatalf("propose update: %v %s", isErr, text)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-errors", "title": "Errors in Go"}); isErr {
+		t.Fatalf("second update: %s", text)
+	}
+	e, _ := s.DB.GetEntry(ctx, "go-errors")
+	if e.Version != 1 || e.Content != "Wrap errors with %w." {
+		t.Errorf("approved entry changed before review: %+v", e)
+	}
+
+	queue, err := s.DB.ReviewQueue(ctx)
+	if err != nil || len(queue) != 2 {
+		t.Fatalf("queue: %+v, %v", queue, err)
+	}
+	if q := queue[0]; q.Slug != "go-testing" || q.Operation != db.OpCreate || q.Status != db.StatusProposed || q.Token != "anonymous" {
+		t.Errorf("create proposal: %+v", q)
+	}
+	if q := queue[1]; q.Slug != "go-errors" || q.Operation != db.OpUpdate || q.BaseVersion != 1 || len(q.Fields) != 2 {
+		t.Errorf("update proposal: %+v", q)
+	}
+	if after := queue[1].Apply(e); after.Title != "Errors in Go" || !strings.Contains(after.Content, "errors.Is") {
+		t.Errorf("applied proposal: %+v", after)
+	}
+
+	if err := s.DB.Approve(ctx, "go-testing", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Approve(ctx, "go-errors", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := slugs("search_entries", map[string]any{"query": "go"}); len(got) != 2 {
+		t.Errorf("search after approval: %v", got)
+	}
+	e, _ = s.DB.GetEntry(ctx, "go-errors")
+	if e.Version != 2 || e.Title != "Errors in Go" || !strings.Contains(e.Content, "errors.Is") {
+		t.Errorf("after approving update: %+v", e)
+	}
+	if err := s.DB.Approve(ctx, "go-errors", false); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("approve with nothing queued: %v", err)
+	}
+
+	// A proposal against an entry that changed since conflicts
+	if _, text, isErr := toolCall(t, ts.URL, "update_entry", map[string]any{"slug": "go-errors", "content": "stale"}); isErr {
+		t.Fatalf("propose: %s", text)
+	}
+	if err := s.DB.UpdateEntry(ctx, "go-errors", 0, map[string]any{"description": "Human edit"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Approve(ctx, "go-errors", false); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("approve stale proposal: %v", err)
+	}
+	if err := s.DB.Approve(ctx, "go-errors", true); err != nil {
+		t.Errorf("forced approve: %v", err)
+	}
+
+	// Rejected deletes leave the entry; rejected new entries go to the trash
+	if _, text, isErr := toolCall(t, ts.URL, "delete_entry", map[string]any{"slug": "go-testing"}); isErr || !strings.Contains(text, `"operation":"delete"`) {
+		t.Fatalf("propose delete: %v %s", isErr, text)
+	}
+	if err := s.DB.Reject(ctx, "go-testing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.GetEntryMeta(ctx, "go-testing"); err != nil {
+		t.Errorf("entry gone after rejected delete: %v", err)
+	}
+	createEntry(t, ts.URL, "junk", "Junk", "Nonsense.", "", "", "", "", nil)
+	if err := s.DB.Reject(ctx, "junk"); err != nil {
+		t.Fatal(err)
+	}
+	trash, _ := s.DB.ListTrash(ctx)
+	if len(trash) != 1 || trash[0].Slug != "junk" {
+		t.Errorf("trash after rejecting a new entry: %+v", trash)
+	}
+	if queue, _ := s.DB.ReviewQueue(ctx); len(queue) != 0 {
+		t.Errorf("queue not empty: %+v", queue)
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "restore_entry", map[string]any{"slug": "junk"}); !isErr || !strings.Contains(text, "needs review") {
+		t.Errorf("restore from trash: %v %s", isErr, text)
+	}
+
+	// Drafts are queued too, and every decision is audited
+	if err := s.DB.CreateEntry(ctx, &db.Entry{Slug: "draft", Title: "Draft", Content: "WIP", Status: db.StatusDraft}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := s.DB.GetProposal(ctx, "draft"); err != nil || p.Status != db.StatusDraft {
+		t.Errorf("draft proposal: %+v, %v", p, err)
+	}
+	events, _ := s.DB.AuditLog(ctx, db.AuditFilter{Slug: "go-errors"})
+	var ops []string
+	for _, e := range slices.Backward(events) {
+		ops = append(ops, e.Operation+":"+e.Detail)
+	}
+	want := []string{"create:", "propose:update", "propose:update", "approve:update", "propose:update", "update:", "approve:update"}
+	if !slices.Equal(ops, want) {
+		t.Errorf("audit: %v (want %v)", ops, want)
+	}
+}
+
+func TestUnapprovedEntriesStayHidden(t *testing.T) {
+	s, ts := setup(t)
+	ctx := context.Background()
+	for _, e := range []*db.Entry{
+		{Slug: "live", Title: "Live", Content: "Approved content."},
+		{Slug: "draft", Title: "Draft", Content: "Builds on [[live]].", Status: db.StatusDraft},
+	} {
+		if err := s.DB.CreateEntry(ctx, e); err != nil {
+			t.Fatalf("create %s: %v", e.Slug, err)
+		}
+	}
+	if err := s.DB.AddLink(ctx, "draft", "live", db.LinkDependsOn); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if err := s.DB.PutAttachment(ctx, "draft", &db.Attachment{Name: "notes.txt", Data: []byte("secret")}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	related := func(args map[string]any) ([]db.RelatedEntry, string, bool) {
+		t.Helper()
+		_, text, isErr := toolCall(t, ts.URL, "get_related_entries", args)
+		var out []db.RelatedEntry
+		if !isErr {
+			json.Unmarshal([]byte(text), &out)
+		}
+		return out, text, isErr
+	}
+	if got, text, isErr := related(map[string]any{"slug": "live"}); isErr || len(got) != 0 {
+		t.Errorf("related of live: %s", text)
+	}
+	if _, text, isErr := related(map[string]any{"slug": "draft"}); !isErr || !strings.Contains(text, "awaiting review") {
+		t.Errorf("related from a draft: %s", text)
+	}
+	if got, text, _ := related(map[string]any{"slug": "live", "include_proposed": true}); len(got) != 1 || got[0].Slug != "draft" {
+		t.Errorf("related with include_proposed: %s", text)
+	}
+
+	backlinks := func(args map[string]any) []string {
+		t.Helper()
+		_, text, isErr := toolCall(t, ts.URL, "get_entry", args)
+		if isErr {
+			t.Fatalf("get_entry: %s", text)
+		}
+		var e db.Entry
+		json.Unmarshal([]byte(text), &e)
+		return e.Backlinks
+	}
+	if got := backlinks(map[string]any{"slug": "live"}); len(got) != 0 {
+		t.Errorf("backlinks: %v", got)
+	}
+	if got := backlinks(map[string]any{"slug": "live", "include_proposed": true}); !slices.Equal(got, []string{"draft"}) {
+		t.Errorf("backlinks with include_proposed: %v", got)
+	}
+
+	if err := s.DB.UpdateEntry(ctx, "draft", 0, map[string]any{"content": "Reworked [[live]]."}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	for _, args := range []map[string]any{{"slug": "draft"}, {"slug": "draft", "version": 1}} {
+		if _, text, isErr := toolCall(t, ts.URL, "get_entry_history", args); !isErr || !strings.Contains(text, "awaiting review") {
+			t.Errorf("history of a draft %v: %s", args, text)
+		}
+	}
+	if _, text, isErr := toolCall(t, ts.URL, "get_entry_history", map[string]any{"slug": "draft", "version": 1, "include_proposed": true}); isErr || !strings.Contains(text, "Builds on") {
+		t.Errorf("history with include_proposed: %s", text)
+	}
+
+	uri := "mcpedia://entries/draft/attachments/notes.txt"
+	if _, resp := call(t, ts.URL, "resources/read", 1, map[string]any{"uri": uri}, nil); resp.Error == nil || !strings.Contains(resp.Error.Message, "awaiting review") {
+		t.Errorf("attachment of a draft: %+v", resp)
+	}
+	if err := s.DB.Approve(ctx, "draft", false); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if _, resp := call(t, ts.URL, "resources/read", 2, map[string]any{"uri": uri}, nil); resp.Error != nil {
+		t.Errorf("attachment after approval: %+v", resp.Error)
+	}
+	if got := backlinks(map[string]any{"slug": "live"}); !slices.Equal(got, []string{"draft"}) {
+		t.Errorf("backlinks after approval: %v", got)
+	}
+}